@@ -0,0 +1,181 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+const (
+	//alertDeliveryAttempts is how many times alert is posted before giving up, delay doubles after each failure
+	alertDeliveryAttempts = 4
+	alertRetryDelay       = 30 * time.Second
+	//alertWorkers deliver alerts waiting in queue of alertQueueSize, alerts fired when it is full are dropped
+	alertWorkers   = 4
+	alertQueueSize = 256
+)
+
+type alertJob struct {
+	env   db.Env
+	alert db.Alert
+}
+
+var (
+	alertQueue       = make(chan alertJob, alertQueueSize)
+	alertWorkersOnce sync.Once
+)
+
+// jsonAlert is payload of generic webhooks, slack ones get message only.
+type jsonAlert struct {
+	Message string `json:"message"`
+	db.Alert
+}
+
+type slackAlert struct {
+	Text string `json:"text"`
+}
+
+// notifyAlerts evaluates alert rules against new analyzis and queues fired ones for delivery in background.
+func notifyAlerts(env db.Env, a db.Analyzis) {
+	alerts, err := env.EvaluateAlerts(a)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to EvaluateAlerts in notifyAlerts, %v", err))
+		return
+	}
+	alertWorkersOnce.Do(startAlertWorkers)
+	for _, alert := range alerts {
+		log.Info(fmt.Sprintf("Alert %v fired: %v", alert.Rule.ID, alertMessage(alert)))
+		enqueueAlert(alertQueue, env, alert)
+	}
+}
+
+func startAlertWorkers() {
+	client := webhookClient()
+	for i := 0; i < alertWorkers; i++ {
+		go func() {
+			for job := range alertQueue {
+				deliverAlert(job.env, client, job.alert, alertRetryDelay)
+			}
+		}()
+	}
+}
+
+// enqueueAlert does not block analyzis when webhooks are slow, alert is dropped and failed delivery logged if queue is full.
+func enqueueAlert(queue chan<- alertJob, env db.Env, alert db.Alert) bool {
+	select {
+	case queue <- alertJob{env, alert}:
+		return true
+	default:
+	}
+	log.Error(fmt.Sprintf("Alert %v dropped, delivery queue is full", alert.Rule.ID))
+	delivery := db.AlertDelivery{RuleID: alert.Rule.ID, Attempt: 1, Error: "Delivery queue is full", AttemptedAt: time.Now().UTC()}
+	if err := env.LogAlertDelivery(delivery); err != nil {
+		log.Error(fmt.Errorf("Failed on call to LogAlertDelivery in enqueueAlert, %v", err))
+	}
+	return false
+}
+
+// webhookClient connects only to public addresses, names are checked after resolution and on every redirect,
+// so webhook cannot reach internal network by DNS pointing to it. Proxy from environment is not used, it would hide the address.
+func webhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: publicAddressOnly}
+	tr := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &http.Client{Timeout: 30 * time.Second, Transport: tr}
+}
+
+func publicAddressOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("Failed on parsing address %v in publicAddressOnly, %v", address, err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !db.IsPublicIP(ip) {
+		return fmt.Errorf("Webhook address %v is not public", host)
+	}
+	return nil
+}
+
+// deliverAlert posts alert to webhook of its rule, retrying on network errors, 429 and 5xx responses.
+// Every attempt is written to delivery log.
+func deliverAlert(env db.Env, client httpClient, alert db.Alert, retryDelay time.Duration) {
+	payload, err := alertPayload(alert)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to alertPayload in deliverAlert, %v", err))
+		return
+	}
+	for attempt := 1; attempt <= alertDeliveryAttempts; attempt++ {
+		statusCode, err := postAlert(client, alert.Rule.WebhookURL, payload)
+		delivery := db.AlertDelivery{RuleID: alert.Rule.ID, Attempt: attempt, StatusCode: statusCode, Succeeded: err == nil, AttemptedAt: time.Now().UTC()}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if logErr := env.LogAlertDelivery(delivery); logErr != nil {
+			log.Error(fmt.Errorf("Failed on call to LogAlertDelivery in deliverAlert, %v", logErr))
+		}
+		if err == nil {
+			return
+		}
+		log.Warn(fmt.Sprintf("Attempt %v to deliver alert %v failed, %v", attempt, alert.Rule.ID, err))
+		if statusCode >= 400 && statusCode < 500 && statusCode != http.StatusTooManyRequests {
+			return
+		}
+		if attempt < alertDeliveryAttempts {
+			time.Sleep(retryDelay << uint(attempt-1))
+		}
+	}
+}
+
+func postAlert(client httpClient, url string, payload []byte) (int, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("Failed on creating request, %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("Failed on posting alert, %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("Webhook responded with %v", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func alertPayload(alert db.Alert) ([]byte, error) {
+	if alert.Rule.WebhookFormat == db.SlackWebhook {
+		return json.Marshal(slackAlert{alertMessage(alert)})
+	}
+	return json.Marshal(jsonAlert{alertMessage(alert), alert})
+}
+
+func alertMessage(alert db.Alert) string {
+	keyword := alert.Rule.Keyword
+	if alert.Analyzis.Country != "" && alert.Analyzis.Country != "any" {
+		keyword += " in " + alert.Analyzis.Country
+	}
+	days := int(db.AlertBaseline.Hours() / 24)
+	switch alert.Rule.Kind {
+	case db.ReactionBelowAlert:
+		return fmt.Sprintf("Reaction to %v is %.2f, below %.2f", keyword, alert.Value, alert.Rule.Threshold)
+	case db.ReactionDropAlert:
+		return fmt.Sprintf("Reaction to %v dropped to %.2f from %.2f on average in last %v days", keyword, alert.Value, *alert.Baseline, days)
+	case db.NewsSpikeAlert:
+		return fmt.Sprintf("%v news on %v against %.1f on average in last %v days", alert.Value, keyword, *alert.Baseline, days)
+	}
+	return fmt.Sprintf("Alert %v on %v fired", alert.Rule.Kind, keyword)
+}
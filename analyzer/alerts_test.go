@@ -0,0 +1,122 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+func TestAlertPayload(t *testing.T) {
+	baseline := float32(0.1)
+	alert := db.Alert{
+		Rule:     db.AlertRule{ID: 1, Keyword: "trump", Kind: db.ReactionDropAlert, Threshold: 0.2, WebhookFormat: db.SlackWebhook},
+		Analyzis: db.NewAnalyzis(1, "us", time.Now(), 10, 0, -0.25, -0.25, 0),
+		Value:    -0.25,
+		Baseline: &baseline,
+	}
+	payload, err := alertPayload(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"text":"Reaction to trump in us dropped to -0.25 from 0.10 on average in last 7 days"}`
+	if string(payload) != expected {
+		t.Fatalf("%v is not equal to %v", string(payload), expected)
+	}
+	alert.Rule.WebhookFormat = db.JSONWebhook
+	payload, err = alertPayload(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := map[string]interface{}{}
+	err = json.Unmarshal(payload, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded["message"] == nil || decoded["rule"] == nil || decoded["analyzis"] == nil || decoded["baseline"] != 0.1 {
+		t.Fatalf("Generic payload should carry message and alert, got %v", decoded)
+	}
+}
+
+func TestDeliverAlert(t *testing.T) {
+	env := db.NewEnv(db.NewMemoryStore(), "", "", "", "", "", nil, "")
+	err := env.CreateUser("abc", "abc", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.CreateKeyword(db.NewKeyword("trump", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(responses[requests])
+		requests++
+	}))
+	defer server.Close()
+	rule, err := env.CreateAlertRule("abc", db.AlertRule{Keyword: "trump", Kind: db.ReactionBelowAlert, WebhookURL: "https://hooks.example.com/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Test server listens on loopback, which rules cannot point to
+	rule.WebhookURL = server.URL
+	deliverAlert(env, server.Client(), db.Alert{Rule: rule}, time.Millisecond)
+	deliveries, err := env.GetAlertDeliveries("abc", rule.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 || len(deliveries) != 3 || !deliveries[0].Succeeded || deliveries[2].StatusCode != http.StatusBadGateway || deliveries[2].Error == "" {
+		t.Fatalf("Alert should be retried until delivered, got %v requests, %v", requests, deliveries)
+	}
+	responses, requests = []int{http.StatusNotFound}, 0
+	deliverAlert(env, server.Client(), db.Alert{Rule: rule}, time.Millisecond)
+	if requests != 1 {
+		t.Fatalf("Client errors should not be retried, got %v requests", requests)
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddress(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+	statusCode, err := postAlert(webhookClient(), server.URL, []byte("{}"))
+	if err == nil || statusCode != 0 || requests != 0 {
+		t.Fatalf("Webhook on loopback should not be reached, got %v, %v, %v requests", statusCode, err, requests)
+	}
+}
+
+func TestEnqueueAlert(t *testing.T) {
+	env := db.NewEnv(db.NewMemoryStore(), "", "", "", "", "", nil, "")
+	err := env.CreateUser("abc", "abc", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.CreateKeyword(db.NewKeyword("trump", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := env.CreateAlertRule("abc", db.AlertRule{Keyword: "trump", Kind: db.ReactionBelowAlert, WebhookURL: "https://hooks.example.com/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := make(chan alertJob, 1)
+	if !enqueueAlert(queue, env, db.Alert{Rule: rule}) {
+		t.Fatal("Alert should be queued")
+	}
+	if enqueueAlert(queue, env, db.Alert{Rule: rule}) {
+		t.Fatal("Alert should be dropped when queue is full")
+	}
+	deliveries, err := env.GetAlertDeliveries("abc", rule.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Succeeded || deliveries[0].Error == "" {
+		t.Fatalf("Dropped alert should be logged as failed delivery, got %v", deliveries)
+	}
+}
@@ -0,0 +1,110 @@
+package analyzer
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/mail"
+)
+
+// maxDigestText is how many characters of example text digest shows
+const maxDigestText = 200
+
+//go:embed templates/digest.tmpl
+var digestTemplateText string
+
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"reaction": func(r *float32) string {
+		if r == nil {
+			return "not analyzed"
+		}
+		return fmt.Sprintf("%.2f", *r)
+	},
+	"signed": func(f float32) string { return fmt.Sprintf("%+.2f", f) },
+	"change": func(i int) string { return fmt.Sprintf("%+d", i) },
+	"oneLine": func(s string) string {
+		s = strings.Join(strings.Fields(s), " ")
+		if r := []rune(s); len(r) > maxDigestText {
+			s = string(r[:maxDigestText]) + "..."
+		}
+		return s
+	},
+}).Parse(digestTemplateText))
+
+type digestView struct {
+	db.Digest
+	Period    string
+	PublicURL string
+}
+
+// StartDigests sends digests which are due every interval minutes, zero interval disables digests.
+func StartDigests(env db.Env, mailer mail.Mailer, publicURL string, interval int) {
+	if interval == 0 {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(interval) * time.Minute)
+		err := SendDigests(env, mailer, publicURL, time.Now())
+		if err != nil {
+			log.Error(fmt.Errorf("SendDigests in StartDigests failed on %v", err))
+		}
+	}
+}
+
+// SendDigests mails due digests, ones which failed to be sent are retried on next call.
+// Users with empty watchlist get no email, but their digest counts as sent.
+// Every digest is claimed before it is sent, so it is sent once also when replicas send digests at the same time.
+func SendDigests(env db.Env, mailer mail.Mailer, publicURL string, now time.Time) error {
+	digests, err := env.GetDueDigests(now)
+	if err != nil {
+		return fmt.Errorf("Failed on call to GetDueDigests, %v", err)
+	}
+	for _, d := range digests {
+		claimed, err := env.ClaimDigest(d, now)
+		if err != nil {
+			return fmt.Errorf("Failed on call to ClaimDigest for %v, %v", d.User.Username, err)
+		}
+		if !claimed || len(d.Keywords) == 0 {
+			continue
+		}
+		body, err := renderDigest(d, publicURL)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to renderDigest for %v in SendDigests, %v", d.User.Username, err))
+			releaseDigest(env, d, now)
+			continue
+		}
+		err = mailer.Send(d.User.Email, fmt.Sprintf("Your %v digest of keyword trends", d.Frequency), body)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on sending digest to %v in SendDigests, %v", d.User.Username, err))
+			releaseDigest(env, d, now)
+			continue
+		}
+	}
+	return nil
+}
+
+func releaseDigest(env db.Env, d db.Digest, claimedAt time.Time) {
+	err := env.ReleaseDigest(d, claimedAt)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to ReleaseDigest for %v in SendDigests, %v", d.User.Username, err))
+	}
+}
+
+func renderDigest(d db.Digest, publicURL string) (string, error) {
+	period := "day"
+	if d.Frequency == db.WeeklyDigest {
+		period = "week"
+	}
+	var b strings.Builder
+	err := digestTemplate.Execute(&b, digestView{d, period, strings.TrimSuffix(publicURL, "/") + "/"})
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
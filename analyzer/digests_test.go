@@ -0,0 +1,103 @@
+package analyzer
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/mail"
+)
+
+func TestRenderDigest(t *testing.T) {
+	reaction, change, volumeChange := float32(0.25), float32(-0.1), 12
+	digest := db.Digest{
+		User:      db.UserInfo{Username: "abc"},
+		Frequency: db.WeeklyDigest,
+		Keywords: []db.DigestKeyword{
+			{
+				WatchlistEntry: db.WatchlistEntry{KeywordSummary: db.KeywordSummary{Keyword: db.Keyword{Name: "trump"}}, Reaction: &reaction, ReactionChange: &change, AmountOfTweets: 30, AmountOfNews: 2, VolumeChange: &volumeChange},
+				Negative:       []db.Text{{TextProvider: "twitter", Text: "Sad\n  news", Reaction: -0.8}},
+			},
+			{WatchlistEntry: db.WatchlistEntry{KeywordSummary: db.KeywordSummary{Keyword: db.Keyword{Name: "apple"}}}},
+		},
+	}
+	body, err := renderDigest(digest, "http://localhost:8000/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Hi abc,",
+		"in the last week, compared with the week before",
+		"trump\n  Reaction: 0.25 (-0.10)\n  Volume: 30 tweets, 2 news (+12)\n  Most negative:\n    -0.80 twitter: Sad news\n",
+		"apple\n  Reaction: not analyzed\n  Volume: 0 tweets, 0 news\n",
+		"Manage your watchlist and digest at http://localhost:8000/",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Digest should contain %q, got %v", expected, body)
+		}
+	}
+	if strings.Contains(body, "Most positive") {
+		t.Fatalf("Empty sections should be skipped, got %v", body)
+	}
+}
+
+func TestSendDigests(t *testing.T) {
+	env := db.NewEnv(db.NewMemoryStore(), "", "", "", "", "", nil, "secret")
+	for _, username := range []string{"abc", "abd"} {
+		err := env.CreateUser(username, username+"@example.com", username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _, err := env.CreateEmailVerificationToken(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = env.VerifyEmail(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = env.SetDigestFrequency(username, db.DailyDigest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := env.CreateKeyword(db.NewKeyword("trump", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.Follow("abc", "trump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	mailer := mail.NewFileMailer(dir, "trends-analyzer@localhost")
+	tomorrow := time.Now().Add(24 * time.Hour)
+	//Replicas send digests at the same time
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- SendDigests(env, mailer, "http://localhost:8000", tomorrow)
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Only user following keywords should get digest once, got %v", files)
+	}
+	settings, err := env.GetDigestSettings("abd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.LastSentAt == nil || settings.LastSentAt.Before(tomorrow.Add(-time.Second)) {
+		t.Fatalf("Digest with empty watchlist should count as sent, got %v", settings)
+	}
+}
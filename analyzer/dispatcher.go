@@ -2,33 +2,153 @@ package analyzer
 
 import (
 	"fmt"
-	"math/rand"
+	"math"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/events"
 )
 
-func StartDispatching(env db.Env, interval int) {
-	rand.Seed(time.Now().Unix())
+const (
+	//Amount of latest analyzes taken into account while calculating volatility
+	volatilityWindow = 4
+	//Change of ReactionAvg between consecutive analyzes considered as sharp
+	reactionThreshold = 0.2
+	//Relative change of texts volume between consecutive analyzes considered as sharp
+	volumeThreshold = 0.5
+)
+
+// StartDispatching wakes up every interval minutes and analyzes keywords which are due.
+// Each keyword has its own interval, bounded by its schedule's min and max, which is shortened when
+// keyword's reaction or volume moves sharply and lengthened when it is flat.
+// Schedules are created with minInterval and maxInterval bounds, which can be overridden per keyword.
+// Failed tick is logged and dispatching is retried on next one.
+func StartDispatching(env db.Env, bus *events.Bus, interval, minInterval, maxInterval int) {
 	for {
 		time.Sleep(time.Duration(interval) * time.Minute)
-		keywords, err := env.GetKeywords()
+		err := dispatchDue(env, bus, interval, minInterval, maxInterval, time.Now())
+		if err != nil {
+			log.Error(fmt.Errorf("dispatchDue in StartDispatching failed on %v", err))
+		}
+	}
+}
+
+func dispatchDue(env db.Env, bus *events.Bus, interval, minInterval, maxInterval int, now time.Time) error {
+	keywords, err := env.GetKeywords()
+	if err != nil {
+		return fmt.Errorf("Failed on call to GetKeywords, %v", err)
+	}
+	err = env.PruneQuotaUsage(now.Add(-48 * time.Hour))
+	if err != nil {
+		log.Error(fmt.Errorf("PruneQuotaUsage in dispatchDue failed on %v", err))
+	}
+	for _, k := range keywords {
+		s := db.NewSchedule(k.ID, minInterval, maxInterval, interval, now, "any")
+		err := env.CreateScheduleIfNotPresent(s)
 		if err != nil {
-			log.Error(fmt.Errorf("GetKeywords in StartDispatching failed on %v", err))
-			return
+			log.Error(fmt.Errorf("CreateScheduleIfNotPresent in dispatchDue for %v failed on %v", k, err))
 		}
-		if len(keywords) == 0 {
+	}
+	schedules, err := env.GetSchedules()
+	if err != nil {
+		return fmt.Errorf("Failed on call to GetSchedules, %v", err)
+	}
+	keywordsByID := map[int]db.Keyword{}
+	for _, k := range keywords {
+		keywordsByID[k.ID] = k
+	}
+	for _, s := range schedules {
+		k, present := keywordsByID[s.KeywordID]
+		//Paused and archived keywords keep their schedules, so resumed ones are dispatched on next tick
+		if !present || k.Status != db.KeywordActive || s.NextRun.After(now) {
 			continue
 		}
-		k := keywords[rand.Intn(len(keywords))]
-		a, err := env.GetAnalyzes(k.Name, time.Time{}, time.Now(), "any")
+		err := dispatch(env, bus, k, s, now)
 		if err != nil {
-			log.Error(fmt.Errorf("GetAnalyzes in StartDispatching for %v failed on %v", k, err))
-			return
+			log.Error(fmt.Errorf("dispatch in dispatchDue for %v failed on %v", k, err))
+		}
+	}
+	return nil
+}
+
+func dispatch(env db.Env, bus *events.Bus, k db.Keyword, s db.Schedule, now time.Time) error {
+	//Keyword stays due, so it is analyzed on first tick after budgets are renewed
+	for _, provider := range []string{db.TwitterProvider, db.NewsProvider} {
+		available, err := env.QuotaAvailable(provider)
+		if err != nil {
+			return fmt.Errorf("Failed on call to QuotaAvailable, %v", err)
+		}
+		if !available {
+			log.Info(fmt.Sprintf("Deferred analyzing: %v, %v quota exhausted", k, provider))
+			return nil
+		}
+	}
+	after := now.Add(-time.Duration(2*volatilityWindow*s.MaxInterval) * time.Minute)
+	aa, err := env.GetAnalyzes(k.Name, after, now, s.Country)
+	if err != nil {
+		return fmt.Errorf("Failed on call to GetAnalyzes, %v", err)
+	}
+	s.Interval = nextInterval(s, inCountry(aa, s.Country))
+	s.NextRun = now.Add(time.Duration(s.Interval) * time.Minute)
+	err = env.UpdateSchedule(s)
+	if err != nil {
+		return fmt.Errorf("Failed on call to UpdateSchedule, %v", err)
+	}
+	log.Info(fmt.Sprintf("Started analyzing: %v in %v, next run in %v minutes", k, s.Country, s.Interval))
+	go Analyze(env, bus, k.Name, "both", s.Country, "any")
+	return nil
+}
+
+// inCountry keeps analyzes made in country, GetAnalyzes returns analyzes from all countries for any.
+func inCountry(aa []db.Analyzis, country string) []db.Analyzis {
+	kept := []db.Analyzis{}
+	for _, a := range aa {
+		if a.Country == country {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// nextInterval halves schedule's interval when latest analyzes moved sharply and doubles it when they were flat.
+func nextInterval(s db.Schedule, aa []db.Analyzis) int {
+	interval := s.Interval
+	reactionMove, volumeMove := volatility(aa)
+	if reactionMove >= reactionThreshold || volumeMove >= volumeThreshold {
+		interval /= 2
+	} else if len(aa) >= volatilityWindow && reactionMove < reactionThreshold/4 && volumeMove < volumeThreshold/4 {
+		interval *= 2
+	}
+	if interval < s.MinInterval {
+		return s.MinInterval
+	}
+	if interval > s.MaxInterval {
+		return s.MaxInterval
+	}
+	return interval
+}
+
+// volatility returns the biggest change of ReactionAvg and the biggest relative change of texts volume
+// between consecutive analyzes within volatilityWindow latest ones.
+func volatility(aa []db.Analyzis) (float64, float64) {
+	if len(aa) > volatilityWindow {
+		aa = aa[len(aa)-volatilityWindow:]
+	}
+	reactionMove := 0.0
+	volumeMove := 0.0
+	for i := 1; i < len(aa); i++ {
+		reactionMove = math.Max(reactionMove, math.Abs(float64(aa[i].ReactionAvg-aa[i-1].ReactionAvg)))
+		previous := float64(aa[i-1].AmountOfTweets + aa[i-1].AmountOfNews)
+		current := float64(aa[i].AmountOfTweets + aa[i].AmountOfNews)
+		if previous == 0 {
+			if current != 0 {
+				volumeMove = math.Inf(1)
+			}
+			continue
 		}
-		log.Info(fmt.Sprintf("Started analyzing: %v", k))
-		go Analyze(env, k.Name, "both", a[0].Country, "any")
+		volumeMove = math.Max(volumeMove, math.Abs(current-previous)/previous)
 	}
+	return reactionMove, volumeMove
 }
@@ -0,0 +1,71 @@
+package analyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+func analyzesWithReactions(reactions ...float32) []db.Analyzis {
+	aa := []db.Analyzis{}
+	for i, r := range reactions {
+		aa = append(aa, db.NewAnalyzis(1, "us", time.Date(2018, 1, 1, i, 0, 0, 0, time.UTC), 10, 10, r, r, r))
+	}
+	return aa
+}
+
+func TestVolatility(t *testing.T) {
+	reactionMove, volumeMove := volatility(analyzesWithReactions(0.5, 0.1, 0.2, 0.25, 0.3))
+	//0.5 -> 0.1 move is outside of the window
+	if reactionMove > 0.11 || reactionMove < 0.09 {
+		t.Fatalf("Unexpected reaction move %v", reactionMove)
+	}
+	if volumeMove != 0 {
+		t.Fatalf("Unexpected volume move %v", volumeMove)
+	}
+	aa := analyzesWithReactions(0.1, 0.1)
+	aa[1].AmountOfNews = 30
+	_, volumeMove = volatility(aa)
+	if volumeMove != 1 {
+		t.Fatalf("Unexpected volume move %v", volumeMove)
+	}
+}
+
+func TestNextInterval(t *testing.T) {
+	s := db.NewSchedule(1, 10, 80, 40, time.Time{}, "us")
+	testCases := []struct {
+		aa       []db.Analyzis
+		expected int
+	}{
+		{analyzesWithReactions(), 40},
+		{analyzesWithReactions(0.1, 0.1), 40},
+		{analyzesWithReactions(0.1, 0.1, 0.1, 0.1), 80},
+		{analyzesWithReactions(0.1, 0.1, 0.1, 0.5), 20},
+	}
+	for _, tc := range testCases {
+		interval := nextInterval(s, tc.aa)
+		if interval != tc.expected {
+			t.Fatalf("Interval %v is not equal to %v for %v", interval, tc.expected, tc.aa)
+		}
+	}
+	s = db.NewSchedule(1, 30, 60, 40, time.Time{}, "us")
+	if interval := nextInterval(s, analyzesWithReactions(0.1, 0.1, 0.1, 0.1)); interval != 60 {
+		t.Fatalf("Interval %v should be bounded by max interval", interval)
+	}
+	if interval := nextInterval(s, analyzesWithReactions(0.1, 0.9)); interval != 30 {
+		t.Fatalf("Interval %v should be bounded by min interval", interval)
+	}
+}
+
+func TestInCountry(t *testing.T) {
+	aa := analyzesWithReactions(0.1, 0.9, 0.1, 0.1, 0.1)
+	aa[1].Country = "pl"
+	s := db.NewSchedule(1, 10, 80, 40, time.Time{}, "us")
+	if interval := nextInterval(s, inCountry(aa, "us")); interval != 80 {
+		t.Fatalf("Analyzes in other countries should not count into volatility, got %v", interval)
+	}
+	if kept := inCountry(aa, "pl"); len(kept) != 1 || kept[0].ReactionAvg != 0.9 {
+		t.Fatalf("Only analyzes in pl should be kept, got %v", kept)
+	}
+}
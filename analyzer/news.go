@@ -27,26 +27,39 @@ type article struct {
 }
 
 func (c apiClient) getNews(keyword, country, date string) ([]text, error) {
-	tt := []text{}
 	countryParam := ""
 	if country != "any" {
 		countryParam = fmt.Sprintf("&country=%v", country)
 	}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%v/v2/top-headlines?q=%v%v", c.apiUrl, keyword, countryParam), nil)
+	return c.fetchNews(fmt.Sprintf("%v/v2/top-headlines?q=%v%v", c.apiUrl, keyword, countryParam))
+}
+
+// getNewsBetween searches all articles published between from and to, as top headlines are not date aware.
+func (c apiClient) getNewsBetween(keyword, country string, from, to time.Time) ([]text, error) {
+	languageParam := ""
+	if country != "any" {
+		languageParam = fmt.Sprintf("&language=%v", countryLanguage(country))
+	}
+	return c.fetchNews(fmt.Sprintf("%v/v2/everything?q=%v&from=%v&to=%v&pageSize=100%v", c.apiUrl, keyword, from.Format(time.RFC3339), to.Format(time.RFC3339), languageParam))
+}
+
+func (c apiClient) fetchNews(url string) ([]text, error) {
+	tt := []text{}
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("Failed on creating requests in getNews, %v", err)
+		return nil, fmt.Errorf("Failed on creating requests in fetchNews, %v", err)
 	}
 	req.Header.Add("X-Api-Key", c.apiKey)
 	resp, err := c.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Failed on executing %v in getNews", req)
+		return nil, fmt.Errorf("Failed on executing %v in fetchNews", req)
 	}
 	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	var nA newsAPI
 	err = decoder.Decode(&nA)
 	if err != nil {
-		return nil, fmt.Errorf("Failed on decoding %v, in getNews, %v", resp.Body, err)
+		return nil, fmt.Errorf("Failed on decoding %v, in fetchNews, %v", resp.Body, err)
 	}
 	for _, a := range nA.Articles {
 		txt := fmt.Sprintf("%v %v", a.Title, a.Description)
@@ -63,6 +76,13 @@ func (c apiClient) getNews(keyword, country, date string) ([]text, error) {
 	return tt, nil
 }
 
+func countryLanguage(country string) string {
+	if country == "gb" || country == "us" {
+		return "en"
+	}
+	return country
+}
+
 func hash(s string) int {
 	h := fnv.New32a()
 	h.Write([]byte(s))
@@ -33,3 +33,20 @@ func TestGetNews(t *testing.T) {
 		t.Fatalf("%v is not equal to %v", nn[0], expected)
 	}
 }
+
+func TestCountryLanguage(t *testing.T) {
+	testCases := []struct {
+		country  string
+		language string
+	}{
+		{"us", "en"},
+		{"gb", "en"},
+		{"pl", "pl"},
+		{"de", "de"},
+	}
+	for _, tc := range testCases {
+		if language := countryLanguage(tc.country); language != tc.language {
+			t.Fatalf("%v is not equal to %v for %v", language, tc.language, tc.country)
+		}
+	}
+}
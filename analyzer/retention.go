@@ -0,0 +1,54 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+// StartRetention applies retention policy every interval minutes, in dry run it only logs what would be removed.
+// Zero or negative interval disables retention, like empty policy does.
+func StartRetention(env db.Env, policy db.RetentionPolicy, interval int, dryRun bool) {
+	if interval <= 0 || policy.RawDays == 0 && policy.HourlyDays == 0 {
+		return
+	}
+	for {
+		RunRetention(env, policy, dryRun)
+		time.Sleep(time.Duration(interval) * time.Minute)
+	}
+}
+
+func RunRetention(env db.Env, policy db.RetentionPolicy, dryRun bool) error {
+	report, err := env.ApplyRetention(policy, time.Now(), dryRun)
+	if err != nil {
+		log.Error(fmt.Errorf("ApplyRetention in RunRetention failed on %v", err))
+		return err
+	}
+	prefix := "Retention"
+	if dryRun {
+		prefix = "Retention dry run"
+	}
+	log.Info(fmt.Sprintf("%v: %v analyzes and %v texts before %v deleted, %v rollups repaired, %v hourly rollups before %v deleted",
+		prefix, report.AnalyzesDeleted, report.TextsDeleted, report.RawCutoff.Format("2006-01-02"), report.RollupsRepaired, report.HourlyRollupsDeleted, report.HourlyCutoff.Format("2006-01-02")))
+	return nil
+}
+
+// loginAttemptsPruneInterval is how often login attempts out of retention are removed.
+const loginAttemptsPruneInterval = time.Hour
+
+// StartLoginAttemptsPruning removes login attempts out of retention periodically,
+// it does not depend on successful logins, so log of account under attack is pruned too.
+func StartLoginAttemptsPruning(env db.Env) {
+	for {
+		deleted, err := env.PruneLoginAttempts(time.Now().UTC())
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to PruneLoginAttempts in StartLoginAttemptsPruning, %v", err))
+		} else {
+			log.Debug(fmt.Sprintf("%v login attempts pruned", deleted))
+		}
+		time.Sleep(loginAttemptsPruneInterval)
+	}
+}
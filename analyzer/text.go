@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
 
 	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/events"
 )
 
 type apiClient struct {
@@ -33,6 +35,7 @@ type text struct {
 }
 
 type analyzedText struct {
+	text         string
 	reaction     float32
 	textProvider string
 	timestamp    time.Time
@@ -48,20 +51,107 @@ func clientWithTimeout(tlsSecure bool) (client *http.Client) {
 
 }
 
-func Analyze(env db.Env, keyword, textProvider, country, date string) {
+// Analyze stores analyzis of current texts on keyword, publishes it with job status changes on bus
+// and notifies alert rules it fires.
+// Backfilled analyzes are not checked against alert rules, history would fire them long after the fact.
+func Analyze(env db.Env, bus *events.Bus, keyword, textProvider, country, date string) {
 	log.Debug(fmt.Sprintf("Analyzing %v, %v, %v, %v, %v", env, keyword, textProvider, country, date))
+	bus.Publish(events.NewJobEvent(keyword, events.JobStarted))
 	tt, err := getText(env, keyword, textProvider, country, date)
 	if err != nil {
 		log.Error(fmt.Errorf("Analyze failed, %v", err))
+		bus.Publish(events.NewJobEvent(keyword, events.JobFailed))
 		return
 	}
+	analyzis, err := createAnalyzis(env, keyword, country, time.Now(), tt)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to createAnalyzis in Analyze, %v", err))
+		bus.Publish(events.NewJobEvent(keyword, events.JobFailed))
+		return
+	}
+	bus.Publish(events.NewAnalyzisEvent(keyword, analyzis))
+	bus.Publish(events.NewJobEvent(keyword, events.JobFinished))
+	notifyAlerts(env, analyzis)
+}
+
+// Backfill analyzes texts published between from and to, storing one analyzis per day with day's timestamp.
+// Days without texts are skipped, analyzis of nothing would look like neutral reaction in history.
+// Twitter search reaches only TwitterSearchWindow back, so older ranges can be backfilled with news only.
+func Backfill(env db.Env, keyword, textProvider, country string, from, to time.Time) error {
+	if !from.Before(to) {
+		return fmt.Errorf("Backfill range from %v to %v is empty", from, to)
+	}
+	if reach := time.Now().Add(-TwitterSearchWindow); textProvider != "news" && from.Before(reach) {
+		return fmt.Errorf("Twitter search does not reach %v, tweets can be backfilled from %v", from, reach.Truncate(24*time.Hour))
+	}
+	for start := from.UTC().Truncate(24 * time.Hour); start.Before(to); start = start.Add(24 * time.Hour) {
+		end := start.Add(24 * time.Hour)
+		log.Info(fmt.Sprintf("Backfilling %v from %v to %v", keyword, start, end))
+		tt, err := getTextBetween(env, keyword, textProvider, country, start, end)
+		if err != nil {
+			return fmt.Errorf("Failed on call to getTextBetween for window starting at %v in Backfill, %v", start, err)
+		}
+		if len(tt) == 0 {
+			log.Info(fmt.Sprintf("No texts on %v from %v to %v, skipping", keyword, start, end))
+			continue
+		}
+		_, err = createAnalyzis(env, keyword, country, start, tt)
+		if err != nil {
+			return fmt.Errorf("Failed on call to createAnalyzis for window starting at %v in Backfill, %v", start, err)
+		}
+	}
+	return nil
+}
+
+func createAnalyzis(env db.Env, keyword, country string, timestamp time.Time, tt []text) (db.Analyzis, error) {
+	count, sums, analyzed, err := analyzeTexts(tt)
+	if err != nil {
+		return db.Analyzis{}, fmt.Errorf("Failed on call to analyzeTexts, %v", err)
+	}
+	reactionAvg, reactionTweets, reactionNews := calcReaction(count, sums)
+	keywordID, err := env.GetKeywordID(keyword)
+	if err != nil {
+		return db.Analyzis{}, fmt.Errorf("Failed on call to GetKeywordID for %v, %v", keyword, err)
+	}
+	analyzis := db.NewAnalyzis(keywordID, country, timestamp, count["twitter"], count["news"], reactionAvg, reactionTweets, reactionNews)
+	err = env.CreateAnalyzis(analyzis)
+	if err != nil {
+		return db.Analyzis{}, fmt.Errorf("Failed on call to CreateAnalyzis for %v, %v", analyzis, err)
+	}
+	err = env.CreateTexts(exampleTexts(analyzis, analyzed))
+	if err != nil {
+		return db.Analyzis{}, fmt.Errorf("Failed on call to CreateTexts for %v, %v", analyzis, err)
+	}
+	return analyzis, nil
+}
+
+// exampleTexts picks the most positive and the most negative texts of analyzis to be kept.
+func exampleTexts(analyzis db.Analyzis, analyzed []analyzedText) []db.Text {
+	sorted := append([]analyzedText{}, analyzed...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].reaction > sorted[j].reaction })
+	texts := []db.Text{}
+	for i := 0; i < len(sorted) && i < db.TextsPerAnalyzis && sorted[i].reaction > 0; i++ {
+		texts = append(texts, db.NewText(analyzis.KeywordID, analyzis.Country, sorted[i].textProvider, sorted[i].text, sorted[i].reaction, analyzis.Timestamp))
+	}
+	for i := len(sorted) - 1; i >= 0 && i >= len(sorted)-db.TextsPerAnalyzis && sorted[i].reaction < 0; i-- {
+		texts = append(texts, db.NewText(analyzis.KeywordID, analyzis.Country, sorted[i].textProvider, sorted[i].text, sorted[i].reaction, analyzis.Timestamp))
+	}
+	return texts
+}
+
+func analyzeTexts(tt []text) (map[string]int, map[string]float32, []analyzedText, error) {
+	count := map[string]int{}
+	sums := map[string]float32{}
+	analyzed := []analyzedText{}
+	if len(tt) == 0 {
+		return count, sums, analyzed, nil
+	}
 	c := make(chan analyzedText)
 	wg := new(sync.WaitGroup)
 	ctx := context.Background()
 	client, err := language.NewClient(ctx)
 	if err != nil {
-		log.Error(fmt.Errorf("Failed to create new language client, %v", err))
-		return
+		return nil, nil, nil, fmt.Errorf("Failed to create new language client, %v", err)
 	}
 	for _, t := range tt {
 		wg.Add(1)
@@ -71,26 +161,31 @@ func Analyze(env db.Env, keyword, textProvider, country, date string) {
 		wg.Wait()
 		close(c)
 	}()
-	count := map[string]int{}
-	sums := map[string]float32{}
 	for t := range c {
 		count[t.textProvider]++
 		sums[t.textProvider] += t.reaction
+		analyzed = append(analyzed, t)
 	}
-	reactionAvg, reactionTweets, reactionNews := calcReaction(count, sums)
-	keywordID, err := env.GetKeywordID(keyword)
-	if err != nil {
-		log.Error(fmt.Errorf("Failed on call to GetKeywordID for %v in Analyze, %v", keyword, err))
-		return
-	}
-	analyzis := db.NewAnalyzis(keywordID, country, time.Now(), count["twitter"], count["news"], reactionAvg, reactionTweets, reactionNews)
-	err = env.CreateAnalyzis(analyzis)
-	if err != nil {
-		log.Error(fmt.Errorf("Failed on call to CreateAnalyzes for %v in Analyze, %v", analyzis, err))
+	return count, sums, analyzed, nil
+}
+
+// textProviders maps text provider parameter to providers whose quotas are consumed.
+func textProviders(textProvider string) []string {
+	switch textProvider {
+	case "twitter":
+		return []string{db.TwitterProvider}
+	case "news":
+		return []string{db.NewsProvider}
 	}
+	return []string{db.TwitterProvider, db.NewsProvider}
 }
 
+// getText consumes quotas of all providers before fetching, so none is spent when other one is exhausted.
 func getText(env db.Env, keyword, textProvider, country, date string) ([]text, error) {
+	err := env.ConsumeQuotas(textProviders(textProvider)...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to ConsumeQuotas in Analyze, %v", err)
+	}
 	tt := []text{}
 	if textProvider == "twitter" || textProvider == "both" {
 		c := apiClient{TwitterAPIUrl, env.TwitterAPIKey, clientWithTimeout(true)}
@@ -113,6 +208,31 @@ func getText(env db.Env, keyword, textProvider, country, date string) ([]text, e
 	return tt, nil
 }
 
+func getTextBetween(env db.Env, keyword, textProvider, country string, from, to time.Time) ([]text, error) {
+	err := env.ConsumeQuotas(textProviders(textProvider)...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to ConsumeQuotas in getTextBetween, %v", err)
+	}
+	tt := []text{}
+	if textProvider == "twitter" || textProvider == "both" {
+		c := apiClient{TwitterAPIUrl, env.TwitterAPIKey, clientWithTimeout(true)}
+		tweets, err := c.getTweetsBetween(keyword, country, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on call to getTweetsBetween in getTextBetween, %v", err)
+		}
+		tt = append(tt, tweets...)
+	}
+	if textProvider == "news" || textProvider == "both" {
+		c := apiClient{NewsAPIUrl, env.NewsAPIKey, clientWithTimeout(true)}
+		nn, err := c.getNewsBetween(keyword, country, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on call to getNewsBetween in getTextBetween, %v", err)
+		}
+		tt = append(tt, nn...)
+	}
+	return tt, nil
+}
+
 func calcReaction(count map[string]int, sums map[string]float32) (float32, float32, float32) {
 	reactionTweets := float32(0)
 	reactionNews := float32(0)
@@ -139,7 +259,7 @@ func analyzeText(ctx context.Context, client *language.Client, t text, c chan an
 		log.Error(fmt.Errorf("Failed on call to analyzeSentiment, %v", err))
 		return
 	}
-	c <- analyzedText{s, t.textProvider, t.timestamp}
+	c <- analyzedText{t.text, s, t.textProvider, t.timestamp}
 
 }
 func analyzeSentiment(ctx context.Context, client *language.Client, text string) (float32, error) {
@@ -2,8 +2,42 @@ package analyzer
 
 import (
 	"testing"
+	"time"
+
+	"github.com/cezkuj/trends-analyzer/db"
 )
 
 func TestAnalyzeSentiment(t *testing.T) {
 	//TODO: Add mock for gcp api if needed
 }
+
+func TestExampleTexts(t *testing.T) {
+	analyzis := db.NewAnalyzis(1, "pl", time.Now(), 0, 0, 0, 0, 0)
+	analyzed := []analyzedText{}
+	for i := -7; i <= 7; i++ {
+		analyzed = append(analyzed, analyzedText{text: string(rune('h' + i)), reaction: float32(i) / 10, textProvider: "twitter"})
+	}
+	texts := exampleTexts(analyzis, analyzed)
+	if len(texts) != 2*db.TextsPerAnalyzis || texts[0].Reaction != 0.7 || texts[db.TextsPerAnalyzis].Reaction != -0.7 || texts[0].Text != "o" {
+		t.Fatalf("The most positive and the most negative texts should be picked, got %v", texts)
+	}
+	for _, text := range texts {
+		if text.Reaction == 0 || text.KeywordID != 1 || text.Country != "pl" {
+			t.Fatalf("Unexpected text %v", text)
+		}
+	}
+	if texts := exampleTexts(analyzis, analyzed[:3]); len(texts) != 3 || texts[0].Reaction != -0.7 {
+		t.Fatalf("Only negative texts should be picked, got %v", texts)
+	}
+}
+
+func TestBackfillRange(t *testing.T) {
+	env := db.NewEnv(db.NewMemoryStore(), "", "", "", "", "", nil, "")
+	now := time.Now()
+	if err := Backfill(env, "trump", "news", "any", now, now.Add(-24*time.Hour)); err == nil {
+		t.Fatal("Empty range should be rejected")
+	}
+	if err := Backfill(env, "trump", "both", "any", now.Add(-30*24*time.Hour), now); err == nil {
+		t.Fatal("Tweets older than search window should not be backfilled")
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 const (
 	TwitterAPIUrl = "https://api.twitter.com"
+	//TwitterSearchWindow is how far back standard search finds tweets
+	TwitterSearchWindow = 7 * 24 * time.Hour
 )
 
 type twitterAPI struct {
@@ -25,34 +27,55 @@ type status struct {
 }
 
 func (c apiClient) getTweets(keyword, lang, date string) ([]text, error) {
-	tt := []text{}
 	langParam := ""
 	if lang != "any" {
-		if lang == "gb" || lang == "us" {
-			lang = "en"
+		langParam = fmt.Sprintf("&lang=%v", countryLanguage(lang))
+	}
+	return c.fetchTweets(fmt.Sprintf("%v/1.1/search/tweets.json?q=%v%v&count=100", c.apiUrl, keyword, langParam))
+}
+
+// getTweetsBetween returns tweets created between from and to, search API itself only supports upper bound date.
+func (c apiClient) getTweetsBetween(keyword, lang string, from, to time.Time) ([]text, error) {
+	langParam := ""
+	if lang != "any" {
+		langParam = fmt.Sprintf("&lang=%v", countryLanguage(lang))
+	}
+	tweets, err := c.fetchTweets(fmt.Sprintf("%v/1.1/search/tweets.json?q=%v%v&count=100&until=%v", c.apiUrl, keyword, langParam, to.Format("2006-01-02")))
+	if err != nil {
+		return nil, err
+	}
+	tt := []text{}
+	for _, t := range tweets {
+		if t.timestamp.Before(from) || !t.timestamp.Before(to) {
+			continue
 		}
-		langParam = fmt.Sprintf("&lang=%v", lang)
+		tt = append(tt, t)
 	}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%v/1.1/search/tweets.json?q=%v%v&count=100", c.apiUrl, keyword, langParam), nil)
+	return tt, nil
+}
+
+func (c apiClient) fetchTweets(url string) ([]text, error) {
+	tt := []text{}
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("Failed on creating twitter request in getTweets, %v", err)
+		return nil, fmt.Errorf("Failed on creating twitter request in fetchTweets, %v", err)
 	}
 	req.Header.Add("Authorization", c.apiKey)
 	resp, err := c.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Failed on executing %v in getTweets, %v", req, err)
+		return nil, fmt.Errorf("Failed on executing %v in fetchTweets, %v", req, err)
 	}
 	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	var tA twitterAPI
 	err = decoder.Decode(&tA)
 	if err != nil {
-		return nil, fmt.Errorf("Failed on decoding %v in getTweets, %v", resp.Body, err)
+		return nil, fmt.Errorf("Failed on decoding %v in fetchTweets, %v", resp.Body, err)
 	}
 	for _, s := range tA.Statuses {
 		parsedTimestamp, err := time.Parse(time.RubyDate, s.CreatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("Failed on parsing %v in getTweets, %v", time.RubyDate, err)
+			return nil, fmt.Errorf("Failed on parsing %v in fetchTweets, %v", time.RubyDate, err)
 		}
 		t := text{
 			id:           s.ID,
@@ -2,6 +2,7 @@ package analyzer
 
 import (
 	"testing"
+	"time"
 )
 
 func TestGetTweets(t *testing.T) {
@@ -17,3 +18,21 @@ func TestGetTweets(t *testing.T) {
 		t.Fatalf("%v is not equal to %v", tweets[0], expected)
 	}
 }
+
+func TestGetTweetsBetween(t *testing.T) {
+	c := apiClient{TwitterAPIUrl, "", mockClient{"examples/twitter.json"}}
+	tweets, err := c.getTweetsBetween("trump", "us", time.Date(2018, 9, 10, 0, 0, 0, 0, time.UTC), time.Date(2018, 9, 11, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tweets) != 100 {
+		t.Fatalf("Expected 100 tweets, got %v", len(tweets))
+	}
+	tweets, err = c.getTweetsBetween("trump", "us", time.Date(2018, 9, 11, 0, 0, 0, 0, time.UTC), time.Date(2018, 9, 12, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tweets) != 0 {
+		t.Fatalf("Tweets outside of window should be skipped, got %v", tweets)
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/cezkuj/trends-analyzer/analyzer"
+	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/server"
+)
+
+var (
+	backfillKeyword      string
+	backfillFrom         string
+	backfillTo           string
+	backfillCountry      string
+	backfillTextProvider string
+)
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Analyzes keyword's history day by day.",
+	Long: ` Analyzes texts published in given date range, storing one analyzis per day.
+        Days without texts are skipped. Twitter search reaches only last 7 days,
+        so ranges older than that are news-only and have to be backfilled with --text-provider news.
+        Examples:
+
+        trends-analyzer backfill -t ABC -n DEF -p GHI -k bitcoin --from 2018-09-01 --to 2018-09-10 --text-provider news`,
+	Args: cobra.NoArgs,
+	Run:  backfill,
+}
+
+func backfill(cmd *cobra.Command, args []string) {
+	from, err := time.Parse("2006-01-02", backfillFrom)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on parsing from date %v in backfill, %v", backfillFrom, err))
+		os.Exit(1)
+	}
+	to := time.Now()
+	if backfillTo != "" {
+		to, err = time.Parse("2006-01-02", backfillTo)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on parsing to date %v in backfill, %v", backfillTo, err))
+			os.Exit(1)
+		}
+	}
+	env, err := server.InitEnv(dbCfg(cmd), twitterAPIKey, newsAPIKey, "", "", "", "", quotaLimits())
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to InitEnv in backfill, %v", err))
+		os.Exit(1)
+	}
+	err = env.CreateKeywordIfNotPresent(db.NewKeyword(backfillKeyword, "unknown", ""))
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to CreateKeywordIfNotPresent in backfill, %v", err))
+		os.Exit(1)
+	}
+	err = analyzer.Backfill(env, backfillKeyword, backfillTextProvider, backfillCountry, from, to)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to Backfill, %v", err))
+		os.Exit(1)
+	}
+}
+
+func init() {
+	backfillCmd.Flags().StringVarP(&twitterAPIKey, "twitter-api-key", "t", "", "Twitter API key.")
+	backfillCmd.MarkFlagRequired("twitter-api-key")
+	backfillCmd.Flags().StringVarP(&newsAPIKey, "news-api-key", "n", "", "News API key.")
+	backfillCmd.MarkFlagRequired("news-api-key")
+	backfillCmd.Flags().StringVarP(&backfillKeyword, "keyword", "k", "", "Keyword to backfill, created if not present.")
+	backfillCmd.MarkFlagRequired("keyword")
+	backfillCmd.Flags().StringVar(&backfillFrom, "from", "", "First day of backfilled range in YYYY-MM-DD format.")
+	backfillCmd.MarkFlagRequired("from")
+	backfillCmd.Flags().StringVar(&backfillTo, "to", "", "Day after backfilled range in YYYY-MM-DD format. Default value is now.")
+	backfillCmd.Flags().StringVarP(&backfillCountry, "country", "c", "any", "Country of analyzed texts. Default value is any.")
+	backfillCmd.Flags().StringVar(&backfillTextProvider, "text-provider", "both", "Provider of analyzed texts: twitter, news or both, ranges older than 7 days are news-only. Default value is both.")
+	rootCmd.AddCommand(backfillCmd)
+}
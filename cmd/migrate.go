@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/server"
+)
+
+var migrateTo int
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [up|down|status]",
+	Short: "Migrates database schema.",
+	Long: ` Applies or reverts versioned schema migrations.
+        up applies all pending migrations, down reverts the newest one, --to selects target version.
+        Examples:
+
+        trends-analyzer migrate up -p ABC
+        trends-analyzer migrate down -p ABC --to 1
+        trends-analyzer migrate status -p ABC`,
+	Args: cobra.ExactArgs(1),
+	Run:  migrate,
+}
+
+func migrate(cmd *cobra.Command, args []string) {
+	store, err := server.OpenStore(dbCfg(cmd))
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to OpenStore in migrate, %v", err))
+		os.Exit(1)
+	}
+	statuses, err := store.GetMigrationStatuses()
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to GetMigrationStatuses in migrate, %v", err))
+		os.Exit(1)
+	}
+	current := db.CurrentMigration(statuses)
+	target := migrateTo
+	switch args[0] {
+	case "up":
+		if target < 0 {
+			target = db.LatestMigration(statuses)
+		}
+		if target < current {
+			log.Error(fmt.Errorf("Target %v is older than current version %v, use down instead", target, current))
+			os.Exit(1)
+		}
+	case "down":
+		if target < 0 {
+			target = previousMigration(statuses, current)
+		}
+		if target > current {
+			log.Error(fmt.Errorf("Target %v is newer than current version %v, use up instead", target, current))
+			os.Exit(1)
+		}
+	case "status":
+		printMigrationStatuses(statuses)
+		return
+	default:
+		log.Error(fmt.Errorf("Unknown migrate action %v", args[0]))
+		os.Exit(1)
+	}
+	err = store.Migrate(target)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to Migrate in migrate, %v", err))
+		os.Exit(1)
+	}
+	log.Info(fmt.Sprintf("Migrated from version %v to %v", current, target))
+}
+
+func previousMigration(statuses []db.MigrationStatus, current int) int {
+	previous := 0
+	for _, s := range statuses {
+		if s.Applied && s.Version < current {
+			previous = s.Version
+		}
+	}
+	return previous
+}
+
+func printMigrationStatuses(statuses []db.MigrationStatus) {
+	for _, s := range statuses {
+		state := "pending"
+		if s.Applied {
+			state = fmt.Sprintf("applied at %v", s.AppliedAt)
+		}
+		fmt.Printf("%04d_%v %v\n", s.Version, s.Name, state)
+	}
+}
+
+func init() {
+	migrateCmd.Flags().IntVar(&migrateTo, "to", -1, "Target migration version. Default is the latest one for up and the previous one for down.")
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/cezkuj/trends-analyzer/analyzer"
+	"github.com/cezkuj/trends-analyzer/server"
+)
+
+var retentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Applies data retention once.",
+	Long: ` Downsamples raw analyzes older than --raw-retention-days into rollups and deletes them along with their texts,
+        deletes hourly rollups older than --hourly-retention-days.
+        Examples:
+
+        trends-analyzer retention -p ABC --raw-retention-days 30 --hourly-retention-days 90 --retention-dry-run`,
+	Args: cobra.NoArgs,
+	Run:  retention,
+}
+
+func retention(cmd *cobra.Command, args []string) {
+	env, err := server.InitEnv(dbCfg(cmd), "", "", "", "", "", "", quotaLimits())
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to InitEnv in retention, %v", err))
+		os.Exit(1)
+	}
+	err = analyzer.RunRetention(env, retentionPolicy(), retentionDryRun)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(retentionCmd)
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/cezkuj/trends-analyzer/server"
+)
+
+var rollupCmd = &cobra.Command{
+	Use:   "rollup rebuild",
+	Short: "Maintains rollups of analyzes.",
+	Long: ` Rebuilds hourly and daily rollups of analyzes from stored raw ones.
+        Rollups are updated whenever analyzis is stored, rebuild is needed only after changing analyzes by hand.
+        Analyzes stored during rebuild may be counted twice, so it should be run with dispatcher stopped.
+        Examples:
+
+        trends-analyzer rollup rebuild -p ABC`,
+	Args: cobra.ExactArgs(1),
+	Run:  rollup,
+}
+
+func rollup(cmd *cobra.Command, args []string) {
+	if args[0] != "rebuild" {
+		log.Error(fmt.Errorf("Unknown rollup action %v", args[0]))
+		os.Exit(1)
+	}
+	env, err := server.InitEnv(dbCfg(cmd), "", "", "", "", "", "", quotaLimits())
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to InitEnv in rollup, %v", err))
+		os.Exit(1)
+	}
+	err = env.RebuildRollups()
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to RebuildRollups in rollup, %v", err))
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(rollupCmd)
+}
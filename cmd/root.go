@@ -7,23 +7,57 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/mail"
 	"github.com/cezkuj/trends-analyzer/server"
 )
 
 var (
-	dbUser             string
-	dbPass             string
-	dbHost             string
-	dbPort             int
-	dbName             string
-	dispatcherInterval int
-	readOnly           bool
-	registrationCode   string
-	twitterAPIKey      string
-	newsAPIKey         string
-	stocksAPIKey       string
-	salt               string
-	verbose            bool
+	dbDriver            string
+	dbPath              string
+	dbUser              string
+	dbPass              string
+	dbHost              string
+	dbPort              int
+	dbName              string
+	dbSSLMode           string
+	dispatcherInterval  int
+	minInterval         int
+	maxInterval         int
+	readOnly            bool
+	privateReads        bool
+	trustedProxies      []string
+	registrationCode    string
+	twitterAPIKey       string
+	newsAPIKey          string
+	stocksAPIKey        string
+	salt                string
+	tokenSecret         string
+	publicURL           string
+	smtpHost            string
+	smtpPort            int
+	smtpUsername        string
+	smtpPassword        string
+	mailFrom            string
+	mailDir             string
+	mailLogBodies       bool
+	oidcIssuer          string
+	oidcClientID        string
+	oidcClientSecret    string
+	oidcRedirectURL     string
+	oidcDefaultRole     string
+	twitterDailyQuota   int
+	twitterMinuteQuota  int
+	newsDailyQuota      int
+	newsMinuteQuota     int
+	stocksDailyQuota    int
+	stocksMinuteQuota   int
+	rawRetentionDays    int
+	hourlyRetentionDays int
+	retentionInterval   int
+	digestInterval      int
+	retentionDryRun     bool
+	verbose             bool
 )
 
 var rootCmd = &cobra.Command{
@@ -33,18 +67,79 @@ var rootCmd = &cobra.Command{
         Examples:
         
         trends-analyzer -t ABC -n DEF`,
-	Args: cobra.NoArgs,
-	Run:  startServer,
+	Args:             cobra.NoArgs,
+	PersistentPreRun: setLogLevel,
+	Run:              startServer,
 }
 
-func startServer(cmd *cobra.Command, args []string) {
+func setLogLevel(cmd *cobra.Command, args []string) {
 	if verbose {
 		log.SetLevel(log.DebugLevel)
 	}
-	dbCfg := server.NewDbCfg(dbUser, dbPass, dbHost, dbPort, dbName)
-	server.StartServer(dbCfg, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode, dispatcherInterval, readOnly)
+}
+
+func startServer(cmd *cobra.Command, args []string) {
+	proxies, err := server.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to ParseTrustedProxies in startServer, %v", err))
+		os.Exit(1)
+	}
+	server.StartServer(server.Cfg{
+		DB:                dbCfg(cmd),
+		TwitterAPIKey:     twitterAPIKey,
+		NewsAPIKey:        newsAPIKey,
+		StocksAPIKey:      stocksAPIKey,
+		Salt:              salt,
+		RegistrationCode:  registrationCode,
+		TokenSecret:       tokenSecret,
+		Quotas:            quotaLimits(),
+		DispatchInterval:  dispatcherInterval,
+		MinInterval:       minInterval,
+		MaxInterval:       maxInterval,
+		Retention:         retentionPolicy(),
+		RetentionInterval: retentionInterval,
+		RetentionDryRun:   retentionDryRun,
+		ReadOnly:          readOnly,
+		PrivateReads:      privateReads,
+		TrustedProxies:    proxies,
+		Mailer:            mailer(),
+		PublicURL:         publicURL,
+		OIDC:              server.NewOIDCCfg(oidcIssuer, oidcClientID, oidcClientSecret, oidcRedirectURL, oidcDefaultRole),
+		DigestInterval:    digestInterval,
+	})
+}
+
+func dbCfg(cmd *cobra.Command) server.DbCfg {
+	port := dbPort
+	if dbDriver == db.PostgresDriver && !cmd.Flags().Changed("port") {
+		port = 5432
+	}
+	return server.NewDbCfg(dbDriver, dbUser, dbPass, dbHost, port, dbName, dbPath, dbSSLMode)
+}
 
+func quotaLimits() map[string]db.QuotaLimits {
+	return map[string]db.QuotaLimits{
+		db.TwitterProvider:      db.NewQuotaLimits(twitterDailyQuota, twitterMinuteQuota),
+		db.NewsProvider:         db.NewQuotaLimits(newsDailyQuota, newsMinuteQuota),
+		db.AlphaVantageProvider: db.NewQuotaLimits(stocksDailyQuota, stocksMinuteQuota),
+	}
 }
+
+// mailer prefers SMTP, emails are dropped to mail directory or only logged when it is not configured.
+func mailer() mail.Mailer {
+	if smtpHost != "" {
+		return mail.NewSMTPMailer(smtpHost, smtpPort, smtpUsername, smtpPassword, mailFrom)
+	}
+	if mailDir != "" {
+		return mail.NewFileMailer(mailDir, mailFrom)
+	}
+	return mail.NewLogMailer(mailLogBodies)
+}
+
+func retentionPolicy() db.RetentionPolicy {
+	return db.NewRetentionPolicy(rawRetentionDays, hourlyRetentionDays)
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		log.Error(fmt.Errorf("Execute failed on %v", err))
@@ -59,17 +154,46 @@ func init() {
 	rootCmd.MarkFlagRequired("news-api-key")
 	rootCmd.Flags().StringVarP(&stocksAPIKey, "stocks-api-key", "s", "", "Stocks API key.")
 	rootCmd.MarkFlagRequired("stocks-api-key")
-	rootCmd.Flags().StringVarP(&salt, "salt", "a", "", "Salt for encrypting users' passwords.")
-	rootCmd.MarkFlagRequired("salt")
-	rootCmd.Flags().StringVarP(&registrationCode, "registration-code", "r", "", "Registarion code to provide while registarion.")
-	rootCmd.MarkFlagRequired("registration-code")
-	rootCmd.Flags().StringVarP(&dbUser, "user", "u", "ta", "Sets user for database conneciton. Default value is ta.")
-	rootCmd.Flags().StringVarP(&dbPass, "pass", "p", "", "Sets password for database conneciton, required")
-	rootCmd.MarkFlagRequired("pass")
-	rootCmd.Flags().StringVarP(&dbHost, "host", "o", "localhost", "Sets host for database conneciton. Default value is localhost")
-	rootCmd.Flags().IntVarP(&dbPort, "port", "q", 3306, "Sets port for database conneciton. Default value is 3306")
-	rootCmd.Flags().StringVarP(&dbName, "name", "d", "trends", "Sets name for database conneciton. Default value is trends")
+	rootCmd.Flags().StringVarP(&salt, "salt", "a", "", "Legacy salt, needed only to verify SHA-1 passwords from before bcrypt, they are rehashed on login.")
+	rootCmd.Flags().StringVarP(&registrationCode, "registration-code", "r", "", "Legacy registration code shared by everyone, registration is possible only with invites when empty.")
+	rootCmd.Flags().StringVar(&tokenSecret, "token-secret", "", "Secret signing email verification and password reset tokens. Random one is generated on every start when empty.")
+	rootCmd.Flags().StringVar(&publicURL, "public-url", "http://localhost:8000", "Address of frontend linked in emails. Default value is http://localhost:8000.")
+	rootCmd.Flags().StringVar(&smtpHost, "smtp-host", "", "Sets SMTP server emails are sent with. Emails are dropped to mail directory or logged when empty.")
+	rootCmd.Flags().IntVar(&smtpPort, "smtp-port", 587, "Sets port of SMTP server. Default value is 587.")
+	rootCmd.Flags().StringVar(&smtpUsername, "smtp-username", "", "Sets username for SMTP server, authentication is skipped when empty.")
+	rootCmd.Flags().StringVar(&smtpPassword, "smtp-password", "", "Sets password for SMTP server.")
+	rootCmd.Flags().StringVar(&mailFrom, "mail-from", "trends-analyzer@localhost", "Sets sender of emails. Default value is trends-analyzer@localhost.")
+	rootCmd.Flags().StringVar(&mailDir, "mail-dir", "", "Directory emails are written to instead of being sent, meant for local testing.")
+	rootCmd.Flags().BoolVar(&mailLogBodies, "mail-log-bodies", false, "Logs bodies of emails, including verification and password reset links, when neither SMTP server nor mail directory is set, meant for local development.")
+	rootCmd.Flags().StringVar(&oidcIssuer, "oidc-issuer", "", "Issuer URL of OIDC provider users can sign in with. Single sign-on is disabled when empty.")
+	rootCmd.Flags().StringVar(&oidcClientID, "oidc-client-id", "", "Sets client ID registered at OIDC provider.")
+	rootCmd.Flags().StringVar(&oidcClientSecret, "oidc-client-secret", "", "Sets client secret registered at OIDC provider, public clients rely on PKCE only.")
+	rootCmd.Flags().StringVar(&oidcRedirectURL, "oidc-redirect-url", "", "Sets callback registered at OIDC provider. Default value is /api/oidc/callback under public URL.")
+	rootCmd.Flags().StringVar(&oidcDefaultRole, "oidc-default-role", db.DefaultRole, "Role of users provisioned on first single sign-on. Default value is viewer.")
+	rootCmd.PersistentFlags().StringVar(&dbDriver, "db-driver", "mysql", "Sets database driver: mysql, postgres, sqlite or memory. Default value is mysql.")
+	rootCmd.PersistentFlags().StringVar(&dbPath, "db-path", "trends.db", "Sets path of sqlite database file. Default value is trends.db")
+	rootCmd.PersistentFlags().StringVarP(&dbUser, "user", "u", "ta", "Sets user for database conneciton. Default value is ta.")
+	rootCmd.PersistentFlags().StringVarP(&dbPass, "pass", "p", "", "Sets password for database conneciton, required for mysql")
+	rootCmd.PersistentFlags().StringVarP(&dbHost, "host", "o", "localhost", "Sets host for database conneciton. Default value is localhost")
+	rootCmd.PersistentFlags().IntVarP(&dbPort, "port", "q", 3306, "Sets port for database conneciton. Default value is 3306, or 5432 for postgres")
+	rootCmd.PersistentFlags().StringVarP(&dbName, "name", "d", "trends", "Sets name for database conneciton. Default value is trends")
+	rootCmd.PersistentFlags().StringVar(&dbSSLMode, "db-sslmode", "disable", "Sets sslmode of postgres connection. Default value is disable")
 	rootCmd.Flags().BoolVarP(&readOnly, "read-only", "e", false, "Sets read only mode. Default value is false.")
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Sets logs to DEBUG level.")
+	rootCmd.Flags().BoolVar(&privateReads, "private-reads", false, "Requires authentication also on read endpoints. Default value is false.")
+	rootCmd.Flags().StringSliceVar(&trustedProxies, "trusted-proxies", []string{}, "Addresses or CIDR ranges of reverse proxies whose X-Forwarded-For and X-Real-IP headers tell client address, e.g. Traefik. Default value is none.")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Sets logs to DEBUG level.")
 	rootCmd.Flags().IntVarP(&dispatcherInterval, "dispatcher-interval", "b", 20, "Interval in minutes. Default value is 20.")
+	rootCmd.Flags().IntVarP(&minInterval, "min-interval", "i", 20, "Minimal interval in minutes between analyzes of volatile keyword, keywords can override it in their schedule. Default value is 20.")
+	rootCmd.Flags().IntVarP(&maxInterval, "max-interval", "x", 24*60, "Maximal interval in minutes between analyzes of flat keyword, keywords can override it in their schedule. Default value is 1440.")
+	rootCmd.PersistentFlags().IntVar(&rawRetentionDays, "raw-retention-days", 0, "Days raw analyzes and their texts are kept for before being downsampled to rollups. Default value is 0, which means forever.")
+	rootCmd.PersistentFlags().IntVar(&hourlyRetentionDays, "hourly-retention-days", 0, "Days hourly rollups are kept for, daily ones are kept forever. Default value is 0, which means forever.")
+	rootCmd.PersistentFlags().BoolVar(&retentionDryRun, "retention-dry-run", false, "Only reports what retention would remove. Default value is false.")
+	rootCmd.Flags().IntVar(&retentionInterval, "retention-interval", 60, "Interval in minutes between retention runs, 0 disables retention. Default value is 60.")
+	rootCmd.Flags().IntVar(&digestInterval, "digest-interval", 60, "Interval in minutes between checks for due email digests, 0 disables digests. Default value is 60.")
+	rootCmd.PersistentFlags().IntVar(&twitterDailyQuota, "twitter-daily-quota", 0, "Maximal amount of Twitter API calls per day. Default value is 0, which means no limit.")
+	rootCmd.PersistentFlags().IntVar(&twitterMinuteQuota, "twitter-minute-quota", 0, "Maximal amount of Twitter API calls per minute. Default value is 0, which means no limit.")
+	rootCmd.PersistentFlags().IntVar(&newsDailyQuota, "news-daily-quota", 0, "Maximal amount of News API calls per day. Default value is 0, which means no limit.")
+	rootCmd.PersistentFlags().IntVar(&newsMinuteQuota, "news-minute-quota", 0, "Maximal amount of News API calls per minute. Default value is 0, which means no limit.")
+	rootCmd.PersistentFlags().IntVar(&stocksDailyQuota, "stocks-daily-quota", 0, "Maximal amount of Alpha Vantage API calls per day. Default value is 0, which means no limit.")
+	rootCmd.PersistentFlags().IntVar(&stocksMinuteQuota, "stocks-minute-quota", 0, "Maximal amount of Alpha Vantage API calls per minute. Default value is 0, which means no limit.")
 }
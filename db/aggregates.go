@@ -0,0 +1,70 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	HourInterval  = "hour"
+	DayInterval   = "day"
+	WeekInterval  = "week"
+	MonthInterval = "month"
+	AvgAgg        = "avg"
+	MinAgg        = "min"
+	MaxAgg        = "max"
+	WeightedAgg   = "weighted"
+	StddevAgg     = "stddev"
+)
+
+func ValidInterval(interval string) bool {
+	return interval == HourInterval || interval == DayInterval || interval == WeekInterval || interval == MonthInterval
+}
+
+func ValidAgg(agg string) bool {
+	return agg == AvgAgg || agg == MinAgg || agg == MaxAgg || agg == WeightedAgg || agg == StddevAgg
+}
+
+// GetAggregatedAnalyzes rolls analyzes up into interval buckets, every returned Analyzis starts at its bucket.
+// Amounts of tweets and news are summed, reactions are aggregated with agg, weighted one uses amounts as weights.
+// Buckets are merged from hourly or daily rollups, so they cover whole hours or days.
+func (env Env) GetAggregatedAnalyzes(keywordName string, after, before time.Time, country, interval, agg string) ([]Analyzis, error) {
+	if !ValidInterval(interval) {
+		return nil, fmt.Errorf("Interval %v not supported", interval)
+	}
+	if !ValidAgg(agg) {
+		return nil, fmt.Errorf("Aggregation %v not supported", agg)
+	}
+	keywordID, err := env.GetKeywordID(keywordName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetKeywordID in GetAggregatedAnalyzes, %v", err)
+	}
+	rollupInterval := DayInterval
+	if interval == HourInterval {
+		rollupInterval = HourInterval
+	}
+	rollups, err := env.GetKeywordRollups(rollupInterval, keywordID, bucketStart(after, rollupInterval), before, country)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetKeywordRollups in GetAggregatedAnalyzes, %v", err)
+	}
+	analyzes := []Analyzis{}
+	for _, r := range mergeRollups(rollups, keywordID, country, interval) {
+		analyzes = append(analyzes, r.analyzis(agg))
+	}
+	return analyzes, nil
+}
+
+// bucketStart returns beginning of interval containing t, weeks start on Monday.
+func bucketStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case HourInterval:
+		return t.Truncate(time.Hour)
+	case WeekInterval:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case MonthInterval:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
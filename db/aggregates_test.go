@@ -0,0 +1,84 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	//Wednesday
+	ts := time.Date(2018, 3, 14, 15, 42, 10, 0, time.UTC)
+	expected := map[string]time.Time{
+		HourInterval:  time.Date(2018, 3, 14, 15, 0, 0, 0, time.UTC),
+		DayInterval:   time.Date(2018, 3, 14, 0, 0, 0, 0, time.UTC),
+		WeekInterval:  time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC),
+		MonthInterval: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for interval, e := range expected {
+		if b := bucketStart(ts, interval); !b.Equal(e) {
+			t.Fatalf("%v bucket of %v should be %v, got %v", interval, ts, e, b)
+		}
+	}
+	sunday := time.Date(2018, 3, 18, 23, 0, 0, 0, time.UTC)
+	if b := bucketStart(sunday, WeekInterval); !b.Equal(expected[WeekInterval]) {
+		t.Fatalf("Week of %v should start at %v, got %v", sunday, expected[WeekInterval], b)
+	}
+}
+
+func TestGetAggregatedAnalyzes(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateKeyword(NewKeyword("trend", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keywordID, err := env.GetKeywordID("trend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2018, 3, 14, 0, 0, 0, 0, time.UTC)
+	for _, a := range []Analyzis{
+		NewAnalyzis(keywordID, "pl", day.Add(time.Hour), 10, 0, 0.5, 0.5, 0),
+		NewAnalyzis(keywordID, "pl", day.Add(5*time.Hour), 30, 0, -0.5, -0.5, 0),
+		NewAnalyzis(keywordID, "pl", day.Add(26*time.Hour), 4, 4, 0.25, 0.5, 0),
+	} {
+		err := env.CreateAnalyzis(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string][]Analyzis{
+		AvgAgg:      {NewAnalyzis(keywordID, "any", day, 40, 0, 0, 0, 0), NewAnalyzis(keywordID, "any", day.Add(24*time.Hour), 4, 4, 0.25, 0.5, 0)},
+		MinAgg:      {NewAnalyzis(keywordID, "any", day, 40, 0, -0.5, -0.5, 0), NewAnalyzis(keywordID, "any", day.Add(24*time.Hour), 4, 4, 0.25, 0.5, 0)},
+		MaxAgg:      {NewAnalyzis(keywordID, "any", day, 40, 0, 0.5, 0.5, 0), NewAnalyzis(keywordID, "any", day.Add(24*time.Hour), 4, 4, 0.25, 0.5, 0)},
+		WeightedAgg: {NewAnalyzis(keywordID, "any", day, 40, 0, -0.25, -0.25, 0), NewAnalyzis(keywordID, "any", day.Add(24*time.Hour), 4, 4, 0.25, 0.5, 0)},
+	}
+	for agg, e := range expected {
+		analyzes, err := env.GetAggregatedAnalyzes("trend", day, day.Add(72*time.Hour), "any", DayInterval, agg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(analyzes) != len(e) {
+			t.Fatalf("Expected %v %v buckets, got %v", len(e), agg, analyzes)
+		}
+		for i := range e {
+			if !analyzisAlmostEqual(analyzes[i], e[i]) {
+				t.Fatalf("%v bucket %v is not equal to %v", agg, analyzes[i], e[i])
+			}
+		}
+	}
+	_, err = env.GetAggregatedAnalyzes("trend", day, day.Add(72*time.Hour), "any", "year", AvgAgg)
+	if err == nil {
+		t.Fatal("Unsupported interval should be rejected")
+	}
+	cleanUp()
+}
+
+func analyzisAlmostEqual(a, b Analyzis) bool {
+	const eps = 1e-5
+	return a.KeywordID == b.KeywordID && a.Country == b.Country && a.Timestamp.Equal(b.Timestamp) &&
+		a.AmountOfTweets == b.AmountOfTweets && a.AmountOfNews == b.AmountOfNews &&
+		math.Abs(float64(a.ReactionAvg-b.ReactionAvg)) < eps &&
+		math.Abs(float64(a.ReactionTweets-b.ReactionTweets)) < eps &&
+		math.Abs(float64(a.ReactionNews-b.ReactionNews)) < eps
+}
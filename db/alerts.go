@@ -0,0 +1,557 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ReactionBelowAlert = "reaction_below"
+	ReactionDropAlert  = "reaction_drop"
+	NewsSpikeAlert     = "news_spike"
+	JSONWebhook        = "json"
+	SlackWebhook       = "slack"
+	//AlertBaseline is period before analyzis which drop and spike rules compare it with
+	AlertBaseline          = 7 * 24 * time.Hour
+	AlertDeliveryRetention = 30 * 24 * time.Hour
+)
+
+var (
+	ErrAlertNotFound = errors.New("Alert rule not found")
+	ErrInvalidAlert  = errors.New("Alert rule is not valid")
+)
+
+// AlertRule posts to webhook when analyzis of keyword meets condition of its kind:
+// reaction_below when ReactionAvg is below threshold, reaction_drop when ReactionAvg is lower than baseline average by threshold
+// and news_spike when amount of news is threshold times baseline average.
+// Rule fires once condition starts to hold and is rearmed by first analyzis not meeting it, so lasting condition fires once.
+type AlertRule struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"-"`
+	KeywordID       int        `json:"keyword_id"`
+	Keyword         string     `json:"keyword"`
+	Kind            string     `json:"kind"`
+	Threshold       float32    `json:"threshold"`
+	Country         string     `json:"country"`
+	WebhookURL      string     `json:"webhook_url"`
+	WebhookFormat   string     `json:"webhook_format"`
+	Triggered       bool       `json:"triggered"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+}
+
+// Alert is fired rule with analyzis which met it, value compared and baseline it was compared with if any.
+type Alert struct {
+	Rule        AlertRule `json:"rule"`
+	Analyzis    Analyzis  `json:"analyzis"`
+	Value       float32   `json:"value"`
+	Baseline    *float32  `json:"baseline"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// AlertDelivery is entry of delivery log, status code is zero when webhook could not be reached.
+type AlertDelivery struct {
+	ID          int       `json:"id"`
+	RuleID      int       `json:"rule_id"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code"`
+	Error       string    `json:"error"`
+	Succeeded   bool      `json:"succeeded"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+func (r AlertRule) valid() bool {
+	switch r.Kind {
+	case ReactionBelowAlert:
+		if r.Threshold < -1 || r.Threshold > 1 {
+			return false
+		}
+	case ReactionDropAlert:
+		if r.Threshold <= 0 || r.Threshold > 2 {
+			return false
+		}
+	case NewsSpikeAlert:
+		if r.Threshold <= 1 {
+			return false
+		}
+	default:
+		return false
+	}
+	if r.WebhookFormat != JSONWebhook && r.WebhookFormat != SlackWebhook {
+		return false
+	}
+	return validWebhookURL(r.WebhookURL)
+}
+
+// validWebhookURL accepts http and https URLs of public hosts only, so rules cannot make server post to its own network.
+// Names are resolved again on delivery, which checks addresses they resolve to.
+func validWebhookURL(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		return IsPublicIP(ip)
+	}
+	//Single label names and reserved suffixes are resolved within local network
+	if !strings.Contains(host, ".") || host == "localhost" {
+		return false
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal", ".home.arpa"} {
+		if strings.HasSuffix(host, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonPublicNetworks are ranges not covered by net.IP methods used in IsPublicIP.
+var nonPublicNetworks = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+}
+
+// IsPublicIP tells whether ip is reachable over internet, loopback, private, link local and multicast addresses are not.
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateAlertRule adds rule of user on keyword named in rule, country defaults to any and webhook format to json.
+func (env Env) CreateAlertRule(username string, rule AlertRule) (AlertRule, error) {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return AlertRule{}, fmt.Errorf("Failed on call to getUserWithName in CreateAlertRule, %v", err)
+	}
+	keywordID, err := env.GetKeywordID(rule.Keyword)
+	if err != nil {
+		return AlertRule{}, ErrKeywordNotFound
+	}
+	if rule.Country == "" {
+		rule.Country = "any"
+	}
+	if rule.WebhookFormat == "" {
+		rule.WebhookFormat = JSONWebhook
+	}
+	if !rule.valid() {
+		return AlertRule{}, ErrInvalidAlert
+	}
+	rule.UserID, rule.KeywordID, rule.Triggered, rule.LastTriggeredAt = user.id, keywordID, false, nil
+	rule.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	err = env.insertAlertRule(rule)
+	if err != nil {
+		return AlertRule{}, fmt.Errorf("Failed on call to insertAlertRule in CreateAlertRule, %v", err)
+	}
+	rules, err := env.getUserAlertRules(user.id)
+	if err != nil || len(rules) == 0 {
+		return AlertRule{}, fmt.Errorf("Failed on call to getUserAlertRules in CreateAlertRule, %v", err)
+	}
+	created := rules[len(rules)-1]
+	created.Keyword = rule.Keyword
+	return created, nil
+}
+
+func (env Env) GetAlertRules(username string) ([]AlertRule, error) {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getUserWithName in GetAlertRules, %v", err)
+	}
+	rules, err := env.getUserAlertRules(user.id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getUserAlertRules in GetAlertRules, %v", err)
+	}
+	names, err := env.keywordNames()
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to keywordNames in GetAlertRules, %v", err)
+	}
+	for i := range rules {
+		rules[i].Keyword = names[rules[i].KeywordID]
+	}
+	return rules, nil
+}
+
+// DeleteAlertRule removes rule of user along with its delivery log.
+func (env Env) DeleteAlertRule(username string, id int) error {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return fmt.Errorf("Failed on call to getUserWithName in DeleteAlertRule, %v", err)
+	}
+	deleted, err := env.deleteAlertRule(user.id, id)
+	if err != nil {
+		return fmt.Errorf("Failed on call to deleteAlertRule in DeleteAlertRule, %v", err)
+	}
+	if deleted == 0 {
+		return ErrAlertNotFound
+	}
+	err = env.deleteAlertDeliveries(id)
+	if err != nil {
+		return fmt.Errorf("Failed on call to deleteAlertDeliveries in DeleteAlertRule, %v", err)
+	}
+	return nil
+}
+
+// GetAlertDeliveries lists delivery log of rule of user, newest first.
+func (env Env) GetAlertDeliveries(username string, ruleID, limit int) ([]AlertDelivery, error) {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getUserWithName in GetAlertDeliveries, %v", err)
+	}
+	rules, err := env.getUserAlertRules(user.id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getUserAlertRules in GetAlertDeliveries, %v", err)
+	}
+	for _, r := range rules {
+		if r.ID == ruleID {
+			return env.getAlertDeliveries(ruleID, limit)
+		}
+	}
+	return nil, ErrAlertNotFound
+}
+
+// LogAlertDelivery records attempt to deliver alert, entries older than AlertDeliveryRetention are pruned on the way.
+func (env Env) LogAlertDelivery(d AlertDelivery) error {
+	err := env.insertAlertDelivery(d)
+	if err != nil {
+		return fmt.Errorf("Failed on call to insertAlertDelivery in LogAlertDelivery, %v", err)
+	}
+	_, err = env.pruneAlertDeliveries(d.AttemptedAt.Add(-AlertDeliveryRetention))
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to pruneAlertDeliveries in LogAlertDelivery, %v", err))
+	}
+	return nil
+}
+
+// EvaluateAlerts checks rules on keyword of analyzis and returns ones which fired, it is meant to be called right after CreateAnalyzis.
+// Analyzis without texts says nothing about sentiment, so it leaves rules as they are.
+func (env Env) EvaluateAlerts(a Analyzis) ([]Alert, error) {
+	alerts := []Alert{}
+	if a.AmountOfTweets+a.AmountOfNews == 0 {
+		return alerts, nil
+	}
+	rules, err := env.getKeywordAlertRules(a.KeywordID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getKeywordAlertRules in EvaluateAlerts, %v", err)
+	}
+	if len(rules) == 0 {
+		return alerts, nil
+	}
+	names, err := env.keywordNames()
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to keywordNames in EvaluateAlerts, %v", err)
+	}
+	analyzes, err := env.GetKeywordAnalyzes(a.KeywordID, a.Timestamp.Add(-AlertBaseline), a.Timestamp, "any")
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetKeywordAnalyzes in EvaluateAlerts, %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, r := range rules {
+		if r.Country != "any" && r.Country != a.Country {
+			continue
+		}
+		previous := []Analyzis{}
+		for _, p := range analyzes {
+			if p.Timestamp.Before(a.Timestamp) && (r.Country == "any" || p.Country == r.Country) {
+				previous = append(previous, p)
+			}
+		}
+		holds, value, baseline := r.check(a, previous)
+		if holds == r.Triggered {
+			continue
+		}
+		lastTriggeredAt := r.LastTriggeredAt
+		if holds {
+			lastTriggeredAt = &now
+		}
+		err := env.setAlertRuleTriggered(r.ID, holds, lastTriggeredAt)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on call to setAlertRuleTriggered for %v in EvaluateAlerts, %v", r.ID, err)
+		}
+		if !holds {
+			continue
+		}
+		r.Keyword, r.Triggered, r.LastTriggeredAt = names[r.KeywordID], true, lastTriggeredAt
+		alerts = append(alerts, Alert{r, a, value, baseline, now})
+	}
+	return alerts, nil
+}
+
+// check reports whether analyzis meets rule, along with value and baseline compared.
+func (r AlertRule) check(a Analyzis, previous []Analyzis) (bool, float32, *float32) {
+	switch r.Kind {
+	case ReactionBelowAlert:
+		return a.ReactionAvg < r.Threshold, a.ReactionAvg, nil
+	case ReactionDropAlert:
+		//Baseline is weighted by amount of texts, like reaction of rollups
+		sum, texts := float32(0), 0
+		for _, p := range previous {
+			sum += p.ReactionAvg * float32(p.AmountOfTweets+p.AmountOfNews)
+			texts += p.AmountOfTweets + p.AmountOfNews
+		}
+		if texts == 0 {
+			return false, a.ReactionAvg, nil
+		}
+		baseline := sum / float32(texts)
+		return baseline-a.ReactionAvg >= r.Threshold, a.ReactionAvg, &baseline
+	case NewsSpikeAlert:
+		news := float32(a.AmountOfNews)
+		if len(previous) == 0 {
+			return false, news, nil
+		}
+		sum := 0
+		for _, p := range previous {
+			sum += p.AmountOfNews
+		}
+		baseline := float32(sum) / float32(len(previous))
+		return news > baseline && news >= r.Threshold*baseline, news, &baseline
+	}
+	return false, 0, nil
+}
+
+func (env Env) keywordNames() (map[int]string, error) {
+	keywords, err := env.GetKeywords()
+	if err != nil {
+		return nil, err
+	}
+	names := map[int]string{}
+	for _, k := range keywords {
+		names[k.ID] = k.Name
+	}
+	return names, nil
+}
+
+const alertRuleColumns = "id, user_id, keyword_id, kind, threshold, country, webhook_url, webhook_format, triggered, created_at, last_triggered_at"
+
+func (s sqlStore) insertAlertRule(r AlertRule) error {
+	_, err := s.exec("INSERT INTO alert_rules (user_id, keyword_id, kind, threshold, country, webhook_url, webhook_format, triggered, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.UserID, r.KeywordID, r.Kind, r.Threshold, r.Country, r.WebhookURL, r.WebhookFormat, r.Triggered, r.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting alert rule in insertAlertRule, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) getUserAlertRules(userID int) ([]AlertRule, error) {
+	return s.getAlertRules("SELECT "+alertRuleColumns+" FROM alert_rules WHERE user_id=? ORDER BY id", userID)
+}
+
+func (s sqlStore) getKeywordAlertRules(keywordID int) ([]AlertRule, error) {
+	return s.getAlertRules("SELECT "+alertRuleColumns+" FROM alert_rules WHERE keyword_id=? ORDER BY id", keywordID)
+}
+
+func (s sqlStore) getAlertRules(query string, args ...interface{}) ([]AlertRule, error) {
+	rules := []AlertRule{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting %v in getAlertRules, %v", query, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := AlertRule{}
+		lastTriggeredAt := sql.NullTime{}
+		if err := rows.Scan(&r.ID, &r.UserID, &r.KeywordID, &r.Kind, &r.Threshold, &r.Country, &r.WebhookURL, &r.WebhookFormat, &r.Triggered, &r.CreatedAt, &lastTriggeredAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getAlertRules on %v", err)
+		}
+		r.CreatedAt = r.CreatedAt.UTC()
+		if lastTriggeredAt.Valid {
+			t := lastTriggeredAt.Time.UTC()
+			r.LastTriggeredAt = &t
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (s sqlStore) setAlertRuleTriggered(id int, triggered bool, lastTriggeredAt *time.Time) error {
+	var at interface{}
+	if lastTriggeredAt != nil {
+		at = lastTriggeredAt.UTC()
+	}
+	_, err := s.exec("UPDATE alert_rules SET triggered=?, last_triggered_at=? WHERE id=?", triggered, at, id)
+	if err != nil {
+		return fmt.Errorf("Failed on updating alert rule %v in setAlertRuleTriggered, %v", id, err)
+	}
+	return nil
+}
+
+func (s sqlStore) deleteAlertRule(userID, id int) (int64, error) {
+	res, err := s.exec("DELETE FROM alert_rules WHERE user_id=? AND id=?", userID, id)
+	if err != nil {
+		return 0, fmt.Errorf("Failed on deleting alert rule %v in deleteAlertRule, %v", id, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to RowsAffected in deleteAlertRule, %v", err)
+	}
+	return deleted, nil
+}
+
+func (s sqlStore) insertAlertDelivery(d AlertDelivery) error {
+	_, err := s.exec("INSERT INTO alert_deliveries (rule_id, attempt, status_code, error, succeeded, attempted_at) VALUES (?, ?, ?, ?, ?, ?)",
+		d.RuleID, d.Attempt, d.StatusCode, d.Error, d.Succeeded, d.AttemptedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting alert delivery in insertAlertDelivery, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) getAlertDeliveries(ruleID, limit int) ([]AlertDelivery, error) {
+	query := "SELECT id, rule_id, attempt, status_code, error, succeeded, attempted_at FROM alert_deliveries WHERE rule_id=? ORDER BY attempted_at DESC, id DESC"
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+	deliveries := []AlertDelivery{}
+	rows, err := s.query(query, ruleID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting alert deliveries in getAlertDeliveries, %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := AlertDelivery{}
+		if err := rows.Scan(&d.ID, &d.RuleID, &d.Attempt, &d.StatusCode, &d.Error, &d.Succeeded, &d.AttemptedAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getAlertDeliveries on %v", err)
+		}
+		d.AttemptedAt = d.AttemptedAt.UTC()
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func (s sqlStore) deleteAlertDeliveries(ruleID int) error {
+	_, err := s.exec("DELETE FROM alert_deliveries WHERE rule_id=?", ruleID)
+	if err != nil {
+		return fmt.Errorf("Failed on deleting deliveries of alert rule %v in deleteAlertDeliveries, %v", ruleID, err)
+	}
+	return nil
+}
+
+func (s sqlStore) pruneAlertDeliveries(before time.Time) (int64, error) {
+	return s.prune("alert_deliveries", "attempted_at", before, false)
+}
+
+func (m *memoryStore) insertAlertRule(r AlertRule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastAlertRuleID++
+	r.ID = m.lastAlertRuleID
+	m.alertRules = append(m.alertRules, r)
+	return nil
+}
+
+func (m *memoryStore) getUserAlertRules(userID int) ([]AlertRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := []AlertRule{}
+	for _, r := range m.alertRules {
+		if r.UserID == userID {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+func (m *memoryStore) getKeywordAlertRules(keywordID int) ([]AlertRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := []AlertRule{}
+	for _, r := range m.alertRules {
+		if r.KeywordID == keywordID {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+func (m *memoryStore) setAlertRuleTriggered(id int, triggered bool, lastTriggeredAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.alertRules {
+		if m.alertRules[i].ID == id {
+			m.alertRules[i].Triggered = triggered
+			m.alertRules[i].LastTriggeredAt = lastTriggeredAt
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) deleteAlertRule(userID, id int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.alertRules {
+		if r.UserID == userID && r.ID == id {
+			m.alertRules = append(m.alertRules[:i], m.alertRules[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *memoryStore) insertAlertDelivery(d AlertDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastAlertDeliveryID++
+	d.ID = m.lastAlertDeliveryID
+	m.alertDeliveries = append(m.alertDeliveries, d)
+	return nil
+}
+
+func (m *memoryStore) getAlertDeliveries(ruleID, limit int) ([]AlertDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := []AlertDelivery{}
+	//Deliveries are appended in order of time
+	for i := len(m.alertDeliveries) - 1; i >= 0; i-- {
+		d := m.alertDeliveries[i]
+		if d.RuleID != ruleID {
+			continue
+		}
+		if limit > 0 && len(deliveries) == limit {
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func (m *memoryStore) deleteAlertDeliveries(ruleID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.alertDeliveries[:0]
+	for _, d := range m.alertDeliveries {
+		if d.RuleID != ruleID {
+			kept = append(kept, d)
+		}
+	}
+	m.alertDeliveries = kept
+	return nil
+}
+
+func (m *memoryStore) pruneAlertDeliveries(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.alertDeliveries[:0]
+	for _, d := range m.alertDeliveries {
+		if !d.AttemptedAt.Before(before) {
+			kept = append(kept, d)
+		}
+	}
+	deleted := int64(len(m.alertDeliveries) - len(kept))
+	m.alertDeliveries = kept
+	return deleted, nil
+}
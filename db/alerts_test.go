@@ -0,0 +1,187 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertRules(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc40", "abc40", "abc40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.CreateUser("abc41", "abc41", "abc41")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.CreateKeyword(NewKeyword("pge", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []AlertRule{
+		{Keyword: "missing", Kind: ReactionBelowAlert, WebhookURL: "https://hooks.example.com/a"},
+		{Keyword: "pge", Kind: "reaction_above", WebhookURL: "https://hooks.example.com/a"},
+		{Keyword: "pge", Kind: ReactionBelowAlert, Threshold: -2, WebhookURL: "https://hooks.example.com/a"},
+		{Keyword: "pge", Kind: NewsSpikeAlert, Threshold: 0.5, WebhookURL: "https://hooks.example.com/a"},
+		{Keyword: "pge", Kind: ReactionBelowAlert, WebhookURL: "file:///etc/passwd"},
+		{Keyword: "pge", Kind: ReactionBelowAlert, WebhookURL: "https://hooks.example.com/a", WebhookFormat: "xml"},
+	} {
+		if _, err := env.CreateAlertRule("abc40", r); err != ErrInvalidAlert && err != ErrKeywordNotFound {
+			t.Fatalf("Rule %v should not be created, got %v", r, err)
+		}
+	}
+	rule, err := env.CreateAlertRule("abc40", AlertRule{Keyword: "pge", Kind: ReactionDropAlert, Threshold: 0.2, WebhookURL: "https://hooks.example.com/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.ID == 0 || rule.Keyword != "pge" || rule.Country != "any" || rule.WebhookFormat != JSONWebhook || rule.Triggered {
+		t.Fatalf("Rule should be created with defaults, got %v", rule)
+	}
+	rules, err := env.GetAlertRules("abc40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].ID != rule.ID || rules[0].Keyword != "pge" {
+		t.Fatalf("Unexpected rules %v", rules)
+	}
+	if _, err := env.GetAlertDeliveries("abc41", rule.ID, 0); err != ErrAlertNotFound {
+		t.Fatalf("Deliveries of other user's rule should not be listed, got %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 1; i <= 3; i++ {
+		err = env.LogAlertDelivery(AlertDelivery{RuleID: rule.ID, Attempt: i, StatusCode: 500, AttemptedAt: now.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = env.LogAlertDelivery(AlertDelivery{RuleID: rule.ID, Attempt: 1, StatusCode: 200, Succeeded: true, AttemptedAt: now.Add(AlertDeliveryRetention + 2*time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := env.GetAlertDeliveries("abc40", rule.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || !deliveries[0].Succeeded || deliveries[1].Attempt != 3 {
+		t.Fatalf("Deliveries should be listed newest first, got %v", deliveries)
+	}
+	deliveries, err = env.GetAlertDeliveries("abc40", rule.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("Deliveries out of retention should be pruned, got %v", deliveries)
+	}
+	if err := env.DeleteAlertRule("abc41", rule.ID); err != ErrAlertNotFound {
+		t.Fatalf("Rule of other user should not be deleted, got %v", err)
+	}
+	err = env.DeleteAlertRule("abc40", rule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err = env.GetAlertRules("abc40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 0 {
+		t.Fatalf("Rule should be deleted, got %v", rules)
+	}
+}
+
+func TestEvaluateAlerts(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc42", "abc42", "abc42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.CreateKeyword(NewKeyword("pzu", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keywordID, err := env.GetKeywordID("pzu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []AlertRule{
+		{Keyword: "pzu", Kind: ReactionBelowAlert, Threshold: -0.3, WebhookURL: "https://hooks.example.com/a"},
+		{Keyword: "pzu", Kind: ReactionDropAlert, Threshold: 0.2, WebhookURL: "https://hooks.example.com/b", WebhookFormat: SlackWebhook},
+		{Keyword: "pzu", Kind: NewsSpikeAlert, Threshold: 3, Country: "pl", WebhookURL: "https://hooks.example.com/c"},
+	} {
+		if _, err := env.CreateAlertRule("abc42", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	evaluate := func(a Analyzis) []string {
+		err := env.CreateAnalyzis(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		alerts, err := env.EvaluateAlerts(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds := []string{}
+		for _, alert := range alerts {
+			if alert.Rule.Keyword != "pzu" || !alert.Rule.Triggered || alert.Rule.LastTriggeredAt == nil {
+				t.Fatalf("Fired rule should be marked as triggered, got %v", alert)
+			}
+			kinds = append(kinds, alert.Rule.Kind)
+		}
+		return kinds
+	}
+	if kinds := evaluate(NewAnalyzis(keywordID, "pl", now.Add(-48*time.Hour), 10, 2, 0.1, 0.1, 0.1)); len(kinds) != 0 {
+		t.Fatalf("Rules without baseline should not fire, got %v", kinds)
+	}
+	if kinds := evaluate(NewAnalyzis(keywordID, "pl", now.Add(-24*time.Hour), 0, 0, -1, 0, 0)); len(kinds) != 0 {
+		t.Fatalf("Analyzis without texts should not fire, got %v", kinds)
+	}
+	if kinds := evaluate(NewAnalyzis(keywordID, "us", now.Add(-2*time.Hour), 20, 20, 0, 0, 0)); len(kinds) != 0 {
+		t.Fatalf("Small moves should not fire, got %v", kinds)
+	}
+	kinds := evaluate(NewAnalyzis(keywordID, "pl", now.Add(-time.Hour), 10, 8, -0.4, -0.4, -0.4))
+	if len(kinds) != 3 || kinds[0] != ReactionBelowAlert || kinds[1] != ReactionDropAlert || kinds[2] != NewsSpikeAlert {
+		t.Fatalf("All rules should fire, got %v", kinds)
+	}
+	if kinds := evaluate(NewAnalyzis(keywordID, "pl", now, 10, 2, -0.5, -0.5, -0.5)); len(kinds) != 0 {
+		t.Fatalf("Triggered rules should not fire again, got %v", kinds)
+	}
+	if kinds := evaluate(NewAnalyzis(keywordID, "pl", now.Add(time.Hour), 10, 2, 0.5, 0.5, 0.5)); len(kinds) != 0 {
+		t.Fatalf("Rearming rules should not fire, got %v", kinds)
+	}
+	kinds = evaluate(NewAnalyzis(keywordID, "pl", now.Add(2*time.Hour), 10, 2, -0.35, -0.35, -0.35))
+	if len(kinds) != 2 || kinds[0] != ReactionBelowAlert || kinds[1] != ReactionDropAlert {
+		t.Fatalf("Rearmed reaction rules should fire, got %v", kinds)
+	}
+}
+
+func TestValidWebhookURL(t *testing.T) {
+	for url, valid := range map[string]bool{
+		"https://hooks.example.com/a":             true,
+		"http://203.0.113.10:8080/hook":           true,
+		"https://[2001:4860:4860::8888]/hook":     true,
+		"ftp://hooks.example.com/a":               false,
+		"https:///a":                              false,
+		"http://localhost:8000/api/analyze":       false,
+		"http://LOCALHOST./a":                     false,
+		"http://api.localhost/a":                  false,
+		"http://metadata/computeMetadata":         false,
+		"http://printer.local/a":                  false,
+		"http://metadata.google.internal/a":       false,
+		"http://127.0.0.1:8000/api/analyze":       false,
+		"http://10.1.2.3/a":                       false,
+		"http://192.168.0.1/a":                    false,
+		"http://169.254.169.254/latest/meta-data": false,
+		"http://100.64.0.1/a":                     false,
+		"http://0.0.0.0:8000/a":                   false,
+		"http://[::1]/a":                          false,
+		"http://[fd00::1]/a":                      false,
+		"http://[fe80::1]/a":                      false,
+		"http://[::ffff:127.0.0.1]/a":             false,
+	} {
+		if validWebhookURL(url) != valid {
+			t.Fatalf("Webhook %v should be valid: %v", url, valid)
+		}
+	}
+}
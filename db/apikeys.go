@@ -0,0 +1,287 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so it can be told apart from session token.
+const (
+	APIKeyPrefix = "ta_"
+	//apiKeyShownLength is length of beginning of key stored in plain to recognize it on listing
+	apiKeyShownLength = 10
+	maxAPIKeyName     = 64
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidScope   = errors.New("Scope not granted by role")
+	ErrInvalidAPIKey  = errors.New("API key name is not valid")
+)
+
+// APIKey lets scripts act as user, limited to its scopes and permissions of user role.
+type APIKey struct {
+	ID         int          `json:"id"`
+	UserID     int          `json:"-"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	Scopes     []Permission `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+}
+
+// Allows reports whether key was granted permission, permissions of user role are checked separately.
+func (k APIKey) Allows(permission Permission) bool {
+	for _, s := range k.Scopes {
+		if s == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKey returns new key of user, only its hash is stored so it cannot be shown again.
+func (env Env) CreateAPIKey(username, name string, scopes []Permission) (string, APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyName {
+		return "", APIKey{}, ErrInvalidAPIKey
+	}
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return "", APIKey{}, fmt.Errorf("Failed on call to getUserWithName in CreateAPIKey, %v", err)
+	}
+	if len(scopes) == 0 {
+		return "", APIKey{}, ErrInvalidScope
+	}
+	for _, s := range scopes {
+		if !RoleHasPermission(user.role, s) {
+			return "", APIKey{}, ErrInvalidScope
+		}
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", APIKey{}, fmt.Errorf("Failed on call to newToken in CreateAPIKey, %v", err)
+	}
+	key := APIKeyPrefix + token
+	apiKey := APIKey{UserID: user.id, Name: name, Prefix: key[:apiKeyShownLength], Scopes: scopes, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	err = env.insertAPIKey(apiKey, hashToken(key))
+	if err != nil {
+		return "", APIKey{}, fmt.Errorf("Failed on call to insertAPIKey in CreateAPIKey, %v", err)
+	}
+	keys, err := env.getAPIKeysWithHash(hashToken(key))
+	if err != nil || len(keys) != 1 {
+		return "", APIKey{}, fmt.Errorf("Failed on call to getAPIKeysWithHash in CreateAPIKey, %v", err)
+	}
+	return key, keys[0], nil
+}
+
+func (env Env) GetAPIKeys(username string) ([]APIKey, error) {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getUserWithName in GetAPIKeys, %v", err)
+	}
+	return env.getUserAPIKeys(user.id)
+}
+
+func (env Env) RevokeAPIKey(username string, id int) error {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return fmt.Errorf("Failed on call to getUserWithName in RevokeAPIKey, %v", err)
+	}
+	deleted, err := env.deleteAPIKey(user.id, id)
+	if err != nil {
+		return fmt.Errorf("Failed on call to deleteAPIKey in RevokeAPIKey, %v", err)
+	}
+	if deleted == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns owner of key and records its use.
+func (env Env) AuthenticateAPIKey(key string) (UserInfo, APIKey, error) {
+	keys, err := env.getAPIKeysWithHash(hashToken(key))
+	if err != nil {
+		return UserInfo{}, APIKey{}, fmt.Errorf("Failed on call to getAPIKeysWithHash in AuthenticateAPIKey, %v", err)
+	}
+	if len(keys) != 1 {
+		return UserInfo{}, APIKey{}, ErrAPIKeyNotFound
+	}
+	apiKey := keys[0]
+	users, err := env.getUsersWithID(apiKey.UserID)
+	if err != nil {
+		return UserInfo{}, APIKey{}, fmt.Errorf("Failed on call to getUsersWithID in AuthenticateAPIKey, %v", err)
+	}
+	if len(users) != 1 {
+		return UserInfo{}, APIKey{}, ErrAPIKeyNotFound
+	}
+	now := time.Now().UTC()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= sessionTouchInterval {
+		now = now.Truncate(time.Second)
+		apiKey.LastUsedAt = &now
+		err = env.touchAPIKey(apiKey.ID, now)
+		if err != nil {
+			return UserInfo{}, APIKey{}, fmt.Errorf("Failed on call to touchAPIKey in AuthenticateAPIKey, %v", err)
+		}
+	}
+	return users[0].info(), apiKey, nil
+}
+
+func joinScopes(scopes []Permission) string {
+	s := []string{}
+	for _, p := range scopes {
+		s = append(s, string(p))
+	}
+	return strings.Join(s, ",")
+}
+
+func splitScopes(scopes string) []Permission {
+	permissions := []Permission{}
+	for _, s := range strings.Split(scopes, ",") {
+		if s != "" {
+			permissions = append(permissions, Permission(s))
+		}
+	}
+	return permissions
+}
+
+func (s sqlStore) insertAPIKey(k APIKey, keyHash string) error {
+	_, err := s.exec("INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?, ?)", k.UserID, k.Name, k.Prefix, keyHash, joinScopes(k.Scopes), k.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting API key in insertAPIKey, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) getAPIKeysWithHash(keyHash string) ([]APIKey, error) {
+	return s.getAPIKeys("SELECT id, user_id, name, prefix, scopes, created_at, last_used_at FROM api_keys WHERE key_hash=?", keyHash)
+}
+
+func (s sqlStore) getUserAPIKeys(userID int) ([]APIKey, error) {
+	return s.getAPIKeys("SELECT id, user_id, name, prefix, scopes, created_at, last_used_at FROM api_keys WHERE user_id=? ORDER BY id", userID)
+}
+
+func (s sqlStore) getAPIKeys(query string, args ...interface{}) ([]APIKey, error) {
+	keys := []APIKey{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting %v in getAPIKeys, %v", query, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		k := APIKey{}
+		scopes := ""
+		lastUsedAt := sql.NullTime{}
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &scopes, &k.CreatedAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getAPIKeys on %v", err)
+		}
+		k.Scopes = splitScopes(scopes)
+		k.CreatedAt = k.CreatedAt.UTC()
+		if lastUsedAt.Valid {
+			t := lastUsedAt.Time.UTC()
+			k.LastUsedAt = &t
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (s sqlStore) touchAPIKey(id int, lastUsedAt time.Time) error {
+	_, err := s.exec("UPDATE api_keys SET last_used_at=? WHERE id=?", lastUsedAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("Failed on updating API key %v in touchAPIKey, %v", id, err)
+	}
+	return nil
+}
+
+func (s sqlStore) deleteAPIKey(userID, id int) (int64, error) {
+	res, err := s.exec("DELETE FROM api_keys WHERE user_id=? AND id=?", userID, id)
+	if err != nil {
+		return 0, fmt.Errorf("Failed on deleting API key %v in deleteAPIKey, %v", id, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to RowsAffected in deleteAPIKey, %v", err)
+	}
+	return deleted, nil
+}
+
+func (s sqlStore) deleteUserAPIKeys(userID int) error {
+	_, err := s.exec("DELETE FROM api_keys WHERE user_id=?", userID)
+	if err != nil {
+		return fmt.Errorf("Failed on deleting API keys of user %v in deleteUserAPIKeys, %v", userID, err)
+	}
+	return nil
+}
+
+func (m *memoryStore) insertAPIKey(k APIKey, keyHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastAPIKeyID++
+	k.ID = m.lastAPIKeyID
+	m.apiKeys = append(m.apiKeys, storedAPIKey{k, keyHash})
+	return nil
+}
+
+func (m *memoryStore) getAPIKeysWithHash(keyHash string) ([]APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []APIKey{}
+	for _, k := range m.apiKeys {
+		if k.keyHash == keyHash {
+			keys = append(keys, k.APIKey)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryStore) getUserAPIKeys(userID int) ([]APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []APIKey{}
+	for _, k := range m.apiKeys {
+		if k.UserID == userID {
+			keys = append(keys, k.APIKey)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryStore) touchAPIKey(id int, lastUsedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID == id {
+			m.apiKeys[i].LastUsedAt = &lastUsedAt
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) deleteAPIKey(userID, id int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, k := range m.apiKeys {
+		if k.UserID == userID && k.ID == id {
+			m.apiKeys = append(m.apiKeys[:i], m.apiKeys[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *memoryStore) deleteUserAPIKeys(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.apiKeys[:0]
+	for _, k := range m.apiKeys {
+		if k.UserID != userID {
+			kept = append(kept, k)
+		}
+	}
+	m.apiKeys = kept
+	return nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	env := setupEnv()
+	for _, name := range []string{"abc20", "abc21"} {
+		err := env.CreateUser(name, name, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := env.CreateAPIKey("abc21", "script", []Permission{AnalyzePermission})
+	if err != ErrInvalidScope {
+		t.Fatalf("Viewer should not get analyze scope, got %v", err)
+	}
+	_, _, err = env.CreateAPIKey("abc20", " ", []Permission{ReadPermission})
+	if err != ErrInvalidAPIKey {
+		t.Fatalf("Key without name should fail with ErrInvalidAPIKey, got %v", err)
+	}
+	key, apiKey, err := env.CreateAPIKey("abc20", "script", []Permission{ReadPermission, AnalyzePermission})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) || !strings.HasPrefix(key, apiKey.Prefix) || apiKey.LastUsedAt != nil {
+		t.Fatalf("Unexpected key %v of %v", key, apiKey)
+	}
+	user, used, err := env.AuthenticateAPIKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "abc20" || used.LastUsedAt == nil || !used.Allows(AnalyzePermission) || used.Allows(ManageUsersPermission) {
+		t.Fatalf("Unexpected user %v of key %v", user, used)
+	}
+	keys, err := env.GetAPIKeys("abc20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Name != "script" || keys[0].LastUsedAt == nil || len(keys[0].Scopes) != 2 {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+	err = env.RevokeAPIKey("abc21", apiKey.ID)
+	if err != ErrAPIKeyNotFound {
+		t.Fatalf("Key should be revoked only by its owner, got %v", err)
+	}
+	err = env.RevokeAPIKey("abc20", apiKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = env.AuthenticateAPIKey(key)
+	if err != ErrAPIKeyNotFound {
+		t.Fatalf("Revoked key should not authenticate, got %v", err)
+	}
+}
@@ -1,27 +1,28 @@
 package db
 
 import (
-	"database/sql"
-	"errors"
 	"fmt"
+	"sort"
 	"time"
 
-	//import mysql driver
-	_ "github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
 )
 
 type Env struct {
-	db               *sql.DB
-	TwitterAPIKey    string
-	NewsAPIKey       string
-	StocksAPIKey     string
+	Store
+	TwitterAPIKey string
+	NewsAPIKey    string
+	StocksAPIKey  string
+	//salt verifies legacy SHA-1 hashes only, bcrypt salts every hash itself
 	salt             string
 	RegistrationCode string
+	quotas           map[string]QuotaLimits
+	//tokenSecret signs email verification and password reset tokens
+	tokenSecret []byte
 }
 
-func NewEnv(db *sql.DB, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode string) Env {
-	return Env{db, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode}
+func NewEnv(store Store, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode string, quotas map[string]QuotaLimits, tokenSecret string) Env {
+	return Env{store, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode, quotas, []byte(tokenSecret)}
 }
 
 type Analyzis struct {
@@ -44,60 +45,11 @@ type Keyword struct {
 	Name           string `json:"name"`
 	Provider       string `json:"provider"`
 	AdditionalInfo string `json:"additional_info"`
+	Status         string `json:"status"`
 }
 
 func NewKeyword(name, provider, additionalInfo string) Keyword {
-	return Keyword{0, name, provider, additionalInfo}
-}
-func InitDb(db_connection string) (*sql.DB, error) {
-	db, err := sql.Open("mysql",
-		db_connection+"?parseTime=true")
-
-	if err != nil {
-		return nil, fmt.Errorf("Failed on openning mysql connection in InitDb, %v", err)
-	}
-	createAnalyzes := `
-          CREATE TABLE IF NOT EXISTS analyzes (
-          id SERIAL NOT NULL PRIMARY KEY,
-          keyword_id INT NOT NULL,
-          country TEXT NOT NULL,
-          timestamp DATETIME NOT NULL,
-          amount_of_tweets INT NOT NULL,
-          amount_of_news INT NOT NULL,
-          reaction_avg FLOAT NOT NULL,
-          reaction_tweets FLOAT NOT NULL,
-          reaction_news FLOAT NOT NULL);
-        `
-	_, err = db.Exec(createAnalyzes)
-	if err != nil {
-		return nil, fmt.Errorf("Failed on executing creation of analyzes table, %v", err)
-	}
-	createKeywords := `
-          CREATE TABLE IF NOT EXISTS keywords (
-          id SERIAL NOT NULL PRIMARY KEY,
-          name TEXT NOT NULL,
-          provider TEXT NOT NULL,
-          additional_info TEXT NOT NULL);
-        `
-	_, err = db.Exec(createKeywords)
-	if err != nil {
-		return nil, fmt.Errorf("Failed on executing creation of keywords table, %v", err)
-	}
-
-	createUsers := `
-          CREATE TABLE IF NOT EXISTS users (
-          id SERIAL NOT NULL PRIMARY KEY,
-          username TEXT NOT NULL,
-          email TEXT NOT NULL,
-          hash TEXT NOT NULL,
-          token TEXT NOT NULL);
-        `
-	_, err = db.Exec(createUsers)
-	if err != nil {
-		return nil, fmt.Errorf("Failed on executing creation of users table, %v", err)
-	}
-
-	return db, nil
+	return Keyword{0, name, provider, additionalInfo, KeywordActive}
 }
 
 func (env Env) CreateKeyword(keyword Keyword) error {
@@ -106,11 +58,11 @@ func (env Env) CreateKeyword(keyword Keyword) error {
 		return fmt.Errorf("Failed on call to KeywordIsPresent in CreateKeyword, %v", err)
 	}
 	if tPresent {
-		return errors.New("Keyword already present")
+		return ErrKeywordExists
 	}
-	_, err = env.db.Exec("INSERT INTO keywords (name, provider, additional_info) VALUES (?, ?, ?)", keyword.Name, keyword.Provider, keyword.AdditionalInfo)
+	err = env.InsertKeyword(keyword)
 	if err != nil {
-		return fmt.Errorf("Failed on insertion to keywords in CreateKeyword, %v", err)
+		return fmt.Errorf("Failed on call to InsertKeyword in CreateKeyword, %v", err)
 	}
 	log.Debug("Keyword " + keyword.Name + " inserted")
 	return nil
@@ -138,29 +90,56 @@ func (env Env) GetKeywordID(name string) (int, error) {
 		return -1, fmt.Errorf("Failed on call to GetKeywordsWithName in GetKeywordID, %v", err)
 	}
 	if len(keywords) != 1 {
-		return -1, errors.New("Keyword does not exist")
+		return -1, ErrKeywordNotFound
 	}
 	return keywords[0].ID, nil
 
 }
-func (env Env) GetKeywordsWithName(name string) ([]Keyword, error) {
-	return env.getKeywords("SELECT * FROM keywords where name=?", name)
+func (env Env) KeywordIsPresent(name string) (bool, error) {
+	keywords, err := env.GetKeywordsWithName(name)
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to GetKeywordsWithName in KeywordIsPresent, %v", err)
+	}
+	if len(keywords) != 0 {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (env Env) GetAnalyzes(keywordName string, after, before time.Time, country string) ([]Analyzis, error) {
+	keywordID, err := env.GetKeywordID(keywordName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetKeywordID in GetAnalyzes, %v", err)
+	}
+	return env.GetKeywordAnalyzes(keywordID, after, before, country)
+}
+
+func (s sqlStore) InsertKeyword(keyword Keyword) error {
+	_, err := s.exec("INSERT INTO keywords (name, provider, additional_info, status) VALUES (?, ?, ?, ?)", keyword.Name, keyword.Provider, keyword.AdditionalInfo, keyword.Status)
+	if err != nil {
+		return fmt.Errorf("Failed on insertion to keywords in InsertKeyword, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) GetKeywordsWithName(name string) ([]Keyword, error) {
+	return s.getKeywords("SELECT id, name, provider, additional_info, status FROM keywords where name=?", name)
 }
 
-func (env Env) GetKeywords() ([]Keyword, error) {
-	return env.getKeywords("SELECT * FROM keywords")
+func (s sqlStore) GetKeywords() ([]Keyword, error) {
+	return s.getKeywords("SELECT id, name, provider, additional_info, status FROM keywords")
 }
 
-func (env Env) getKeywords(query string, args ...interface{}) ([]Keyword, error) {
+func (s sqlStore) getKeywords(query string, args ...interface{}) ([]Keyword, error) {
 	keywords := []Keyword{}
-	rows, err := env.db.Query(query, args...)
+	rows, err := s.query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed on selecting %v with %v in getKeywords, %v", query, args, err)
 	}
 	defer rows.Close()
 	for i := 0; rows.Next(); i++ {
 		keyword := Keyword{}
-		if err := rows.Scan(&keyword.ID, &keyword.Name, &keyword.Provider, &keyword.AdditionalInfo); err != nil {
+		if err := rows.Scan(&keyword.ID, &keyword.Name, &keyword.Provider, &keyword.AdditionalInfo, &keyword.Status); err != nil {
 			return nil, fmt.Errorf("Rows scan failed in getKeywords on %v", err)
 		}
 		keywords = append(keywords, keyword)
@@ -169,29 +148,42 @@ func (env Env) getKeywords(query string, args ...interface{}) ([]Keyword, error)
 	return keywords, nil
 }
 
-func (env Env) KeywordIsPresent(name string) (bool, error) {
-	keywords, err := env.GetKeywordsWithName(name)
-	if err != nil {
-		return false, fmt.Errorf("Failed on call to GetKeywordsWithName in KeywordIsPresent, %v", err)
-	}
-	if len(keywords) != 0 {
-		return true, nil
+// CreateAnalyzis stores analyzis and merges it into its rollups in one transaction, so rollups never drift from analyzes.
+// Transaction is retried once, postgres aborts it when rollup of the same period is inserted concurrently.
+func (s sqlStore) CreateAnalyzis(a Analyzis) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		err = s.inTx(func(tx sqlStore) error {
+			_, err := tx.exec("INSERT INTO analyzes (keyword_id, country, timestamp, amount_of_tweets, amount_of_news, reaction_avg, reaction_tweets, reaction_news) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", a.KeywordID, a.Country, a.Timestamp.UTC(), a.AmountOfTweets, a.AmountOfNews, a.ReactionAvg, a.ReactionTweets, a.ReactionNews)
+			if err != nil {
+				return fmt.Errorf("Failed on inserting analyzis in CreateAnalyzis, %v", err)
+			}
+			for _, interval := range rollupIntervals {
+				err := tx.mergeRollup(interval, newRollup(a, interval))
+				if err != nil {
+					return fmt.Errorf("Failed on call to mergeRollup in CreateAnalyzis, %v", err)
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			log.Debug(a)
+			return nil
+		}
 	}
-	return false, nil
+	return err
 }
 
-func (env Env) CreateAnalyzis(a Analyzis) error {
-	_, err := env.db.Exec("INSERT INTO analyzes (keyword_id, country, timestamp, amount_of_tweets, amount_of_news, reaction_avg, reaction_tweets, reaction_news) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", a.KeywordID, a.Country, a.Timestamp, a.AmountOfTweets, a.AmountOfNews, a.ReactionAvg, a.ReactionTweets, a.ReactionNews)
-	if err != nil {
-		return fmt.Errorf("Failed on inserting analyzis in CreateAnalyzis, %v", err)
+func (s sqlStore) GetKeywordAnalyzes(keywordID int, after, before time.Time, country string) ([]Analyzis, error) {
+	if country == "any" {
+		return s.getAnalyzes("SELECT keyword_id, country, timestamp, amount_of_tweets, amount_of_news, reaction_avg, reaction_tweets, reaction_news FROM analyzes WHERE keyword_id=? AND timestamp >=? AND timestamp <=? ORDER BY timestamp", keywordID, after.UTC(), before.UTC())
 	}
-	log.Debug(a)
-	return nil
+	return s.getAnalyzes("SELECT keyword_id, country, timestamp, amount_of_tweets, amount_of_news, reaction_avg, reaction_tweets, reaction_news FROM analyzes WHERE keyword_id=? AND timestamp >=? AND timestamp <=? AND country=? ORDER BY timestamp", keywordID, after.UTC(), before.UTC(), country)
 }
 
-func (env Env) getAnalyzes(query string, args ...interface{}) ([]Analyzis, error) {
+func (s sqlStore) getAnalyzes(query string, args ...interface{}) ([]Analyzis, error) {
 	analyzes := []Analyzis{}
-	rows, err := env.db.Query(query, args...)
+	rows, err := s.query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed on selecting %v with %v in getAnalyzes, %v", query, args, err)
 	}
@@ -201,20 +193,63 @@ func (env Env) getAnalyzes(query string, args ...interface{}) ([]Analyzis, error
 		if err := rows.Scan(&a.KeywordID, &a.Country, &a.Timestamp, &a.AmountOfTweets, &a.AmountOfNews, &a.ReactionAvg, &a.ReactionTweets, &a.ReactionNews); err != nil {
 			return nil, fmt.Errorf("Rows scan failed in getAnalyzes on %v", err)
 		}
+		a.Timestamp = a.Timestamp.UTC()
 		analyzes = append(analyzes, a)
 	}
 	log.Debug(analyzes)
 	return analyzes, nil
 }
 
-func (env Env) GetAnalyzes(keywordName string, after, before time.Time, country string) ([]Analyzis, error) {
-	keywordID, err := env.GetKeywordID(keywordName)
-	if err != nil {
-		return nil, fmt.Errorf("Failed on call to GetKeywordID in GetAnalyzes, %v", err)
+func (m *memoryStore) InsertKeyword(keyword Keyword) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keyword.ID = len(m.keywords) + 1
+	m.keywords = append(m.keywords, keyword)
+	return nil
+}
+
+func (m *memoryStore) GetKeywordsWithName(name string) ([]Keyword, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keywords := []Keyword{}
+	for _, k := range m.keywords {
+		if k.Name == name {
+			keywords = append(keywords, k)
+		}
 	}
-	if country == "any" {
-		return env.getAnalyzes("SELECT keyword_id, country, timestamp, amount_of_tweets, amount_of_news, reaction_avg, reaction_tweets, reaction_news FROM analyzes WHERE keyword_id=? AND timestamp >=? AND timestamp <=?", keywordID, after, before)
+	return keywords, nil
+}
+
+func (m *memoryStore) GetKeywords() ([]Keyword, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Keyword{}, m.keywords...), nil
+}
+
+func (m *memoryStore) CreateAnalyzis(a Analyzis) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.analyzes = append(m.analyzes, a)
+	for _, interval := range rollupIntervals {
+		m.mergeRollupLocked(interval, newRollup(a, interval))
 	}
-	return env.getAnalyzes("SELECT keyword_id, country, timestamp, amount_of_tweets, amount_of_news, reaction_avg, reaction_tweets, reaction_news FROM analyzes WHERE keyword_id=? AND timestamp >=? AND timestamp <=? AND country=?", keywordID, after, before, country)
+	log.Debug(a)
+	return nil
+}
 
+func (m *memoryStore) GetKeywordAnalyzes(keywordID int, after, before time.Time, country string) ([]Analyzis, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	analyzes := []Analyzis{}
+	for _, a := range m.analyzes {
+		if a.KeywordID != keywordID || a.Timestamp.Before(after) || a.Timestamp.After(before) {
+			continue
+		}
+		if country != "any" && a.Country != country {
+			continue
+		}
+		analyzes = append(analyzes, a)
+	}
+	sort.SliceStable(analyzes, func(i, j int) bool { return analyzes[i].Timestamp.Before(analyzes[j].Timestamp) })
+	return analyzes, nil
 }
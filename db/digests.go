@@ -0,0 +1,346 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DailyDigest  = "daily"
+	WeeklyDigest = "weekly"
+	//DigestTopTexts is how many of the most positive and of the most negative texts digest shows for each keyword
+	DigestTopTexts = 3
+)
+
+var ErrInvalidDigest = errors.New("Digest frequency not supported")
+
+// DigestSettings tell how often user gets digest of watchlist, frequency is empty when user is not subscribed.
+type DigestSettings struct {
+	Frequency  string     `json:"frequency"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+}
+
+type digestSubscription struct {
+	userID     int
+	frequency  string
+	lastSentAt *time.Time
+}
+
+// Digest summarizes keywords followed by user over last day or week, from To back to From.
+type Digest struct {
+	User      UserInfo
+	Frequency string
+	From      time.Time
+	To        time.Time
+	Keywords  []DigestKeyword
+	//lastSentAt is when the previous digest was sent, it is restored when this one fails to be sent
+	lastSentAt *time.Time
+}
+
+type DigestKeyword struct {
+	WatchlistEntry
+	Positive []Text
+	Negative []Text
+}
+
+// digestPeriod maps frequency to watchlist period and its length.
+func digestPeriod(frequency string) (string, time.Duration, error) {
+	switch frequency {
+	case DailyDigest:
+		return DayInterval, 24 * time.Hour, nil
+	case WeeklyDigest:
+		return WeekInterval, 7 * 24 * time.Hour, nil
+	}
+	return "", 0, ErrInvalidDigest
+}
+
+func (env Env) GetDigestSettings(username string) (DigestSettings, error) {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return DigestSettings{}, fmt.Errorf("Failed on call to getUserWithName in GetDigestSettings, %v", err)
+	}
+	subscriptions, err := env.getUserDigestSubscriptions(user.id)
+	if err != nil {
+		return DigestSettings{}, fmt.Errorf("Failed on call to getUserDigestSubscriptions in GetDigestSettings, %v", err)
+	}
+	if len(subscriptions) == 0 {
+		return DigestSettings{}, nil
+	}
+	return DigestSettings{subscriptions[0].frequency, subscriptions[0].lastSentAt}, nil
+}
+
+// SetDigestFrequency subscribes user to daily or weekly digest, empty frequency unsubscribes.
+// New subscriber gets first digest once the current day or week is over.
+func (env Env) SetDigestFrequency(username, frequency string) (DigestSettings, error) {
+	if frequency != "" {
+		if _, _, err := digestPeriod(frequency); err != nil {
+			return DigestSettings{}, err
+		}
+	}
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return DigestSettings{}, fmt.Errorf("Failed on call to getUserWithName in SetDigestFrequency, %v", err)
+	}
+	subscriptions, err := env.getUserDigestSubscriptions(user.id)
+	if err != nil {
+		return DigestSettings{}, fmt.Errorf("Failed on call to getUserDigestSubscriptions in SetDigestFrequency, %v", err)
+	}
+	switch {
+	case frequency == "":
+		err = env.deleteDigestSubscription(user.id)
+	case len(subscriptions) == 0:
+		now := time.Now().UTC().Truncate(time.Second)
+		err = env.insertDigestSubscription(digestSubscription{user.id, frequency, &now})
+	default:
+		err = env.setDigestFrequency(user.id, frequency)
+	}
+	if err != nil {
+		return DigestSettings{}, fmt.Errorf("Failed on storing digest subscription in SetDigestFrequency, %v", err)
+	}
+	return env.GetDigestSettings(username)
+}
+
+// GetDueDigests builds digests of subscribers who did not get one since the current day or week started.
+// Users without verified email are skipped, so are users whose digest fails to build.
+func (env Env) GetDueDigests(now time.Time) ([]Digest, error) {
+	subscriptions, err := env.getDigestSubscriptions()
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getDigestSubscriptions in GetDueDigests, %v", err)
+	}
+	digests := []Digest{}
+	for _, s := range subscriptions {
+		period, _, err := digestPeriod(s.frequency)
+		if err != nil {
+			continue
+		}
+		if s.lastSentAt != nil && !s.lastSentAt.Before(bucketStart(now, period)) {
+			continue
+		}
+		users, err := env.getUsersWithID(s.userID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on call to getUsersWithID in GetDueDigests, %v", err)
+		}
+		if len(users) != 1 || !users[0].emailVerified {
+			continue
+		}
+		digest, err := env.GetDigest(users[0].username, s.frequency, now)
+		if err != nil {
+			//Digest is built again on next check, others are sent meanwhile
+			log.Error(fmt.Errorf("Failed on call to GetDigest for %v in GetDueDigests, %v", users[0].username, err))
+			continue
+		}
+		digest.lastSentAt = s.lastSentAt
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+// GetDigest summarizes watchlist of user with the most positive and the most negative texts of the period on every keyword.
+func (env Env) GetDigest(username, frequency string, now time.Time) (Digest, error) {
+	period, length, err := digestPeriod(frequency)
+	if err != nil {
+		return Digest{}, err
+	}
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return Digest{}, fmt.Errorf("Failed on call to getUserWithName in GetDigest, %v", err)
+	}
+	entries, err := env.GetWatchlist(username, period)
+	if err != nil {
+		return Digest{}, fmt.Errorf("Failed on call to GetWatchlist in GetDigest, %v", err)
+	}
+	digest := Digest{User: user.info(), Frequency: frequency, From: now.Add(-length).UTC(), To: now.UTC(), Keywords: []DigestKeyword{}}
+	for _, e := range entries {
+		positive, err := env.GetTopTexts(e.ID, digest.From, digest.To, true, DigestTopTexts)
+		if err != nil {
+			return Digest{}, fmt.Errorf("Failed on call to GetTopTexts for %v in GetDigest, %v", e.Name, err)
+		}
+		negative, err := env.GetTopTexts(e.ID, digest.From, digest.To, false, DigestTopTexts)
+		if err != nil {
+			return Digest{}, fmt.Errorf("Failed on call to GetTopTexts for %v in GetDigest, %v", e.Name, err)
+		}
+		digest.Keywords = append(digest.Keywords, DigestKeyword{e, positive, negative})
+	}
+	return digest, nil
+}
+
+// ClaimDigest marks due digest sent before it is sent, so replicas checking due digests at the same time send it once.
+// It is false when digest was claimed by other one since it was built.
+func (env Env) ClaimDigest(d Digest, now time.Time) (bool, error) {
+	period, _, err := digestPeriod(d.Frequency)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := env.claimDigest(d.User.ID, now.UTC().Truncate(time.Second), bucketStart(now, period))
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to claimDigest in ClaimDigest, %v", err)
+	}
+	return claimed, nil
+}
+
+// ReleaseDigest restores send time of previous digest when claimed one failed to be sent, so it is retried on next check.
+func (env Env) ReleaseDigest(d Digest, claimedAt time.Time) error {
+	err := env.releaseDigest(d.User.ID, claimedAt.UTC().Truncate(time.Second), d.lastSentAt)
+	if err != nil {
+		return fmt.Errorf("Failed on call to releaseDigest in ReleaseDigest, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) getDigestSubscriptions() ([]digestSubscription, error) {
+	return s.getSubscriptions("SELECT user_id, frequency, last_sent_at FROM digest_subscriptions ORDER BY user_id")
+}
+
+func (s sqlStore) getUserDigestSubscriptions(userID int) ([]digestSubscription, error) {
+	return s.getSubscriptions("SELECT user_id, frequency, last_sent_at FROM digest_subscriptions WHERE user_id=?", userID)
+}
+
+func (s sqlStore) getSubscriptions(query string, args ...interface{}) ([]digestSubscription, error) {
+	subscriptions := []digestSubscription{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting %v in getSubscriptions, %v", query, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := digestSubscription{}
+		lastSentAt := sql.NullTime{}
+		if err := rows.Scan(&d.userID, &d.frequency, &lastSentAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getSubscriptions on %v", err)
+		}
+		if lastSentAt.Valid {
+			t := lastSentAt.Time.UTC()
+			d.lastSentAt = &t
+		}
+		subscriptions = append(subscriptions, d)
+	}
+	return subscriptions, nil
+}
+
+func (s sqlStore) insertDigestSubscription(d digestSubscription) error {
+	var lastSentAt interface{}
+	if d.lastSentAt != nil {
+		lastSentAt = d.lastSentAt.UTC()
+	}
+	_, err := s.exec("INSERT INTO digest_subscriptions (user_id, frequency, last_sent_at) VALUES (?, ?, ?)", d.userID, d.frequency, lastSentAt)
+	if err != nil {
+		return fmt.Errorf("Failed on inserting digest subscription in insertDigestSubscription, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) setDigestFrequency(userID int, frequency string) error {
+	_, err := s.exec("UPDATE digest_subscriptions SET frequency=? WHERE user_id=?", frequency, userID)
+	if err != nil {
+		return fmt.Errorf("Failed on updating digest subscription of %v in setDigestFrequency, %v", userID, err)
+	}
+	return nil
+}
+
+func (s sqlStore) claimDigest(userID int, sentAt, dueBefore time.Time) (bool, error) {
+	res, err := s.exec("UPDATE digest_subscriptions SET last_sent_at=? WHERE user_id=? AND (last_sent_at IS NULL OR last_sent_at<?)", sentAt.UTC(), userID, dueBefore.UTC())
+	if err != nil {
+		return false, fmt.Errorf("Failed on claiming digest of %v in claimDigest, %v", userID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to RowsAffected in claimDigest, %v", err)
+	}
+	return n > 0, nil
+}
+
+func (s sqlStore) releaseDigest(userID int, claimedAt time.Time, lastSentAt *time.Time) error {
+	var previous interface{}
+	if lastSentAt != nil {
+		previous = lastSentAt.UTC()
+	}
+	_, err := s.exec("UPDATE digest_subscriptions SET last_sent_at=? WHERE user_id=? AND last_sent_at=?", previous, userID, claimedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on releasing digest of %v in releaseDigest, %v", userID, err)
+	}
+	return nil
+}
+
+func (s sqlStore) deleteDigestSubscription(userID int) error {
+	_, err := s.exec("DELETE FROM digest_subscriptions WHERE user_id=?", userID)
+	if err != nil {
+		return fmt.Errorf("Failed on deleting digest subscription of %v in deleteDigestSubscription, %v", userID, err)
+	}
+	return nil
+}
+
+func (m *memoryStore) getDigestSubscriptions() ([]digestSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]digestSubscription{}, m.digestSubscriptions...), nil
+}
+
+func (m *memoryStore) getUserDigestSubscriptions(userID int) ([]digestSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subscriptions := []digestSubscription{}
+	for _, d := range m.digestSubscriptions {
+		if d.userID == userID {
+			subscriptions = append(subscriptions, d)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (m *memoryStore) insertDigestSubscription(d digestSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.digestSubscriptions = append(m.digestSubscriptions, d)
+	return nil
+}
+
+func (m *memoryStore) setDigestFrequency(userID int, frequency string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.digestSubscriptions {
+		if m.digestSubscriptions[i].userID == userID {
+			m.digestSubscriptions[i].frequency = frequency
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) claimDigest(userID int, sentAt, dueBefore time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, d := range m.digestSubscriptions {
+		if d.userID == userID && (d.lastSentAt == nil || d.lastSentAt.Before(dueBefore)) {
+			m.digestSubscriptions[i].lastSentAt = &sentAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStore) releaseDigest(userID int, claimedAt time.Time, lastSentAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, d := range m.digestSubscriptions {
+		if d.userID == userID && d.lastSentAt != nil && d.lastSentAt.Equal(claimedAt) {
+			m.digestSubscriptions[i].lastSentAt = lastSentAt
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) deleteDigestSubscription(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.digestSubscriptions[:0]
+	for _, d := range m.digestSubscriptions {
+		if d.userID != userID {
+			kept = append(kept, d)
+		}
+	}
+	m.digestSubscriptions = kept
+	return nil
+}
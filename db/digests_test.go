@@ -0,0 +1,199 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTopTexts(t *testing.T) {
+	env := setupEnv()
+	now := time.Now().UTC().Truncate(time.Second)
+	err := env.CreateTexts([]Text{
+		NewText(1, "pl", "twitter", "good", 0.2, now),
+		NewText(1, "pl", "news", "best", 0.8, now),
+		NewText(1, "pl", "twitter", "neutral", 0, now),
+		NewText(1, "pl", "twitter", "bad", -0.6, now),
+		NewText(1, "pl", "twitter", "old", 0.9, now.Add(-48*time.Hour)),
+		NewText(2, "pl", "twitter", "other", 0.9, now),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	positive, err := env.GetTopTexts(1, now.Add(-time.Hour), now, true, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positive) != 2 || positive[0].Text != "best" || positive[1].Text != "good" {
+		t.Fatalf("Positive texts should be listed from the most positive, got %v", positive)
+	}
+	negative, err := env.GetTopTexts(1, now.Add(-time.Hour), now, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(negative) != 1 || negative[0].Text != "bad" || negative[0].TextProvider != "twitter" {
+		t.Fatalf("Only negative texts should be listed, got %v", negative)
+	}
+	if text := NewText(1, "pl", "news", strings.Repeat("ą", maxTextLength), 0, now).Text; len(text) != maxTextLength || !utf8.ValidString(text) {
+		t.Fatalf("Text should be truncated to %v bytes, got %v", maxTextLength, len(text))
+	}
+}
+
+func TestDigests(t *testing.T) {
+	env := setupEnv()
+	for _, username := range []string{"abc43", "abc44"} {
+		err := env.CreateUser(username, username+"@example.com", username)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, err := env.getUserWithName("abc43")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.setEmailVerified(user.id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.CreateKeyword(NewKeyword("orlen", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keywordID, err := env.GetKeywordID("orlen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.Follow("abc43", "orlen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	err = env.CreateTexts([]Text{NewText(keywordID, "pl", "twitter", "up", 0.5, now.Add(-time.Hour)), NewText(keywordID, "pl", "news", "down", -0.5, now.Add(-48*time.Hour))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.SetDigestFrequency("abc43", "monthly"); err != ErrInvalidDigest {
+		t.Fatalf("Monthly digest should not be supported, got %v", err)
+	}
+	settings, err := env.SetDigestFrequency("abc43", DailyDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Frequency != DailyDigest || settings.LastSentAt == nil {
+		t.Fatalf("User should be subscribed to daily digest, got %v", settings)
+	}
+	_, err = env.SetDigestFrequency("abc44", WeeklyDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests, err := env.GetDueDigests(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 0 {
+		t.Fatalf("First digest should wait for next day, got %v", digests)
+	}
+	digests, err = env.GetDueDigests(now.Add(8 * 24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 1 || digests[0].User.Username != "abc43" || len(digests[0].Keywords) != 1 {
+		t.Fatalf("Only verified user should get digest, got %v", digests)
+	}
+	digest, err := env.GetDigest("abc43", DailyDigest, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k := digest.Keywords[0]; k.Name != "orlen" || len(k.Positive) != 1 || len(k.Negative) != 0 {
+		t.Fatalf("Digest should show texts of last day only, got %v", digest)
+	}
+	tomorrow := now.Add(24 * time.Hour)
+	digests, err = env.GetDueDigests(tomorrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 1 {
+		t.Fatalf("Digest should be due next day, got %v", digests)
+	}
+	for i, expected := range []bool{true, false} {
+		claimed, err := env.ClaimDigest(digests[0], tomorrow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed != expected {
+			t.Fatalf("Digest should be claimed once, claim %v got %v", i, claimed)
+		}
+	}
+	due, err := env.GetDueDigests(tomorrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("Digest should be sent once a day, got %v", due)
+	}
+	err = env.ReleaseDigest(digests[0], tomorrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err = env.GetDueDigests(tomorrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("Released digest should be due again, got %v", due)
+	}
+	settings, err = env.SetDigestFrequency("abc43", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Frequency != "" {
+		t.Fatalf("User should be unsubscribed, got %v", settings)
+	}
+}
+
+// brokenWatchlistStore fails to read watchlist of one user.
+type brokenWatchlistStore struct {
+	Store
+	userID int
+}
+
+func (s brokenWatchlistStore) getFollowedKeywords(userID int) ([]followedKeyword, error) {
+	if userID == s.userID {
+		return nil, errors.New("broken")
+	}
+	return s.Store.getFollowedKeywords(userID)
+}
+
+func TestDueDigestsSkipFailingUser(t *testing.T) {
+	env := setupEnv()
+	ids := []int{}
+	for _, username := range []string{"abc45", "abc46"} {
+		err := env.CreateUser(username, username+"@example.com", username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := env.getUserWithName(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = env.setEmailVerified(user.id, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = env.SetDigestFrequency(username, DailyDigest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.id)
+	}
+	env.Store = brokenWatchlistStore{env.Store, ids[0]}
+	digests, err := env.GetDueDigests(time.Now().Add(48 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 1 || digests[0].User.Username != "abc46" {
+		t.Fatalf("Digest failing to build should not hold back others, got %v", digests)
+	}
+}
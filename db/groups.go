@@ -0,0 +1,267 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxTagLength = 64
+
+var ErrInvalidTag = errors.New("Tag has to have between 1 and 64 characters")
+
+type Tag struct {
+	Name     string `json:"name"`
+	Keywords int    `json:"keywords"`
+}
+
+// GroupIndexPoint is sentiment of group's members in a bucket, Index is their ReactionAvg weighted with volume of texts.
+type GroupIndexPoint struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Index          float32   `json:"index"`
+	AmountOfTweets int       `json:"amount_of_tweets"`
+	AmountOfNews   int       `json:"amount_of_news"`
+	Members        int       `json:"members"`
+}
+
+func normalizeTag(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || len(tag) > maxTagLength {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// TagKeyword adds keyword to group, ErrKeywordNotFound and ErrInvalidTag are returned as they are.
+func (env Env) TagKeyword(name, tag string) error {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	keywordID, err := env.GetKeywordID(name)
+	if err != nil {
+		return err
+	}
+	tags, err := env.GetKeywordTags(keywordID)
+	if err != nil {
+		return fmt.Errorf("Failed on call to GetKeywordTags in TagKeyword, %v", err)
+	}
+	for _, t := range tags {
+		if t == tag {
+			return nil
+		}
+	}
+	return env.addKeywordTag(keywordID, tag)
+}
+
+func (env Env) UntagKeyword(name, tag string) error {
+	keywordID, err := env.GetKeywordID(name)
+	if err != nil {
+		return err
+	}
+	return env.removeKeywordTag(keywordID, strings.TrimSpace(tag))
+}
+
+func (env Env) GetTagsOfKeyword(name string) ([]string, error) {
+	keywordID, err := env.GetKeywordID(name)
+	if err != nil {
+		return nil, err
+	}
+	return env.GetKeywordTags(keywordID)
+}
+
+// GetGroupMembers returns keywords tagged with tag, archived ones are left out.
+func (env Env) GetGroupMembers(tag string) ([]Keyword, error) {
+	keywords, err := env.GetTaggedKeywords(strings.TrimSpace(tag))
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetTaggedKeywords in GetGroupMembers, %v", err)
+	}
+	members := []Keyword{}
+	for _, k := range keywords {
+		if k.Status != KeywordArchived {
+			members = append(members, k)
+		}
+	}
+	return members, nil
+}
+
+// GetGroupAnalyzes returns analyzes of group members by their names, aggregated when interval is given.
+func (env Env) GetGroupAnalyzes(tag string, after, before time.Time, country, interval, agg string) (map[string][]Analyzis, error) {
+	members, err := env.GetGroupMembers(tag)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetGroupMembers in GetGroupAnalyzes, %v", err)
+	}
+	analyzes := map[string][]Analyzis{}
+	for _, k := range members {
+		if interval == "" {
+			analyzes[k.Name], err = env.GetKeywordAnalyzes(k.ID, after, before, country)
+		} else {
+			analyzes[k.Name], err = env.GetAggregatedAnalyzes(k.Name, after, before, country, interval, agg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed on getting analyzes of %v in GetGroupAnalyzes, %v", k.Name, err)
+		}
+	}
+	return analyzes, nil
+}
+
+// GetGroupIndex computes volume weighted sentiment of group members from their rollups.
+func (env Env) GetGroupIndex(tag string, after, before time.Time, country, interval string) ([]GroupIndexPoint, error) {
+	if !ValidInterval(interval) {
+		return nil, fmt.Errorf("Interval %v not supported", interval)
+	}
+	members, err := env.GetGroupMembers(tag)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetGroupMembers in GetGroupIndex, %v", err)
+	}
+	rollupInterval := DayInterval
+	if interval == HourInterval {
+		rollupInterval = HourInterval
+	}
+	rollups := []Rollup{}
+	for _, k := range members {
+		memberRollups, err := env.GetKeywordRollups(rollupInterval, k.ID, bucketStart(after, rollupInterval), before, country)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on call to GetKeywordRollups for %v in GetGroupIndex, %v", k.Name, err)
+		}
+		rollups = append(rollups, memberRollups...)
+	}
+	sort.SliceStable(rollups, func(i, j int) bool { return rollups[i].Start.Before(rollups[j].Start) })
+	points := []GroupIndexPoint{}
+	membersInBucket := map[int]bool{}
+	for _, r := range rollups {
+		start := bucketStart(r.Start, interval)
+		if len(points) == 0 || !points[len(points)-1].Timestamp.Equal(start) {
+			points = append(points, GroupIndexPoint{Timestamp: start})
+			membersInBucket = map[int]bool{}
+		}
+		membersInBucket[r.KeywordID] = true
+		points[len(points)-1].Members = len(membersInBucket)
+	}
+	for i, r := range mergeRollups(rollups, 0, country, interval) {
+		points[i].Index = r.ReactionAvg.value(WeightedAgg, r.Count, r.AmountOfTweets+r.AmountOfNews)
+		points[i].AmountOfTweets = r.AmountOfTweets
+		points[i].AmountOfNews = r.AmountOfNews
+	}
+	return points, nil
+}
+
+func (s sqlStore) addKeywordTag(keywordID int, tag string) error {
+	_, err := s.exec("INSERT INTO keyword_tags (keyword_id, tag) VALUES (?, ?)", keywordID, tag)
+	if err != nil {
+		return fmt.Errorf("Failed on inserting to keyword_tags in addKeywordTag, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) removeKeywordTag(keywordID int, tag string) error {
+	_, err := s.exec("DELETE FROM keyword_tags WHERE keyword_id=? AND tag=?", keywordID, tag)
+	if err != nil {
+		return fmt.Errorf("Failed on deleting from keyword_tags in removeKeywordTag, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) GetKeywordTags(keywordID int) ([]string, error) {
+	tags := []string{}
+	rows, err := s.query("SELECT tag FROM keyword_tags WHERE keyword_id=? ORDER BY tag", keywordID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting keyword_tags in GetKeywordTags, %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		tag := ""
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in GetKeywordTags on %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (s sqlStore) GetTags() ([]Tag, error) {
+	tags := []Tag{}
+	rows, err := s.query("SELECT tag, COUNT(*) FROM keyword_tags GROUP BY tag ORDER BY tag")
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting keyword_tags in GetTags, %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		tag := Tag{}
+		if err := rows.Scan(&tag.Name, &tag.Keywords); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in GetTags on %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (s sqlStore) GetTaggedKeywords(tag string) ([]Keyword, error) {
+	return s.getKeywords("SELECT id, name, provider, additional_info, status FROM keywords WHERE id IN (SELECT keyword_id FROM keyword_tags WHERE tag=?) ORDER BY name", tag)
+}
+
+func (m *memoryStore) addKeywordTag(keywordID int, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keywordTags = append(m.keywordTags, keywordTag{keywordID, tag})
+	return nil
+}
+
+func (m *memoryStore) removeKeywordTag(keywordID int, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := []keywordTag{}
+	for _, t := range m.keywordTags {
+		if t.keywordID != keywordID || t.tag != tag {
+			kept = append(kept, t)
+		}
+	}
+	m.keywordTags = kept
+	return nil
+}
+
+func (m *memoryStore) GetKeywordTags(keywordID int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tags := []string{}
+	for _, t := range m.keywordTags {
+		if t.keywordID == keywordID {
+			tags = append(tags, t.tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (m *memoryStore) GetTags() ([]Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := map[string]int{}
+	for _, t := range m.keywordTags {
+		counts[t.tag]++
+	}
+	tags := []Tag{}
+	for name, count := range counts {
+		tags = append(tags, Tag{name, count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (m *memoryStore) GetTaggedKeywords(tag string) ([]Keyword, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keywords := []Keyword{}
+	for _, k := range m.keywords {
+		for _, t := range m.keywordTags {
+			if t.keywordID == k.ID && t.tag == tag {
+				keywords = append(keywords, k)
+				break
+			}
+		}
+	}
+	sort.Slice(keywords, func(i, j int) bool { return keywords[i].Name < keywords[j].Name })
+	return keywords, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTagKeyword(t *testing.T) {
+	env := setupEnv()
+	for _, name := range []string{"pko", "mbank"} {
+		err := env.CreateKeyword(NewKeyword(name, "stock", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = env.TagKeyword(name, " Polish banks ")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := env.TagKeyword("pko", "Polish banks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.TagKeyword("pko", "")
+	if err != ErrInvalidTag {
+		t.Fatalf("Empty tag should fail with ErrInvalidTag, got %v", err)
+	}
+	tags, err := env.GetTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != (Tag{"Polish banks", 2}) {
+		t.Fatalf("Unexpected tags %v", tags)
+	}
+	err = env.UntagKeyword("mbank", "Polish banks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := env.GetGroupMembers("Polish banks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].Name != "pko" {
+		t.Fatalf("Unexpected members %v", members)
+	}
+	cleanUp()
+}
+
+func TestGetGroupIndex(t *testing.T) {
+	env := setupEnv()
+	day := time.Date(2018, 3, 14, 0, 0, 0, 0, time.UTC)
+	reactions := map[string][]Analyzis{
+		"tesla": {NewAnalyzis(0, "us", day.Add(time.Hour), 30, 0, 0.5, 0.5, 0), NewAnalyzis(0, "us", day.Add(25*time.Hour), 10, 0, 0.5, 0.5, 0)},
+		"nio":   {NewAnalyzis(0, "us", day.Add(2*time.Hour), 10, 0, -0.5, -0.5, 0)},
+	}
+	for name, analyzes := range reactions {
+		err := env.CreateKeyword(NewKeyword(name, "stock", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = env.TagKeyword(name, "EV makers")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keywordID, err := env.GetKeywordID(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range analyzes {
+			a.KeywordID = keywordID
+			err := env.CreateAnalyzis(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	index, err := env.GetGroupIndex("EV makers", day, day.Add(48*time.Hour), "any", DayInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []GroupIndexPoint{{day, 0.25, 40, 0, 2}, {day.Add(24 * time.Hour), 0.5, 10, 0, 1}}
+	if len(index) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, index)
+	}
+	for i := range expected {
+		if !index[i].Timestamp.Equal(expected[i].Timestamp) || index[i].Index != expected[i].Index || index[i].AmountOfTweets != expected[i].AmountOfTweets || index[i].Members != expected[i].Members {
+			t.Fatalf("Expected %v, got %v", expected[i], index[i])
+		}
+	}
+	cleanUp()
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxUsernameSuffix = 100
+
+// Identity is user as asserted by single sign-on provider, issuer and subject identify it, the rest is only used on provisioning.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+}
+
+type userIdentity struct {
+	userID    int
+	issuer    string
+	subject   string
+	createdAt time.Time
+}
+
+// LoginWithIdentity returns user linked with identity, user is provisioned with role on first login.
+// Existing users are never linked by username or email, as provider may not verify them.
+func (env Env) LoginWithIdentity(identity Identity, role string) (UserInfo, error) {
+	if identity.Issuer == "" || identity.Subject == "" {
+		return UserInfo{}, fmt.Errorf("Identity %v lacks issuer or subject", identity)
+	}
+	users, err := env.getUsersWithIdentity(identity.Issuer, identity.Subject)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to getUsersWithIdentity in LoginWithIdentity, %v", err)
+	}
+	if len(users) == 1 {
+		return users[0].info(), nil
+	}
+	if !ValidRole(role) {
+		return UserInfo{}, ErrInvalidRole
+	}
+	username, err := env.freeUsername(identityUsername(identity))
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to freeUsername in LoginWithIdentity, %v", err)
+	}
+	verified := identity.EmailVerified && identity.Email != ""
+	err = env.insertUserWithIdentity(username, identity.Email, role, verified, userIdentity{0, identity.Issuer, identity.Subject, time.Now().UTC().Truncate(time.Second)})
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to insertUserWithIdentity in LoginWithIdentity, %v", err)
+	}
+	err = env.bootstrapFirstAdmin(username)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to bootstrapFirstAdmin in LoginWithIdentity, %v", err)
+	}
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to getUserWithName in LoginWithIdentity, %v", err)
+	}
+	log.Info(fmt.Sprintf("User %v provisioned for %v of %v", username, identity.Subject, identity.Issuer))
+	return user.info(), nil
+}
+
+// identityUsername prefers username given by provider, then local part of email and subject at last.
+func identityUsername(identity Identity) string {
+	if username := strings.TrimSpace(identity.Username); username != "" {
+		return username
+	}
+	if at := strings.Index(identity.Email, "@"); at > 0 {
+		return identity.Email[:at]
+	}
+	return identity.Subject
+}
+
+// freeUsername appends number to username taken already.
+func (env Env) freeUsername(username string) (string, error) {
+	for i := 1; i <= maxUsernameSuffix; i++ {
+		candidate := username
+		if i > 1 {
+			candidate = username + strconv.Itoa(i)
+		}
+		present, err := env.UserIsPresent(candidate)
+		if err != nil {
+			return "", fmt.Errorf("Failed on call to UserIsPresent in freeUsername, %v", err)
+		}
+		if !present {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("No free username similar to %v", username)
+}
+
+func (s sqlStore) getUsersWithIdentity(issuer, subject string) ([]User, error) {
+	return s.getUsers("SELECT "+userColumns+" FROM users WHERE id IN (SELECT user_id FROM user_identities WHERE issuer=? AND subject=?)", issuer, subject)
+}
+
+func (s sqlStore) insertUserIdentity(i userIdentity) error {
+	_, err := s.exec("INSERT INTO user_identities (user_id, issuer, subject, created_at) VALUES (?, ?, ?, ?)", i.userID, i.issuer, i.subject, i.createdAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting identity of user %v in insertUserIdentity, %v", i.userID, err)
+	}
+	return nil
+}
+
+// insertUserWithIdentity inserts user, links identity and marks email verified in one transaction,
+// so no user is left without identity when concurrent login of the same identity links it first.
+func (s sqlStore) insertUserWithIdentity(username, email, role string, emailVerified bool, i userIdentity) error {
+	return s.inTx(func(tx sqlStore) error {
+		err := tx.insertUser(username, email, "", NoPassword, role)
+		if err != nil {
+			return err
+		}
+		users, err := tx.getUsersWithName(username)
+		if err != nil {
+			return err
+		}
+		if len(users) != 1 {
+			return fmt.Errorf("Failed on reading inserted user %v in insertUserWithIdentity", username)
+		}
+		i.userID = users[0].id
+		err = tx.insertUserIdentity(i)
+		if err != nil {
+			return err
+		}
+		if emailVerified {
+			return tx.setEmailVerified(i.userID, true)
+		}
+		return nil
+	})
+}
+
+func (m *memoryStore) getUsersWithIdentity(issuer, subject string) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := []User{}
+	for _, i := range m.userIdentities {
+		if i.issuer != issuer || i.subject != subject {
+			continue
+		}
+		for _, u := range m.users {
+			if u.id == i.userID {
+				users = append(users, u)
+			}
+		}
+	}
+	return users, nil
+}
+
+func (m *memoryStore) insertUserWithIdentity(username, email, role string, emailVerified bool, i userIdentity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.username == username {
+			return fmt.Errorf("user %v already exists", username)
+		}
+	}
+	for _, stored := range m.userIdentities {
+		if stored.issuer == i.issuer && stored.subject == i.subject {
+			return fmt.Errorf("Identity %v of %v already linked", i.subject, i.issuer)
+		}
+	}
+	i.userID = len(m.users) + 1
+	m.users = append(m.users, User{i.userID, username, email, "", NoPassword, role, emailVerified})
+	m.userIdentities = append(m.userIdentities, i)
+	return nil
+}
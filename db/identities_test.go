@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginWithIdentity(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("jan", "jan@example.com", "abc37")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := Identity{Issuer: "https://idp.example.com", Subject: "1", Email: "jan@example.com", EmailVerified: true}
+	_, err = env.LoginWithIdentity(identity, "owner")
+	if err != ErrInvalidRole {
+		t.Fatalf("Unknown role should fail with ErrInvalidRole, got %v", err)
+	}
+	user, err := env.LoginWithIdentity(identity, AnalystRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "jan2" || user.Role != AnalystRole || !user.EmailVerified {
+		t.Fatalf("User should be provisioned under free username, got %v", user)
+	}
+	identity.Username = "changed"
+	again, err := env.LoginWithIdentity(identity, ViewerRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != user {
+		t.Fatalf("Same identity should log into same user, got %v and %v", again, user)
+	}
+	other, err := env.LoginWithIdentity(Identity{Issuer: "https://other.example.com", Subject: "1", Username: "ola"}, ViewerRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == user.ID || other.Username != "ola" || other.EmailVerified {
+		t.Fatalf("Identity of other issuer should get own user, got %v", other)
+	}
+	correct, err := env.PasswordIsCorrect("ola", "")
+	if err != nil || correct {
+		t.Fatalf("Provisioned user should not log in with password, got %v, %v", correct, err)
+	}
+	_, err = env.LoginWithIdentity(Identity{Issuer: "https://idp.example.com"}, ViewerRole)
+	if err == nil {
+		t.Fatal("Identity without subject should fail")
+	}
+}
+
+func TestInsertUserWithLinkedIdentity(t *testing.T) {
+	env := setupEnv()
+	identity := Identity{Issuer: "https://idp.example.com", Subject: "2", Username: "abc38"}
+	_, err := env.LoginWithIdentity(identity, ViewerRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Concurrent login of the same identity linked it first
+	err = env.insertUserWithIdentity("abc39", "", ViewerRole, false, userIdentity{0, identity.Issuer, identity.Subject, time.Now().UTC()})
+	if err == nil {
+		t.Fatal("Identity should not be linked twice")
+	}
+	present, err := env.UserIsPresent("abc39")
+	if err != nil || present {
+		t.Fatalf("User should not be left without identity, got %v, %v", present, err)
+	}
+}
@@ -0,0 +1,294 @@
+package db
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultInviteTTL = 7 * 24 * time.Hour
+	//inviteShownLength is length of beginning of code stored in plain to recognize it on listing
+	inviteShownLength = 6
+)
+
+var ErrInvalidInvite = errors.New("Invite is not valid")
+
+// Invite lets up to MaxUses users register with Role until it expires.
+type Invite struct {
+	ID        int       `json:"id"`
+	Prefix    string    `json:"prefix"`
+	Role      string    `json:"role"`
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	CreatedBy int       `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (i Invite) valid(now time.Time) bool {
+	return i.Uses < i.MaxUses && now.Before(i.ExpiresAt)
+}
+
+// CreateInvite returns code of new invite, only its hash is stored so it cannot be shown again.
+func (env Env) CreateInvite(createdBy, role string, maxUses int, ttl time.Duration) (string, Invite, error) {
+	if role == "" {
+		role = DefaultRole
+	}
+	if !ValidRole(role) {
+		return "", Invite{}, ErrInvalidRole
+	}
+	if maxUses < 1 || ttl <= 0 {
+		return "", Invite{}, ErrInvalidInvite
+	}
+	user, err := env.getUserWithName(createdBy)
+	if err != nil {
+		return "", Invite{}, fmt.Errorf("Failed on call to getUserWithName in CreateInvite, %v", err)
+	}
+	code, err := newToken()
+	if err != nil {
+		return "", Invite{}, fmt.Errorf("Failed on call to newToken in CreateInvite, %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	invite := Invite{Prefix: code[:inviteShownLength], Role: role, MaxUses: maxUses, CreatedBy: user.id, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	err = env.insertInvite(invite, hashToken(code))
+	if err != nil {
+		return "", Invite{}, fmt.Errorf("Failed on call to insertInvite in CreateInvite, %v", err)
+	}
+	invites, err := env.getInvitesWithHash(hashToken(code))
+	if err != nil || len(invites) != 1 {
+		return "", Invite{}, fmt.Errorf("Failed on call to getInvitesWithHash in CreateInvite, %v", err)
+	}
+	return code, invites[0], nil
+}
+
+func (env Env) GetInvites() ([]Invite, error) {
+	return env.getAllInvites()
+}
+
+func (env Env) RevokeInvite(id int) error {
+	deleted, err := env.deleteInvite(id)
+	if err != nil {
+		return fmt.Errorf("Failed on call to deleteInvite in RevokeInvite, %v", err)
+	}
+	if deleted == 0 {
+		return ErrInvalidInvite
+	}
+	return nil
+}
+
+// CheckRegistrationCode tells whether code is shared legacy code or usable invite, without using it up.
+func (env Env) CheckRegistrationCode(code string) error {
+	if env.isLegacyRegistrationCode(code) {
+		return nil
+	}
+	_, err := env.validInvite(code)
+	return err
+}
+
+// RegisterUser creates user with code, invite gives role to user and is used up once.
+func (env Env) RegisterUser(username, email, password, code string) error {
+	if env.isLegacyRegistrationCode(code) {
+		return env.CreateUser(username, email, password)
+	}
+	invite, err := env.validInvite(code)
+	if err != nil {
+		return err
+	}
+	used, err := env.useInvite(invite.ID)
+	if err != nil {
+		return fmt.Errorf("Failed on call to useInvite in RegisterUser, %v", err)
+	}
+	if !used {
+		return ErrInvalidInvite
+	}
+	err = env.createUser(username, email, password, invite.Role)
+	if err != nil {
+		//Use is given back, so failed registration does not use up invite
+		if releaseErr := env.releaseInvite(invite.ID); releaseErr != nil {
+			log.Error(fmt.Errorf("Failed on call to releaseInvite in RegisterUser, %v", releaseErr))
+		}
+		return fmt.Errorf("Failed on call to createUser in RegisterUser, %v", err)
+	}
+	//User is already created and keeps the use, missing redemption only loses audit trail
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to getUserWithName in RegisterUser, %v", err))
+		return nil
+	}
+	err = env.insertInviteRedemption(invite.ID, user.id, time.Now().UTC())
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to insertInviteRedemption in RegisterUser, %v", err))
+	}
+	return nil
+}
+
+// isLegacyRegistrationCode compares code with one shared by everyone, it is disabled when empty.
+func (env Env) isLegacyRegistrationCode(code string) bool {
+	return env.RegistrationCode != "" && subtle.ConstantTimeCompare([]byte(code), []byte(env.RegistrationCode)) == 1
+}
+
+func (env Env) validInvite(code string) (Invite, error) {
+	invites, err := env.getInvitesWithHash(hashToken(code))
+	if err != nil {
+		return Invite{}, fmt.Errorf("Failed on call to getInvitesWithHash in validInvite, %v", err)
+	}
+	if len(invites) != 1 || !invites[0].valid(time.Now().UTC()) {
+		return Invite{}, ErrInvalidInvite
+	}
+	return invites[0], nil
+}
+
+const inviteColumns = "id, prefix, role, max_uses, uses, created_by, created_at, expires_at"
+
+func (s sqlStore) insertInvite(i Invite, codeHash string) error {
+	_, err := s.exec("INSERT INTO invites (code_hash, prefix, role, max_uses, uses, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", codeHash, i.Prefix, i.Role, i.MaxUses, i.Uses, i.CreatedBy, i.CreatedAt.UTC(), i.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting invite in insertInvite, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) getInvitesWithHash(codeHash string) ([]Invite, error) {
+	return s.getInvites("SELECT "+inviteColumns+" FROM invites WHERE code_hash=?", codeHash)
+}
+
+func (s sqlStore) getAllInvites() ([]Invite, error) {
+	return s.getInvites("SELECT " + inviteColumns + " FROM invites ORDER BY id")
+}
+
+func (s sqlStore) getInvites(query string, args ...interface{}) ([]Invite, error) {
+	invites := []Invite{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting %v in getInvites, %v", query, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		i := Invite{}
+		if err := rows.Scan(&i.ID, &i.Prefix, &i.Role, &i.MaxUses, &i.Uses, &i.CreatedBy, &i.CreatedAt, &i.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getInvites on %v", err)
+		}
+		i.CreatedAt = i.CreatedAt.UTC()
+		i.ExpiresAt = i.ExpiresAt.UTC()
+		invites = append(invites, i)
+	}
+	return invites, nil
+}
+
+// useInvite counts use of invite unless it is used up, concurrent registrations cannot exceed its limit.
+func (s sqlStore) useInvite(id int) (bool, error) {
+	res, err := s.exec("UPDATE invites SET uses=uses+1 WHERE id=? AND uses<max_uses", id)
+	if err != nil {
+		return false, fmt.Errorf("Failed on updating invite %v in useInvite, %v", id, err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to RowsAffected in useInvite, %v", err)
+	}
+	return updated == 1, nil
+}
+
+func (s sqlStore) releaseInvite(id int) error {
+	_, err := s.exec("UPDATE invites SET uses=uses-1 WHERE id=? AND uses>0", id)
+	if err != nil {
+		return fmt.Errorf("Failed on updating invite %v in releaseInvite, %v", id, err)
+	}
+	return nil
+}
+
+func (s sqlStore) insertInviteRedemption(inviteID, userID int, redeemedAt time.Time) error {
+	_, err := s.exec("INSERT INTO invite_redemptions (invite_id, user_id, redeemed_at) VALUES (?, ?, ?)", inviteID, userID, redeemedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting redemption of invite %v in insertInviteRedemption, %v", inviteID, err)
+	}
+	return nil
+}
+
+func (s sqlStore) deleteInvite(id int) (int64, error) {
+	res, err := s.exec("DELETE FROM invites WHERE id=?", id)
+	if err != nil {
+		return 0, fmt.Errorf("Failed on deleting invite %v in deleteInvite, %v", id, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to RowsAffected in deleteInvite, %v", err)
+	}
+	return deleted, nil
+}
+
+func (m *memoryStore) insertInvite(i Invite, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastInviteID++
+	i.ID = m.lastInviteID
+	m.invites = append(m.invites, storedInvite{i, codeHash})
+	return nil
+}
+
+func (m *memoryStore) getInvitesWithHash(codeHash string) ([]Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invites := []Invite{}
+	for _, i := range m.invites {
+		if i.codeHash == codeHash {
+			invites = append(invites, i.Invite)
+		}
+	}
+	return invites, nil
+}
+
+func (m *memoryStore) getAllInvites() ([]Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invites := []Invite{}
+	for _, i := range m.invites {
+		invites = append(invites, i.Invite)
+	}
+	return invites, nil
+}
+
+func (m *memoryStore) useInvite(id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.invites {
+		if m.invites[i].ID == id && m.invites[i].Uses < m.invites[i].MaxUses {
+			m.invites[i].Uses++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStore) releaseInvite(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.invites {
+		if m.invites[i].ID == id && m.invites[i].Uses > 0 {
+			m.invites[i].Uses--
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) insertInviteRedemption(inviteID, userID int, redeemedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inviteRedemptions = append(m.inviteRedemptions, inviteRedemption{inviteID, userID, redeemedAt})
+	return nil
+}
+
+func (m *memoryStore) deleteInvite(id int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, invite := range m.invites {
+		if invite.ID == id {
+			m.invites = append(m.invites[:i], m.invites[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegisterUserWithInvite(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc22", "abc22", "abc22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = env.CreateInvite("abc22", "owner", 1, DefaultInviteTTL)
+	if err != ErrInvalidRole {
+		t.Fatalf("Unknown role should fail with ErrInvalidRole, got %v", err)
+	}
+	code, invite, err := env.CreateInvite("abc22", AnalystRole, 2, DefaultInviteTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invite.Uses != 0 || invite.MaxUses != 2 || invite.Role != AnalystRole {
+		t.Fatalf("Unexpected invite %v", invite)
+	}
+	for _, name := range []string{"abc23", "abc24"} {
+		err = env.CheckRegistrationCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = env.RegisterUser(name, name, name, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := env.getUserWithName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.role != AnalystRole {
+			t.Fatalf("Invited user should get role of invite, got %v", user.role)
+		}
+	}
+	err = env.CheckRegistrationCode(code)
+	if err != ErrInvalidInvite {
+		t.Fatalf("Used up invite should not be valid, got %v", err)
+	}
+	err = env.RegisterUser("abc25", "abc25", "abc25", code)
+	if err != ErrInvalidInvite {
+		t.Fatalf("Used up invite should not register, got %v", err)
+	}
+	invites, err := env.GetInvites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invites) != 1 || invites[0].Uses != 2 {
+		t.Fatalf("Invite should be used twice, got %v", invites)
+	}
+}
+
+func TestExpiredAndLegacyRegistrationCode(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc26", "abc26", "abc26")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, invite, err := env.CreateInvite("abc26", "", 1, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := env.CheckRegistrationCode(code); err != ErrInvalidInvite {
+		t.Fatalf("Expired invite should not be valid, got %v", err)
+	}
+	err = env.RevokeInvite(invite.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.CheckRegistrationCode(""); err != ErrInvalidInvite {
+		t.Fatalf("Empty legacy code should be disabled, got %v", err)
+	}
+	env.RegistrationCode = "shared"
+	err = env.RegisterUser("abc27", "abc27", "abc27", "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := env.getUserWithName("abc27")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.role != DefaultRole {
+		t.Fatalf("Legacy code should give default role, got %v", user.role)
+	}
+}
+
+func TestFailedRegistrationReleasesInvite(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc26", "abc26", "abc26")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := env.CreateInvite("abc26", AnalystRole, 1, DefaultInviteTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.RegisterUser("abc26", "other", "other", code)
+	if err == nil {
+		t.Fatal("Registering taken username should fail")
+	}
+	invites, err := env.GetInvites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invites) != 1 || invites[0].Uses != 0 {
+		t.Fatalf("Failed registration should give use back, got %v", invites)
+	}
+	err = env.RegisterUser("abc27", "abc27", "abc27", code)
+	if err != nil {
+		t.Fatalf("Released invite should still register, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KeywordActive   = "active"
+	KeywordPaused   = "paused"
+	KeywordArchived = "archived"
+)
+
+var (
+	ErrKeywordNotFound      = errors.New("Keyword does not exist")
+	ErrKeywordExists        = errors.New("Keyword already present")
+	ErrInvalidKeywordStatus = errors.New("Keyword status not supported")
+)
+
+func ValidKeywordStatus(status string) bool {
+	return status == KeywordActive || status == KeywordPaused || status == KeywordArchived
+}
+
+// KeywordUpdate holds fields of keyword to change, nil ones are left untouched.
+type KeywordUpdate struct {
+	Name           *string
+	Provider       *string
+	AdditionalInfo *string
+	Status         *string
+}
+
+// KeywordRename records a name keyword had until RenamedAt.
+type KeywordRename struct {
+	KeywordID int       `json:"keyword_id"`
+	Name      string    `json:"name"`
+	RenamedAt time.Time `json:"renamed_at"`
+}
+
+func (env Env) GetKeyword(name string) (Keyword, error) {
+	keywords, err := env.GetKeywordsWithName(name)
+	if err != nil {
+		return Keyword{}, fmt.Errorf("Failed on call to GetKeywordsWithName in GetKeyword, %v", err)
+	}
+	if len(keywords) != 1 {
+		return Keyword{}, ErrKeywordNotFound
+	}
+	return keywords[0], nil
+}
+
+// UpdateKeyword applies update to keyword, renamed keyword keeps its analyzes and its old name is recorded.
+// ErrKeywordNotFound, ErrKeywordExists and ErrInvalidKeywordStatus are returned as they are.
+func (env Env) UpdateKeyword(name string, update KeywordUpdate) (Keyword, error) {
+	keyword, err := env.GetKeyword(name)
+	if err != nil {
+		return Keyword{}, err
+	}
+	if update.Status != nil && !ValidKeywordStatus(*update.Status) {
+		return Keyword{}, ErrInvalidKeywordStatus
+	}
+	renamed := update.Name != nil && *update.Name != keyword.Name
+	if renamed {
+		present, err := env.KeywordIsPresent(*update.Name)
+		if err != nil {
+			return Keyword{}, fmt.Errorf("Failed on call to KeywordIsPresent in UpdateKeyword, %v", err)
+		}
+		if present {
+			return Keyword{}, ErrKeywordExists
+		}
+		keyword.Name = *update.Name
+	}
+	if update.Provider != nil {
+		keyword.Provider = *update.Provider
+	}
+	if update.AdditionalInfo != nil {
+		keyword.AdditionalInfo = *update.AdditionalInfo
+	}
+	if update.Status != nil {
+		keyword.Status = *update.Status
+	}
+	if renamed {
+		err = env.renameKeyword(keyword, KeywordRename{keyword.ID, name, time.Now().UTC()})
+		if err != nil {
+			return Keyword{}, fmt.Errorf("Failed on call to renameKeyword in UpdateKeyword, %v", err)
+		}
+	} else {
+		err = env.updateKeyword(keyword)
+		if err != nil {
+			return Keyword{}, fmt.Errorf("Failed on call to updateKeyword in UpdateKeyword, %v", err)
+		}
+	}
+	log.Debug(keyword)
+	return keyword, nil
+}
+
+// ArchiveKeyword soft deletes keyword, its analyzes are kept but it is neither listed nor analyzed anymore.
+func (env Env) ArchiveKeyword(name string) (Keyword, error) {
+	archived := KeywordArchived
+	return env.UpdateKeyword(name, KeywordUpdate{Status: &archived})
+}
+
+func (env Env) GetRenames(name string) ([]KeywordRename, error) {
+	keywordID, err := env.GetKeywordID(name)
+	if err != nil {
+		return nil, err
+	}
+	return env.GetKeywordRenames(keywordID)
+}
+
+func (s sqlStore) updateKeyword(keyword Keyword) error {
+	_, err := s.exec("UPDATE keywords SET name=?, provider=?, additional_info=?, status=? WHERE id=?", keyword.Name, keyword.Provider, keyword.AdditionalInfo, keyword.Status, keyword.ID)
+	if err != nil {
+		return fmt.Errorf("Failed on updating keyword %v in updateKeyword, %v", keyword.ID, err)
+	}
+	return nil
+}
+
+// renameKeyword updates keyword and records its previous name in one transaction, so no rename is left unrecorded.
+func (s sqlStore) renameKeyword(keyword Keyword, rename KeywordRename) error {
+	return s.inTx(func(tx sqlStore) error {
+		err := tx.updateKeyword(keyword)
+		if err != nil {
+			return err
+		}
+		return tx.insertKeywordRename(rename)
+	})
+}
+
+func (s sqlStore) insertKeywordRename(rename KeywordRename) error {
+	_, err := s.exec("INSERT INTO keyword_renames (keyword_id, name, renamed_at) VALUES (?, ?, ?)", rename.KeywordID, rename.Name, rename.RenamedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting to keyword_renames in insertKeywordRename, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) GetKeywordRenames(keywordID int) ([]KeywordRename, error) {
+	renames := []KeywordRename{}
+	rows, err := s.query("SELECT keyword_id, name, renamed_at FROM keyword_renames WHERE keyword_id=? ORDER BY renamed_at", keywordID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting keyword_renames in GetKeywordRenames, %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rename := KeywordRename{}
+		if err := rows.Scan(&rename.KeywordID, &rename.Name, &rename.RenamedAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in GetKeywordRenames on %v", err)
+		}
+		rename.RenamedAt = rename.RenamedAt.UTC()
+		renames = append(renames, rename)
+	}
+	return renames, nil
+}
+
+func (m *memoryStore) updateKeyword(keyword Keyword) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.keywords {
+		if m.keywords[i].ID == keyword.ID {
+			m.keywords[i] = keyword
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) renameKeyword(keyword Keyword, rename KeywordRename) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.keywords {
+		if m.keywords[i].ID == keyword.ID {
+			m.keywords[i] = keyword
+		}
+	}
+	m.keywordRenames = append(m.keywordRenames, rename)
+	return nil
+}
+
+func (m *memoryStore) GetKeywordRenames(keywordID int) ([]KeywordRename, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	renames := []KeywordRename{}
+	for _, r := range m.keywordRenames {
+		if r.KeywordID == keywordID {
+			renames = append(renames, r)
+		}
+	}
+	return renames, nil
+}
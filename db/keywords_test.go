@@ -0,0 +1,75 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestUpdateKeyword(t *testing.T) {
+	env := setupEnv()
+	for _, name := range []string{"trend", "other"} {
+		err := env.CreateKeyword(NewKeyword(name, "unknown", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	renamed, provider, paused := "trends", "stock", KeywordPaused
+	updated, err := env.UpdateKeyword("trend", KeywordUpdate{Name: &renamed, Provider: &provider, Status: &paused})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != renamed || updated.Provider != provider || updated.Status != KeywordPaused || updated.AdditionalInfo != "" {
+		t.Fatalf("Unexpected updated keyword %v", updated)
+	}
+	keyword, err := env.GetKeyword(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyword != updated {
+		t.Fatalf("Stored keyword %v is not equal to updated %v", keyword, updated)
+	}
+	renames, err := env.GetRenames(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renames) != 1 || renames[0].Name != "trend" || renames[0].KeywordID != keyword.ID {
+		t.Fatalf("Rename should be recorded, got %v", renames)
+	}
+	other := "other"
+	_, err = env.UpdateKeyword(renamed, KeywordUpdate{Name: &other})
+	if err != ErrKeywordExists {
+		t.Fatalf("Renaming to existing keyword should fail with ErrKeywordExists, got %v", err)
+	}
+	invalid := "deleted"
+	_, err = env.UpdateKeyword(renamed, KeywordUpdate{Status: &invalid})
+	if err != ErrInvalidKeywordStatus {
+		t.Fatalf("Unknown status should fail with ErrInvalidKeywordStatus, got %v", err)
+	}
+	_, err = env.UpdateKeyword("trend", KeywordUpdate{Status: &paused})
+	if err != ErrKeywordNotFound {
+		t.Fatalf("Old name should not be found, got %v", err)
+	}
+	cleanUp()
+}
+
+func TestArchiveKeyword(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateKeyword(NewKeyword("trend", "unknown", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, err := env.ArchiveKeyword("trend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived.Status != KeywordArchived {
+		t.Fatalf("Keyword %v should be archived", archived)
+	}
+	keywords, err := env.GetKeywords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keywords) != 1 || keywords[0].Status != KeywordArchived {
+		t.Fatalf("Archived keyword should be kept, got %v", keywords)
+	}
+	cleanUp()
+}
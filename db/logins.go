@@ -0,0 +1,334 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	//LoginWindow is period failed logins are counted in, it is also the longest lockout
+	LoginWindow = 15 * time.Minute
+	//Failed logins above free ones double delay before next attempt is allowed
+	accountFreeFailures = 5
+	ipFreeFailures      = 20
+	//countedFailures above free ones are read at most, delay reaches LoginWindow before
+	countedFailures       = 10
+	LoginAttemptRetention = 90 * 24 * time.Hour
+)
+
+var ErrLoginThrottled = errors.New("Too many failed login attempts")
+
+// LoginAttempt is entry of login audit log, username is stored as given also when no such user exists.
+// Throttled attempts were rejected without checking credentials, they are counted in one entry per account and IP
+// dated by the latest of them.
+type LoginAttempt struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	IP          string    `json:"ip"`
+	Succeeded   bool      `json:"succeeded"`
+	Throttled   int       `json:"throttled"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// LoginAttemptFilter selects attempts after given time, newest first, empty fields match everything.
+// FailedOnly selects attempts with wrong credentials, throttled ones are not failures, as they were not checked.
+type LoginAttemptFilter struct {
+	Username      string
+	IP            string
+	FailedOnly    bool
+	SucceededOnly bool
+	After         time.Time
+	Limit         int
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// Login checks credentials unless there were too many failures for the account or from the IP lately,
+// then ErrLoginThrottled is returned with time left until next attempt. Every attempt is logged.
+// Attempt is logged as failed before credentials are checked, so concurrent guesses count each other
+// and no more of them than free failures get to password check.
+func (env Env) Login(username, password, ip string) (bool, time.Duration, error) {
+	now := time.Now().UTC()
+	wait, err := env.loginWait(username, ip, now)
+	if err != nil {
+		return false, 0, fmt.Errorf("Failed on call to loginWait in Login, %v", err)
+	}
+	if wait > 0 {
+		return env.throttleLogin(username, ip, now, wait)
+	}
+	id, err := env.insertLoginAttempt(LoginAttempt{Username: username, IP: ip, AttemptedAt: now})
+	if err != nil {
+		return false, 0, fmt.Errorf("Failed on call to insertLoginAttempt in Login, %v", err)
+	}
+	wait, err = env.loginWaitExcept(username, ip, now, id)
+	if err != nil {
+		return false, 0, fmt.Errorf("Failed on call to loginWaitExcept in Login, %v", err)
+	}
+	if wait > 0 {
+		log.Warn(fmt.Sprintf("Login of %v from %v throttled by concurrent attempts for %v", username, ip, wait))
+		err = env.setLoginAttemptOutcome(id, false, 1)
+		if err != nil {
+			return false, 0, fmt.Errorf("Failed on call to setLoginAttemptOutcome in Login, %v", err)
+		}
+		return false, wait, ErrLoginThrottled
+	}
+	correct, err := env.checkCredentials(username, password)
+	if err != nil {
+		return false, 0, fmt.Errorf("Failed on call to checkCredentials in Login, %v", err)
+	}
+	if !correct {
+		log.Warn(fmt.Sprintf("Failed login of %v from %v", username, ip))
+		return false, 0, nil
+	}
+	err = env.setLoginAttemptOutcome(id, true, 0)
+	if err != nil {
+		return false, 0, fmt.Errorf("Failed on call to setLoginAttemptOutcome in Login, %v", err)
+	}
+	return true, 0, nil
+}
+
+// throttleLogin counts rejected attempt in entry of account and IP from current window, so throttled client
+// does not add a row with every request.
+func (env Env) throttleLogin(username, ip string, now time.Time, wait time.Duration) (bool, time.Duration, error) {
+	log.Warn(fmt.Sprintf("Login of %v from %v throttled for %v", username, ip, wait))
+	added, err := env.addThrottledLogin(username, ip, now.Add(-LoginWindow), now)
+	if err != nil {
+		return false, 0, fmt.Errorf("Failed on call to addThrottledLogin in throttleLogin, %v", err)
+	}
+	if !added {
+		_, err = env.insertLoginAttempt(LoginAttempt{Username: username, IP: ip, Throttled: 1, AttemptedAt: now})
+		if err != nil {
+			return false, 0, fmt.Errorf("Failed on call to insertLoginAttempt in throttleLogin, %v", err)
+		}
+	}
+	return false, wait, ErrLoginThrottled
+}
+
+// PruneLoginAttempts removes attempts older than LoginAttemptRetention.
+func (env Env) PruneLoginAttempts(now time.Time) (int64, error) {
+	return env.pruneLoginAttempts(now.Add(-LoginAttemptRetention))
+}
+
+// loginWait is the longer of account and IP delays. Failures of account are counted since its last successful login,
+// failures from IP are counted regardless, so attacker cannot reset them by logging into own account.
+func (env Env) loginWait(username, ip string, now time.Time) (time.Duration, error) {
+	return env.loginWaitExcept(username, ip, now, 0)
+}
+
+// loginWaitExcept does not count attempt with given id, which is the one being checked.
+func (env Env) loginWaitExcept(username, ip string, now time.Time, id int) (time.Duration, error) {
+	after := now.Add(-LoginWindow)
+	succeeded, err := env.GetLoginAttempts(LoginAttemptFilter{Username: username, SucceededOnly: true, After: after, Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to GetLoginAttempts for last success in loginWait, %v", err)
+	}
+	accountAfter := after
+	if len(succeeded) == 1 {
+		accountAfter = succeeded[0].AttemptedAt
+	}
+	failures, err := env.GetLoginAttempts(LoginAttemptFilter{Username: username, FailedOnly: true, After: accountAfter, Limit: accountFreeFailures + countedFailures + 1})
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to GetLoginAttempts for account in loginWait, %v", err)
+	}
+	wait := throttleWait(withoutAttempt(failures, id), accountFreeFailures, now)
+	failures, err = env.GetLoginAttempts(LoginAttemptFilter{IP: ip, FailedOnly: true, After: after, Limit: ipFreeFailures + countedFailures + 1})
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to GetLoginAttempts for IP in loginWait, %v", err)
+	}
+	if ipWait := throttleWait(withoutAttempt(failures, id), ipFreeFailures, now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait, nil
+}
+
+func withoutAttempt(attempts []LoginAttempt, id int) []LoginAttempt {
+	others := []LoginAttempt{}
+	for _, a := range attempts {
+		if a.ID != id {
+			others = append(others, a)
+		}
+	}
+	return others
+}
+
+// throttleWait doubles delay after the newest failure with every failure above free ones, up to LoginWindow.
+func throttleWait(failures []LoginAttempt, free int, now time.Time) time.Duration {
+	if len(failures) < free {
+		return 0
+	}
+	delay := LoginWindow
+	if n := len(failures) - free; n < 16 && time.Second<<uint(n) < LoginWindow {
+		delay = time.Second << uint(n)
+	}
+	return failures[0].AttemptedAt.Add(delay).Sub(now)
+}
+
+// checkCredentials compares password with a hash also for missing user, so response time does not tell whether user exists.
+func (env Env) checkCredentials(username, password string) (bool, error) {
+	present, err := env.UserIsPresent(username)
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to UserIsPresent in checkCredentials, %v", err)
+	}
+	if !present {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcryptCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false, nil
+	}
+	return env.PasswordIsCorrect(username, password)
+}
+
+func (s sqlStore) insertLoginAttempt(a LoginAttempt) (int, error) {
+	id, err := s.insertReturningID("INSERT INTO login_attempts (username, ip, succeeded, throttled, attempted_at) VALUES (?, ?, ?, ?, ?)", a.Username, a.IP, a.Succeeded, a.Throttled, a.AttemptedAt.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("Failed on inserting login attempt in insertLoginAttempt, %v", err)
+	}
+	return id, nil
+}
+
+func (s sqlStore) setLoginAttemptOutcome(id int, succeeded bool, throttled int) error {
+	_, err := s.exec("UPDATE login_attempts SET succeeded=?, throttled=? WHERE id=?", succeeded, throttled, id)
+	if err != nil {
+		return fmt.Errorf("Failed on updating login attempt %v in setLoginAttemptOutcome, %v", id, err)
+	}
+	return nil
+}
+
+// addThrottledLogin counts throttled attempt in entry of account and IP attempted after given time, false is returned when there is none.
+func (s sqlStore) addThrottledLogin(username, ip string, after, now time.Time) (bool, error) {
+	res, err := s.exec("UPDATE login_attempts SET throttled=throttled+1, attempted_at=? WHERE username=? AND ip=? AND throttled>0 AND attempted_at >?", now.UTC(), username, ip, after.UTC())
+	if err != nil {
+		return false, fmt.Errorf("Failed on updating login attempts in addThrottledLogin, %v", err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to RowsAffected in addThrottledLogin, %v", err)
+	}
+	return updated > 0, nil
+}
+
+func (s sqlStore) GetLoginAttempts(filter LoginAttemptFilter) ([]LoginAttempt, error) {
+	query := "SELECT id, username, ip, succeeded, throttled, attempted_at FROM login_attempts WHERE 1=1"
+	args := []interface{}{}
+	if filter.Username != "" {
+		query += " AND username=?"
+		args = append(args, filter.Username)
+	}
+	if filter.IP != "" {
+		query += " AND ip=?"
+		args = append(args, filter.IP)
+	}
+	if filter.FailedOnly {
+		query += " AND succeeded=? AND throttled=?"
+		args = append(args, false, 0)
+	}
+	if filter.SucceededOnly {
+		query += " AND succeeded=?"
+		args = append(args, true)
+	}
+	if !filter.After.IsZero() {
+		query += " AND attempted_at >?"
+		args = append(args, filter.After.UTC())
+	}
+	query += " ORDER BY attempted_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(filter.Limit)
+	}
+	attempts := []LoginAttempt{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting login attempts in GetLoginAttempts, %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := LoginAttempt{}
+		if err := rows.Scan(&a.ID, &a.Username, &a.IP, &a.Succeeded, &a.Throttled, &a.AttemptedAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in GetLoginAttempts on %v", err)
+		}
+		a.AttemptedAt = a.AttemptedAt.UTC()
+		attempts = append(attempts, a)
+	}
+	return attempts, nil
+}
+
+func (s sqlStore) pruneLoginAttempts(before time.Time) (int64, error) {
+	return s.prune("login_attempts", "attempted_at", before, false)
+}
+
+func (m *memoryStore) insertLoginAttempt(a LoginAttempt) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastLoginAttemptID++
+	a.ID = m.lastLoginAttemptID
+	m.loginAttempts = append(m.loginAttempts, a)
+	return a.ID, nil
+}
+
+func (m *memoryStore) setLoginAttemptOutcome(id int, succeeded bool, throttled int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.loginAttempts {
+		if m.loginAttempts[i].ID == id {
+			m.loginAttempts[i].Succeeded, m.loginAttempts[i].Throttled = succeeded, throttled
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) addThrottledLogin(username, ip string, after, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, a := range m.loginAttempts {
+		if a.Username == username && a.IP == ip && a.Throttled > 0 && a.AttemptedAt.After(after) {
+			a.Throttled++
+			a.AttemptedAt = now
+			//Entry is moved to the end to keep attempts in order of time
+			m.loginAttempts = append(append(m.loginAttempts[:i:i], m.loginAttempts[i+1:]...), a)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStore) GetLoginAttempts(filter LoginAttemptFilter) ([]LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempts := []LoginAttempt{}
+	//Attempts are appended in order of time
+	for i := len(m.loginAttempts) - 1; i >= 0; i-- {
+		a := m.loginAttempts[i]
+		if (filter.Username != "" && a.Username != filter.Username) || (filter.IP != "" && a.IP != filter.IP) ||
+			(filter.FailedOnly && (a.Succeeded || a.Throttled > 0)) || (filter.SucceededOnly && !a.Succeeded) || !a.AttemptedAt.After(filter.After) {
+			continue
+		}
+		if filter.Limit > 0 && len(attempts) == filter.Limit {
+			break
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, nil
+}
+
+func (m *memoryStore) pruneLoginAttempts(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.loginAttempts[:0]
+	for _, a := range m.loginAttempts {
+		if !a.AttemptedAt.Before(before) {
+			kept = append(kept, a)
+		}
+	}
+	deleted := int64(len(m.loginAttempts) - len(kept))
+	m.loginAttempts = kept
+	return deleted, nil
+}
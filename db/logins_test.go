@@ -0,0 +1,164 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottling(t *testing.T) {
+	env := setupEnv()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < accountFreeFailures; i++ {
+		_, err := env.insertLoginAttempt(LoginAttempt{Username: "abc32", IP: "10.0.0.1", AttemptedAt: now.Add(time.Duration(i-accountFreeFailures) * time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait, err := env.loginWait("abc32", "10.0.0.2", now)
+	if err != nil || wait != 0 {
+		t.Fatalf("Account should be free a second after last failure, got %v, %v", wait, err)
+	}
+	wait, err = env.loginWait("abc32", "10.0.0.2", now.Add(-500*time.Millisecond))
+	if err != nil || wait != 500*time.Millisecond {
+		t.Fatalf("Account should be throttled for a second after last failure, got %v, %v", wait, err)
+	}
+	wait, err = env.loginWait("abc33", "10.0.0.1", now.Add(-500*time.Millisecond))
+	if err != nil || wait != 0 {
+		t.Fatalf("IP should not be throttled below its free failures, got %v, %v", wait, err)
+	}
+	attempts, err := env.GetLoginAttempts(LoginAttemptFilter{FailedOnly: true, IP: "10.0.0.1", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0].Username != "abc32" || !attempts[0].AttemptedAt.Equal(now.Add(-time.Second)) {
+		t.Fatalf("Unexpected login attempts %v", attempts)
+	}
+}
+
+func TestThrottledLoginIsLogged(t *testing.T) {
+	env := setupEnv()
+	//Failures are in the future, so account is throttled regardless of how long the test takes
+	future := time.Now().UTC().Add(time.Minute)
+	for i := 0; i < accountFreeFailures; i++ {
+		_, err := env.insertLoginAttempt(LoginAttempt{Username: "abc37", IP: "10.0.0.5", AttemptedAt: future})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		correct, wait, err := env.Login("abc37", "abc37", "10.0.0.6")
+		if err != ErrLoginThrottled || correct || wait <= 0 {
+			t.Fatalf("Account should be throttled, got %v, %v, %v", correct, wait, err)
+		}
+	}
+	attempts, err := env.GetLoginAttempts(LoginAttemptFilter{IP: "10.0.0.6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 1 || attempts[0].Throttled != 3 || attempts[0].Succeeded || attempts[0].Username != "abc37" {
+		t.Fatalf("Throttled logins should be counted in one entry, got %v", attempts)
+	}
+	attempts, err = env.GetLoginAttempts(LoginAttemptFilter{FailedOnly: true, IP: "10.0.0.6"})
+	if err != nil || len(attempts) != 0 {
+		t.Fatalf("Throttled login should not count as failure, got %v, %v", attempts, err)
+	}
+}
+
+func TestConcurrentLoginsAreThrottled(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc38", "abc38", "abc38")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	checked := 0
+	for i := 0; i < 4*accountFreeFailures; i++ {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			correct, _, err := env.Login("abc38", "wrong", ip)
+			if correct || (err != nil && err != ErrLoginThrottled) {
+				t.Errorf("Wrong password should fail, got %v, %v", correct, err)
+			}
+			if err == nil {
+				mu.Lock()
+				checked++
+				mu.Unlock()
+			}
+		}(fmt.Sprintf("10.0.1.%v", i))
+	}
+	wg.Wait()
+	if checked == 0 || checked > accountFreeFailures {
+		t.Fatalf("At most %v concurrent guesses should be checked, got %v", accountFreeFailures, checked)
+	}
+	failures, err := env.GetLoginAttempts(LoginAttemptFilter{Username: "abc38", FailedOnly: true})
+	if err != nil || len(failures) != checked {
+		t.Fatalf("Only checked guesses should be failures, got %v, %v", failures, err)
+	}
+}
+
+func TestLoginWaitResets(t *testing.T) {
+	env := setupEnv()
+	now := time.Now().UTC()
+	for i := 0; i < 3*accountFreeFailures; i++ {
+		_, err := env.insertLoginAttempt(LoginAttempt{Username: "abc34", IP: "10.0.0.3", AttemptedAt: now.Add(-3 * time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait, err := env.loginWait("abc34", "10.0.0.4", now)
+	if err != nil || wait <= 0 {
+		t.Fatalf("Account should be throttled, got %v, %v", wait, err)
+	}
+	_, err = env.insertLoginAttempt(LoginAttempt{Username: "abc34", IP: "10.0.0.3", Succeeded: true, AttemptedAt: now.Add(-2 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait, err = env.loginWait("abc34", "10.0.0.4", now)
+	if err != nil || wait > 0 {
+		t.Fatalf("Successful login should reset account failures, got %v, %v", wait, err)
+	}
+	for i := 0; i < ipFreeFailures; i++ {
+		_, err := env.insertLoginAttempt(LoginAttempt{Username: "abc35", IP: "10.0.0.3", AttemptedAt: now.Add(-time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait, err = env.loginWait("abc36", "10.0.0.3", now)
+	if err != nil || wait <= 0 {
+		t.Fatalf("IP should stay throttled after successful login, got %v, %v", wait, err)
+	}
+	wait, err = env.loginWait("abc36", "10.0.0.3", now.Add(LoginWindow))
+	if err != nil || wait > 0 {
+		t.Fatalf("Failures out of window should not count, got %v, %v", wait, err)
+	}
+}
+
+func TestThrottleWait(t *testing.T) {
+	now := time.Now()
+	failures := func(n int) []LoginAttempt {
+		attempts := make([]LoginAttempt, n)
+		for i := range attempts {
+			attempts[i].AttemptedAt = now
+		}
+		return attempts
+	}
+	for _, c := range []struct {
+		failures int
+		wait     time.Duration
+	}{
+		{4, 0},
+		{5, time.Second},
+		{8, 8 * time.Second},
+		{14, 512 * time.Second},
+		{15, LoginWindow},
+		{100, LoginWindow},
+	} {
+		if wait := throttleWait(failures(c.failures), 5, now); wait != c.wait {
+			t.Fatalf("Wait after %v failures should be %v, got %v", c.failures, c.wait, wait)
+		}
+	}
+}
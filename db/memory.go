@@ -0,0 +1,93 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryStore keeps all data in process memory, it is meant for tests and small deployments
+// which can afford loosing history on restart.
+type memoryStore struct {
+	mu                  sync.Mutex
+	keywords            []Keyword
+	keywordRenames      []KeywordRename
+	keywordTags         []keywordTag
+	watchlist           []followedKeyword
+	alertRules          []AlertRule
+	lastAlertRuleID     int
+	alertDeliveries     []AlertDelivery
+	lastAlertDeliveryID int
+	digestSubscriptions []digestSubscription
+	analyzes            []Analyzis
+	texts               []Text
+	lastTextID          int
+	users               []User
+	adminClaimed        bool
+	userIdentities      []userIdentity
+	sessions            []storedSession
+	lastSessionID       int
+	loginAttempts       []LoginAttempt
+	lastLoginAttemptID  int
+	apiKeys             []storedAPIKey
+	lastAPIKeyID        int
+	invites             []storedInvite
+	lastInviteID        int
+	inviteRedemptions   []inviteRedemption
+	schedules           []Schedule
+	quotaUsage          map[quotaKey]int
+	rollups             map[string]map[rollupKey]Rollup
+}
+
+type quotaKey struct {
+	provider string
+	period   string
+	start    int64
+}
+
+type keywordTag struct {
+	keywordID int
+	tag       string
+}
+
+type storedSession struct {
+	Session
+	tokenHash string
+}
+
+type storedAPIKey struct {
+	APIKey
+	keyHash string
+}
+
+type storedInvite struct {
+	Invite
+	codeHash string
+}
+
+type inviteRedemption struct {
+	inviteID   int
+	userID     int
+	redeemedAt time.Time
+}
+
+type rollupKey struct {
+	keywordID int
+	country   string
+	start     int64
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{quotaUsage: map[quotaKey]int{}, rollups: map[string]map[rollupKey]Rollup{}}
+}
+
+func (m *memoryStore) Migrate(target int) error {
+	return nil
+}
+
+func (m *memoryStore) GetMigrationStatuses() ([]MigrationStatus, error) {
+	return []MigrationStatus{}, nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
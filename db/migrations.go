@@ -0,0 +1,326 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Migration scripts are kept per SQL dialect and named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// every migration has to be provided for all dialects.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+type MigrationStatus struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on reading migrations directory in loadMigrations, %v", err)
+	}
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		fileName := e.Name()
+		parts := strings.SplitN(fileName, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Migration %v has invalid name", fileName)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("Migration %v has invalid version, %v", fileName, err)
+		}
+		content, err := migrationFiles.ReadFile(path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("Failed on reading %v in loadMigrations, %v", fileName, err)
+		}
+		m, present := byVersion[version]
+		if !present {
+			m = &migration{version: version}
+			byVersion[version] = m
+		}
+		switch {
+		case strings.HasSuffix(parts[1], ".up.sql"):
+			m.name = strings.TrimSuffix(parts[1], ".up.sql")
+			m.up = string(content)
+		case strings.HasSuffix(parts[1], ".down.sql"):
+			m.down = string(content)
+		default:
+			return nil, fmt.Errorf("Migration %v is neither up nor down script", fileName)
+		}
+	}
+	migrations := []migration{}
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("Migration %v has to have both up and down script", m.version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// splitStatements splits script on semicolons, except for ones inside $$ quoted postgres blocks.
+func splitStatements(script string) []string {
+	statements := []string{}
+	quoted := false
+	start := 0
+	for i := 0; i < len(script); i++ {
+		switch {
+		case strings.HasPrefix(script[i:], "$$"):
+			quoted = !quoted
+			i++
+		case script[i] == ';' && !quoted:
+			statements = appendStatement(statements, script[start:i])
+			start = i + 1
+		}
+	}
+	return appendStatement(statements, script[start:])
+}
+
+func appendStatement(statements []string, s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return statements
+	}
+	return append(statements, s)
+}
+
+// LatestMigration returns version of the newest known migration.
+func LatestMigration(statuses []MigrationStatus) int {
+	if len(statuses) == 0 {
+		return 0
+	}
+	return statuses[len(statuses)-1].Version
+}
+
+// CurrentMigration returns version of the newest applied migration, 0 if none was applied.
+func CurrentMigration(statuses []MigrationStatus) int {
+	current := 0
+	for _, s := range statuses {
+		if s.Applied {
+			current = s.Version
+		}
+	}
+	return current
+}
+
+func (s sqlStore) initSchemaMigrations() error {
+	timestampType := "DATETIME"
+	if s.dialect == PostgresDriver {
+		timestampType = "TIMESTAMPTZ"
+	}
+	createSchemaMigrations := `
+          CREATE TABLE IF NOT EXISTS schema_migrations (
+          version INT NOT NULL PRIMARY KEY,
+          name TEXT NOT NULL,
+          applied_at ` + timestampType + ` NOT NULL);
+        `
+	_, err := s.exec(createSchemaMigrations)
+	if err != nil {
+		return fmt.Errorf("Failed on executing creation of schema_migrations table, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) appliedMigrations() (map[int]time.Time, error) {
+	applied := map[int]time.Time{}
+	rows, err := s.query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting schema_migrations in appliedMigrations, %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		version := 0
+		appliedAt := time.Time{}
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in appliedMigrations on %v", err)
+		}
+		applied[version] = appliedAt.UTC()
+	}
+	return applied, nil
+}
+
+// migrationLock is key of postgres advisory lock and name of mysql lock held while migrating.
+const (
+	migrationLockID      = 7214563
+	migrationLockName    = "trends_analyzer_migrations"
+	migrationLockTimeout = 10 * time.Minute
+)
+
+// Migrate applies pending migrations up to target version and reverts applied ones above it.
+// Replicas started together migrate one after another, each migration is applied along with its record in one transaction,
+// except for mysql, which commits DDL statements implicitly, so migration failed there has to be repaired by hand.
+func (s sqlStore) Migrate(target int) error {
+	return s.withMigrationLock(func(s sqlStore) error {
+		return s.migrate(target)
+	})
+}
+
+func (s sqlStore) migrate(target int) error {
+	err := s.initSchemaMigrations()
+	if err != nil {
+		return fmt.Errorf("Failed on call to initSchemaMigrations in Migrate, %v", err)
+	}
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return fmt.Errorf("Failed on call to loadMigrations in Migrate, %v", err)
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return fmt.Errorf("Failed on call to appliedMigrations in Migrate, %v", err)
+	}
+	for _, m := range migrations {
+		if _, present := applied[m.version]; present || m.version > target {
+			continue
+		}
+		log.Info(fmt.Sprintf("Applying migration %04d_%v", m.version, m.name))
+		err := s.migrationTx(func(tx sqlStore) error {
+			err := tx.execScript(m.up)
+			if err != nil {
+				return fmt.Errorf("Failed on applying migration %v, %v", m.version, err)
+			}
+			_, err = tx.exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.version, m.name, time.Now().UTC())
+			if err != nil {
+				return fmt.Errorf("Failed on recording migration %v, %v", m.version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, present := applied[m.version]; !present || m.version <= target {
+			continue
+		}
+		log.Info(fmt.Sprintf("Reverting migration %04d_%v", m.version, m.name))
+		err := s.migrationTx(func(tx sqlStore) error {
+			err := tx.execScript(m.down)
+			if err != nil {
+				return fmt.Errorf("Failed on reverting migration %v, %v", m.version, err)
+			}
+			_, err = tx.exec("DELETE FROM schema_migrations WHERE version=?", m.version)
+			if err != nil {
+				return fmt.Errorf("Failed on removing record of migration %v, %v", m.version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationTx runs f in transaction, apart from mysql, where it would be committed by the first DDL statement anyway.
+func (s sqlStore) migrationTx(f func(tx sqlStore) error) error {
+	if s.dialect == MySQLDriver {
+		return f(s)
+	}
+	return s.inTx(f)
+}
+
+// withMigrationLock runs f while no other process migrates the database. Postgres and mysql hold a named lock
+// on dedicated connection, sqlite runs f in one transaction, which takes write lock on begin, see OpenStore.
+func (s sqlStore) withMigrationLock(f func(s sqlStore) error) error {
+	lock, unlock := "", ""
+	args := []interface{}{}
+	switch s.dialect {
+	case SQLiteDriver:
+		return s.inTx(f)
+	case PostgresDriver:
+		lock, unlock = "SELECT pg_advisory_lock(?)", "SELECT pg_advisory_unlock(?)"
+		args = append(args, migrationLockID)
+	case MySQLDriver:
+		lock, unlock = "SELECT GET_LOCK(?, ?)", "SELECT RELEASE_LOCK(?)"
+		args = append(args, migrationLockName, int(migrationLockTimeout.Seconds()))
+	default:
+		return f(s)
+	}
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed on getting connection in withMigrationLock, %v", err)
+	}
+	defer conn.Close()
+	//GET_LOCK returns 1 when lock is taken and 0 on timeout, pg_advisory_lock waits and returns nothing
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, s.rebind(lock), args...).Scan(&locked)
+	if err != nil {
+		return fmt.Errorf("Failed on taking migration lock in withMigrationLock, %v", err)
+	}
+	if s.dialect == MySQLDriver && locked.Int64 != 1 {
+		return fmt.Errorf("Migration lock not taken in %v", migrationLockTimeout)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, s.rebind(unlock), args[:1]...); err != nil {
+			log.Error(fmt.Errorf("Failed on releasing migration lock in withMigrationLock, %v", err))
+		}
+	}()
+	return f(s)
+}
+
+func (s sqlStore) execScript(script string) error {
+	for _, statement := range splitStatements(script) {
+		_, err := s.exec(statement)
+		if err != nil {
+			return fmt.Errorf("Failed on executing %v, %v", statement, err)
+		}
+	}
+	return nil
+}
+
+// GetMigrationStatuses creates schema_migrations table if missing, so it also waits for migration lock.
+func (s sqlStore) GetMigrationStatuses() ([]MigrationStatus, error) {
+	statuses := []MigrationStatus{}
+	err := s.withMigrationLock(func(s sqlStore) error {
+		var err error
+		statuses, err = s.migrationStatuses()
+		return err
+	})
+	return statuses, err
+}
+
+func (s sqlStore) migrationStatuses() ([]MigrationStatus, error) {
+	err := s.initSchemaMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to initSchemaMigrations in GetMigrationStatuses, %v", err)
+	}
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to loadMigrations in GetMigrationStatuses, %v", err)
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to appliedMigrations in GetMigrationStatuses, %v", err)
+	}
+	statuses := []MigrationStatus{}
+	for _, m := range migrations {
+		appliedAt, present := applied[m.version]
+		statuses = append(statuses, MigrationStatus{m.version, m.name, present, appliedAt})
+	}
+	return statuses, nil
+}
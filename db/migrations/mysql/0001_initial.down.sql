@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS quota_usage;
+DROP TABLE IF EXISTS schedules;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS keywords;
+DROP TABLE IF EXISTS analyzes;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS analyzes (
+  id SERIAL NOT NULL PRIMARY KEY,
+  keyword_id INT NOT NULL,
+  country TEXT NOT NULL,
+  timestamp DATETIME NOT NULL,
+  amount_of_tweets INT NOT NULL,
+  amount_of_news INT NOT NULL,
+  reaction_avg FLOAT NOT NULL,
+  reaction_tweets FLOAT NOT NULL,
+  reaction_news FLOAT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS keywords (
+  id SERIAL NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL,
+  provider TEXT NOT NULL,
+  additional_info TEXT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS users (
+  id SERIAL NOT NULL PRIMARY KEY,
+  username TEXT NOT NULL,
+  email TEXT NOT NULL,
+  hash TEXT NOT NULL,
+  token TEXT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS schedules (
+  keyword_id INT NOT NULL PRIMARY KEY,
+  min_interval INT NOT NULL,
+  max_interval INT NOT NULL,
+  next_interval INT NOT NULL,
+  next_run DATETIME NOT NULL);
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+  provider VARCHAR(32) NOT NULL,
+  period VARCHAR(16) NOT NULL,
+  period_start DATETIME NOT NULL,
+  calls INT NOT NULL,
+  PRIMARY KEY (provider, period, period_start));
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS daily_analyzes (
+  keyword_id INT NOT NULL,
+  country VARCHAR(16) NOT NULL,
+  period_start DATETIME NOT NULL,
+  analyzes_count INT NOT NULL,
+  amount_of_tweets INT NOT NULL,
+  amount_of_news INT NOT NULL,
+  reaction_avg_sum DOUBLE NOT NULL,
+  reaction_avg_sum_squares DOUBLE NOT NULL,
+  reaction_avg_weighted_sum DOUBLE NOT NULL,
+  reaction_avg_min DOUBLE NOT NULL,
+  reaction_avg_max DOUBLE NOT NULL,
+  reaction_tweets_sum DOUBLE NOT NULL,
+  reaction_tweets_sum_squares DOUBLE NOT NULL,
+  reaction_tweets_weighted_sum DOUBLE NOT NULL,
+  reaction_tweets_min DOUBLE NOT NULL,
+  reaction_tweets_max DOUBLE NOT NULL,
+  reaction_news_sum DOUBLE NOT NULL,
+  reaction_news_sum_squares DOUBLE NOT NULL,
+  reaction_news_weighted_sum DOUBLE NOT NULL,
+  reaction_news_min DOUBLE NOT NULL,
+  reaction_news_max DOUBLE NOT NULL,
+  PRIMARY KEY (keyword_id, country, period_start));
@@ -0,0 +1,6 @@
+DROP INDEX daily_analyzes_period_start ON daily_analyzes;
+DROP INDEX users_username ON users;
+DROP INDEX keywords_name ON keywords;
+DROP INDEX analyzes_timestamp ON analyzes;
+DROP INDEX analyzes_keyword_id_timestamp ON analyzes;
+DROP TABLE IF EXISTS hourly_analyzes;
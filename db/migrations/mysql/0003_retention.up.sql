@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS hourly_analyzes (
+  keyword_id INT NOT NULL,
+  country VARCHAR(16) NOT NULL,
+  period_start DATETIME NOT NULL,
+  analyzes_count INT NOT NULL,
+  amount_of_tweets INT NOT NULL,
+  amount_of_news INT NOT NULL,
+  reaction_avg_sum DOUBLE NOT NULL,
+  reaction_avg_sum_squares DOUBLE NOT NULL,
+  reaction_avg_weighted_sum DOUBLE NOT NULL,
+  reaction_avg_min DOUBLE NOT NULL,
+  reaction_avg_max DOUBLE NOT NULL,
+  reaction_tweets_sum DOUBLE NOT NULL,
+  reaction_tweets_sum_squares DOUBLE NOT NULL,
+  reaction_tweets_weighted_sum DOUBLE NOT NULL,
+  reaction_tweets_min DOUBLE NOT NULL,
+  reaction_tweets_max DOUBLE NOT NULL,
+  reaction_news_sum DOUBLE NOT NULL,
+  reaction_news_sum_squares DOUBLE NOT NULL,
+  reaction_news_weighted_sum DOUBLE NOT NULL,
+  reaction_news_min DOUBLE NOT NULL,
+  reaction_news_max DOUBLE NOT NULL,
+  PRIMARY KEY (keyword_id, country, period_start));
+
+CREATE INDEX analyzes_keyword_id_timestamp ON analyzes (keyword_id, timestamp);
+
+CREATE INDEX analyzes_timestamp ON analyzes (timestamp);
+
+CREATE INDEX keywords_name ON keywords (name(191));
+
+CREATE INDEX users_username ON users (username(191));
+
+CREATE INDEX daily_analyzes_period_start ON daily_analyzes (period_start);
+
+CREATE INDEX hourly_analyzes_period_start ON hourly_analyzes (period_start);
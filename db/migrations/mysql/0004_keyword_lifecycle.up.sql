@@ -0,0 +1,8 @@
+ALTER TABLE keywords ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active';
+
+CREATE TABLE IF NOT EXISTS keyword_renames (
+  keyword_id INT NOT NULL,
+  name TEXT NOT NULL,
+  renamed_at DATETIME NOT NULL);
+
+CREATE INDEX keyword_renames_keyword_id ON keyword_renames (keyword_id);
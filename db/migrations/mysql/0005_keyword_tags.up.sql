@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS keyword_tags (
+  keyword_id INT NOT NULL,
+  tag VARCHAR(64) NOT NULL,
+  PRIMARY KEY (keyword_id, tag));
+
+CREATE INDEX keyword_tags_tag ON keyword_tags (tag);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN hash_algorithm VARCHAR(16) NOT NULL DEFAULT 'sha1';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS sessions;
+
+ALTER TABLE users ADD COLUMN token VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id INT NOT NULL,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  user_agent TEXT NOT NULL,
+  ip TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  last_used_at DATETIME NOT NULL,
+  expires_at DATETIME NOT NULL);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
+
+CREATE INDEX sessions_expires_at ON sessions (expires_at);
+
+ALTER TABLE users DROP COLUMN token;
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'viewer';
+
+UPDATE users SET role='analyst';
+
+UPDATE users SET role='admin' WHERE id=(SELECT id FROM (SELECT MIN(id) AS id FROM users) AS first_user);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS invite_redemptions;
+
+DROP TABLE IF EXISTS invites;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS invites (
+  id SERIAL NOT NULL PRIMARY KEY,
+  code_hash CHAR(64) NOT NULL UNIQUE,
+  prefix TEXT NOT NULL,
+  role VARCHAR(16) NOT NULL,
+  max_uses INT NOT NULL,
+  uses INT NOT NULL,
+  created_by INT NOT NULL,
+  created_at DATETIME NOT NULL,
+  expires_at DATETIME NOT NULL);
+
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+  invite_id INT NOT NULL,
+  user_id INT NOT NULL,
+  redeemed_at DATETIME NOT NULL);
+
+CREATE INDEX invite_redemptions_invite_id ON invite_redemptions (invite_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+  id SERIAL NOT NULL PRIMARY KEY,
+  username VARCHAR(255) NOT NULL,
+  ip VARCHAR(64) NOT NULL,
+  succeeded BOOLEAN NOT NULL,
+  attempted_at DATETIME NOT NULL);
+
+CREATE INDEX login_attempts_username ON login_attempts (username, attempted_at);
+
+CREATE INDEX login_attempts_ip ON login_attempts (ip, attempted_at);
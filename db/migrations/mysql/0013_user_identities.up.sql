@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  user_id INT NOT NULL,
+  issuer VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  created_at DATETIME NOT NULL,
+  PRIMARY KEY (issuer, subject));
+
+CREATE INDEX user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS watchlist (
+  user_id INT NOT NULL,
+  keyword_id INT NOT NULL,
+  followed_at DATETIME NOT NULL,
+  PRIMARY KEY (user_id, keyword_id));
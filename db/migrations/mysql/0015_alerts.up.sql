@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS alert_rules (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id INT NOT NULL,
+  keyword_id INT NOT NULL,
+  kind VARCHAR(32) NOT NULL,
+  threshold FLOAT NOT NULL,
+  country VARCHAR(64) NOT NULL,
+  webhook_url TEXT NOT NULL,
+  webhook_format VARCHAR(16) NOT NULL,
+  triggered BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at DATETIME NOT NULL,
+  last_triggered_at DATETIME NULL);
+
+CREATE INDEX alert_rules_user_id ON alert_rules (user_id);
+
+CREATE INDEX alert_rules_keyword_id ON alert_rules (keyword_id);
+
+CREATE TABLE IF NOT EXISTS alert_deliveries (
+  id SERIAL NOT NULL PRIMARY KEY,
+  rule_id INT NOT NULL,
+  attempt INT NOT NULL,
+  status_code INT NOT NULL,
+  error TEXT NOT NULL,
+  succeeded BOOLEAN NOT NULL,
+  attempted_at DATETIME NOT NULL);
+
+CREATE INDEX alert_deliveries_rule_id ON alert_deliveries (rule_id, attempted_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS texts (
+  id SERIAL NOT NULL PRIMARY KEY,
+  keyword_id INT NOT NULL,
+  country VARCHAR(64) NOT NULL,
+  text_provider VARCHAR(16) NOT NULL,
+  text TEXT NOT NULL,
+  reaction FLOAT NOT NULL,
+  timestamp DATETIME NOT NULL);
+
+CREATE INDEX texts_keyword_id ON texts (keyword_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+  user_id INT NOT NULL PRIMARY KEY,
+  frequency VARCHAR(16) NOT NULL,
+  last_sent_at DATETIME NULL);
@@ -0,0 +1 @@
+ALTER TABLE schedules ADD COLUMN country VARCHAR(64) NOT NULL DEFAULT 'any';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS admin_bootstrap;
+
+DROP INDEX users_username ON users;
+
+CREATE INDEX users_username ON users (username(191));
@@ -0,0 +1 @@
+ALTER TABLE login_attempts ADD COLUMN throttled INT NOT NULL DEFAULT 0;
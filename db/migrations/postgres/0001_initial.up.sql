@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS analyzes (
+  id BIGSERIAL NOT NULL,
+  keyword_id INT NOT NULL,
+  country TEXT NOT NULL,
+  timestamp TIMESTAMPTZ NOT NULL,
+  amount_of_tweets INT NOT NULL,
+  amount_of_news INT NOT NULL,
+  reaction_avg DOUBLE PRECISION NOT NULL,
+  reaction_tweets DOUBLE PRECISION NOT NULL,
+  reaction_news DOUBLE PRECISION NOT NULL,
+  PRIMARY KEY (id, timestamp));
+
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb') THEN
+    PERFORM create_hypertable('analyzes', 'timestamp', if_not_exists => TRUE);
+  END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS keywords (
+  id SERIAL NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL,
+  provider TEXT NOT NULL,
+  additional_info TEXT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS users (
+  id SERIAL NOT NULL PRIMARY KEY,
+  username TEXT NOT NULL,
+  email TEXT NOT NULL,
+  hash TEXT NOT NULL,
+  token TEXT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS schedules (
+  keyword_id INT NOT NULL PRIMARY KEY,
+  min_interval INT NOT NULL,
+  max_interval INT NOT NULL,
+  next_interval INT NOT NULL,
+  next_run TIMESTAMPTZ NOT NULL);
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+  provider TEXT NOT NULL,
+  period TEXT NOT NULL,
+  period_start TIMESTAMPTZ NOT NULL,
+  calls INT NOT NULL,
+  PRIMARY KEY (provider, period, period_start));
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS daily_analyzes (
+  keyword_id INT NOT NULL,
+  country TEXT NOT NULL,
+  period_start TIMESTAMPTZ NOT NULL,
+  analyzes_count INT NOT NULL,
+  amount_of_tweets INT NOT NULL,
+  amount_of_news INT NOT NULL,
+  reaction_avg_sum DOUBLE PRECISION NOT NULL,
+  reaction_avg_sum_squares DOUBLE PRECISION NOT NULL,
+  reaction_avg_weighted_sum DOUBLE PRECISION NOT NULL,
+  reaction_avg_min DOUBLE PRECISION NOT NULL,
+  reaction_avg_max DOUBLE PRECISION NOT NULL,
+  reaction_tweets_sum DOUBLE PRECISION NOT NULL,
+  reaction_tweets_sum_squares DOUBLE PRECISION NOT NULL,
+  reaction_tweets_weighted_sum DOUBLE PRECISION NOT NULL,
+  reaction_tweets_min DOUBLE PRECISION NOT NULL,
+  reaction_tweets_max DOUBLE PRECISION NOT NULL,
+  reaction_news_sum DOUBLE PRECISION NOT NULL,
+  reaction_news_sum_squares DOUBLE PRECISION NOT NULL,
+  reaction_news_weighted_sum DOUBLE PRECISION NOT NULL,
+  reaction_news_min DOUBLE PRECISION NOT NULL,
+  reaction_news_max DOUBLE PRECISION NOT NULL,
+  PRIMARY KEY (keyword_id, country, period_start));
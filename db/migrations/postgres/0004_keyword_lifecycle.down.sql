@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS keyword_renames;
+
+ALTER TABLE keywords DROP COLUMN status;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id INT NOT NULL,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  user_agent TEXT NOT NULL,
+  ip TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+
+CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at);
+
+ALTER TABLE users DROP COLUMN token;
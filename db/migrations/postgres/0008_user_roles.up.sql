@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer';
+
+UPDATE users SET role='analyst';
+
+UPDATE users SET role='admin' WHERE id=(SELECT MIN(id) FROM users);
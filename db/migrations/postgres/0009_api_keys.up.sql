@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+  id SERIAL NOT NULL PRIMARY KEY,
+  user_id INT NOT NULL,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash CHAR(64) NOT NULL UNIQUE,
+  scopes TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ NULL);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS invites (
+  id SERIAL NOT NULL PRIMARY KEY,
+  code_hash CHAR(64) NOT NULL UNIQUE,
+  prefix TEXT NOT NULL,
+  role TEXT NOT NULL,
+  max_uses INT NOT NULL,
+  uses INT NOT NULL,
+  created_by INT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL);
+
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+  invite_id INT NOT NULL,
+  user_id INT NOT NULL,
+  redeemed_at TIMESTAMPTZ NOT NULL);
+
+CREATE INDEX IF NOT EXISTS invite_redemptions_invite_id ON invite_redemptions (invite_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  user_id INT NOT NULL,
+  issuer TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (issuer, subject));
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS alert_deliveries;
+
+DROP TABLE IF EXISTS alert_rules;
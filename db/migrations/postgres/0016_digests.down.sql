@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS digest_subscriptions;
+
+DROP TABLE IF EXISTS texts;
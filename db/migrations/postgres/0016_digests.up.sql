@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS texts (
+  id SERIAL NOT NULL PRIMARY KEY,
+  keyword_id INT NOT NULL,
+  country TEXT NOT NULL,
+  text_provider TEXT NOT NULL,
+  text TEXT NOT NULL,
+  reaction DOUBLE PRECISION NOT NULL,
+  timestamp TIMESTAMPTZ NOT NULL);
+
+CREATE INDEX IF NOT EXISTS texts_keyword_id ON texts (keyword_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+  user_id INT NOT NULL PRIMARY KEY,
+  frequency TEXT NOT NULL,
+  last_sent_at TIMESTAMPTZ NULL);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS users_username;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username ON users (username);
+
+CREATE TABLE IF NOT EXISTS admin_bootstrap (
+  id INT NOT NULL PRIMARY KEY,
+  claimed BOOLEAN NOT NULL);
+
+INSERT INTO admin_bootstrap (id, claimed) SELECT 1, COUNT(*) > 0 FROM users;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS analyzes (
+  id INTEGER NOT NULL PRIMARY KEY,
+  keyword_id INTEGER NOT NULL,
+  country TEXT NOT NULL,
+  timestamp DATETIME NOT NULL,
+  amount_of_tweets INTEGER NOT NULL,
+  amount_of_news INTEGER NOT NULL,
+  reaction_avg REAL NOT NULL,
+  reaction_tweets REAL NOT NULL,
+  reaction_news REAL NOT NULL);
+
+CREATE TABLE IF NOT EXISTS keywords (
+  id INTEGER NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL,
+  provider TEXT NOT NULL,
+  additional_info TEXT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS users (
+  id INTEGER NOT NULL PRIMARY KEY,
+  username TEXT NOT NULL,
+  email TEXT NOT NULL,
+  hash TEXT NOT NULL,
+  token TEXT NOT NULL);
+
+CREATE TABLE IF NOT EXISTS schedules (
+  keyword_id INTEGER NOT NULL PRIMARY KEY,
+  min_interval INTEGER NOT NULL,
+  max_interval INTEGER NOT NULL,
+  next_interval INTEGER NOT NULL,
+  next_run DATETIME NOT NULL);
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+  provider TEXT NOT NULL,
+  period TEXT NOT NULL,
+  period_start DATETIME NOT NULL,
+  calls INTEGER NOT NULL,
+  PRIMARY KEY (provider, period, period_start));
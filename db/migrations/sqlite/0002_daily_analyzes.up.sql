@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS daily_analyzes (
+  keyword_id INTEGER NOT NULL,
+  country TEXT NOT NULL,
+  period_start DATETIME NOT NULL,
+  analyzes_count INTEGER NOT NULL,
+  amount_of_tweets INTEGER NOT NULL,
+  amount_of_news INTEGER NOT NULL,
+  reaction_avg_sum REAL NOT NULL,
+  reaction_avg_sum_squares REAL NOT NULL,
+  reaction_avg_weighted_sum REAL NOT NULL,
+  reaction_avg_min REAL NOT NULL,
+  reaction_avg_max REAL NOT NULL,
+  reaction_tweets_sum REAL NOT NULL,
+  reaction_tweets_sum_squares REAL NOT NULL,
+  reaction_tweets_weighted_sum REAL NOT NULL,
+  reaction_tweets_min REAL NOT NULL,
+  reaction_tweets_max REAL NOT NULL,
+  reaction_news_sum REAL NOT NULL,
+  reaction_news_sum_squares REAL NOT NULL,
+  reaction_news_weighted_sum REAL NOT NULL,
+  reaction_news_min REAL NOT NULL,
+  reaction_news_max REAL NOT NULL,
+  PRIMARY KEY (keyword_id, country, period_start));
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS daily_analyzes_period_start;
+DROP INDEX IF EXISTS users_username;
+DROP INDEX IF EXISTS keywords_name;
+DROP INDEX IF EXISTS analyzes_timestamp;
+DROP INDEX IF EXISTS analyzes_keyword_id_timestamp;
+DROP TABLE IF EXISTS hourly_analyzes;
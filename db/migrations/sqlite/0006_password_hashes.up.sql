@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN hash_algorithm TEXT NOT NULL DEFAULT 'sha1';
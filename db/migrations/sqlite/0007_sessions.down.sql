@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS sessions;
+
+ALTER TABLE users ADD COLUMN token TEXT NOT NULL DEFAULT '';
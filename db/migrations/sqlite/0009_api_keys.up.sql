@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+  id INTEGER NOT NULL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE,
+  scopes TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  last_used_at DATETIME NULL);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS invites (
+  id INTEGER NOT NULL PRIMARY KEY,
+  code_hash TEXT NOT NULL UNIQUE,
+  prefix TEXT NOT NULL,
+  role TEXT NOT NULL,
+  max_uses INTEGER NOT NULL,
+  uses INTEGER NOT NULL,
+  created_by INTEGER NOT NULL,
+  created_at DATETIME NOT NULL,
+  expires_at DATETIME NOT NULL);
+
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+  invite_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  redeemed_at DATETIME NOT NULL);
+
+CREATE INDEX IF NOT EXISTS invite_redemptions_invite_id ON invite_redemptions (invite_id);
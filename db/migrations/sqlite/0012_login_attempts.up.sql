@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+  id INTEGER NOT NULL PRIMARY KEY,
+  username TEXT NOT NULL,
+  ip TEXT NOT NULL,
+  succeeded BOOLEAN NOT NULL,
+  attempted_at DATETIME NOT NULL);
+
+CREATE INDEX IF NOT EXISTS login_attempts_username ON login_attempts (username, attempted_at);
+
+CREATE INDEX IF NOT EXISTS login_attempts_ip ON login_attempts (ip, attempted_at);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS alert_rules (
+  id INTEGER NOT NULL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  keyword_id INTEGER NOT NULL,
+  kind TEXT NOT NULL,
+  threshold REAL NOT NULL,
+  country TEXT NOT NULL,
+  webhook_url TEXT NOT NULL,
+  webhook_format TEXT NOT NULL,
+  triggered BOOLEAN NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL,
+  last_triggered_at DATETIME NULL);
+
+CREATE INDEX IF NOT EXISTS alert_rules_user_id ON alert_rules (user_id);
+
+CREATE INDEX IF NOT EXISTS alert_rules_keyword_id ON alert_rules (keyword_id);
+
+CREATE TABLE IF NOT EXISTS alert_deliveries (
+  id INTEGER NOT NULL PRIMARY KEY,
+  rule_id INTEGER NOT NULL,
+  attempt INTEGER NOT NULL,
+  status_code INTEGER NOT NULL,
+  error TEXT NOT NULL,
+  succeeded BOOLEAN NOT NULL,
+  attempted_at DATETIME NOT NULL);
+
+CREATE INDEX IF NOT EXISTS alert_deliveries_rule_id ON alert_deliveries (rule_id, attempted_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS texts (
+  id INTEGER NOT NULL PRIMARY KEY,
+  keyword_id INTEGER NOT NULL,
+  country TEXT NOT NULL,
+  text_provider TEXT NOT NULL,
+  text TEXT NOT NULL,
+  reaction REAL NOT NULL,
+  timestamp DATETIME NOT NULL);
+
+CREATE INDEX IF NOT EXISTS texts_keyword_id ON texts (keyword_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+  user_id INTEGER NOT NULL PRIMARY KEY,
+  frequency TEXT NOT NULL,
+  last_sent_at DATETIME NULL);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS admin_bootstrap;
+
+DROP INDEX IF EXISTS users_username;
+
+CREATE INDEX IF NOT EXISTS users_username ON users (username);
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	mysqlMigrations, err := loadMigrations(MySQLDriver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mysqlMigrations) == 0 || mysqlMigrations[0].version != 1 {
+		t.Fatalf("First migration should have version 1, got %v", mysqlMigrations)
+	}
+	for i := 1; i < len(mysqlMigrations); i++ {
+		if mysqlMigrations[i].version <= mysqlMigrations[i-1].version {
+			t.Fatalf("Migrations are not ordered, %v after %v", mysqlMigrations[i].version, mysqlMigrations[i-1].version)
+		}
+	}
+	for _, dialect := range []string{PostgresDriver, SQLiteDriver} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != len(mysqlMigrations) {
+			t.Fatalf("%v has %v migrations, mysql has %v", dialect, len(migrations), len(mysqlMigrations))
+		}
+		for i := range migrations {
+			if migrations[i].version != mysqlMigrations[i].version || migrations[i].name != mysqlMigrations[i].name {
+				t.Fatalf("%v migration %v does not match mysql one %v", dialect, migrations[i].name, mysqlMigrations[i].name)
+			}
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements("CREATE TABLE a (id INT);\n\n  DROP TABLE b;\n")
+	if len(statements) != 2 || statements[0] != "CREATE TABLE a (id INT)" || statements[1] != "DROP TABLE b" {
+		t.Fatalf("Unexpected statements %v", statements)
+	}
+	statements = splitStatements("CREATE TABLE a (id INT);\nDO $$\nBEGIN\n  PERFORM 1;\nEND\n$$;\n")
+	if len(statements) != 2 || statements[1] != "DO $$\nBEGIN\n  PERFORM 1;\nEND\n$$" {
+		t.Fatalf("Unexpected statements %v", statements)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT id FROM keywords WHERE name=? AND provider=?"
+	if rebound := (sqlStore{dialect: MySQLDriver}).rebind(query); rebound != query {
+		t.Fatalf("Query should not be changed for mysql, got %v", rebound)
+	}
+	if rebound := (sqlStore{dialect: PostgresDriver}).rebind(query); rebound != "SELECT id FROM keywords WHERE name=$1 AND provider=$2" {
+		t.Fatalf("Unexpected postgres query %v", rebound)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	driver := testDriver()
+	if driver == MemoryDriver {
+		t.Skip("Memory store is not migrated")
+	}
+	store, err := OpenStore(driver, testDataSource(driver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Migrate(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := store.GetMigrationStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := CurrentMigration(statuses); current != 0 {
+		t.Fatalf("All migrations should be reverted, current is %v", current)
+	}
+	latest := LatestMigration(statuses)
+	err = store.Migrate(latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err = store.GetMigrationStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := CurrentMigration(statuses); current != latest {
+		t.Fatalf("Current migration %v is not equal to latest %v", current, latest)
+	}
+}
+
+func TestConcurrentMigrate(t *testing.T) {
+	driver := testDriver()
+	if driver == MemoryDriver {
+		t.Skip("Memory store is not migrated")
+	}
+	//Separate stores stand for replicas started together
+	stores := []Store{}
+	for i := 0; i < 2; i++ {
+		store, err := OpenStore(driver, testDataSource(driver))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, store)
+	}
+	err := stores[0].Migrate(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := stores[0].GetMigrationStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := LatestMigration(statuses)
+	errs := make(chan error, len(stores))
+	for _, store := range stores {
+		go func(store Store) {
+			errs <- store.Migrate(latest)
+		}(store)
+	}
+	for range stores {
+		if err := <-errs; err != nil {
+			t.Fatalf("Concurrent migrations should not fail, got %v", err)
+		}
+	}
+	statuses, err = stores[1].GetMigrationStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := CurrentMigration(statuses); current != latest {
+		t.Fatalf("Current migration %v is not equal to latest %v", current, latest)
+	}
+}
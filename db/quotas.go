@@ -0,0 +1,265 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	TwitterProvider      = "twitter"
+	NewsProvider         = "news"
+	AlphaVantageProvider = "alphavantage"
+	perDay               = "day"
+	perMinute            = "minute"
+)
+
+var ErrQuotaExhausted = errors.New("quota exhausted")
+
+// QuotaLimits holds maximal amount of calls to provider, zero means no limit.
+type QuotaLimits struct {
+	PerDay    int `json:"per_day"`
+	PerMinute int `json:"per_minute"`
+}
+
+func NewQuotaLimits(perDay, perMinute int) QuotaLimits {
+	return QuotaLimits{perDay, perMinute}
+}
+
+type QuotaBudget struct {
+	Provider  string    `json:"provider"`
+	Period    string    `json:"period"`
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+type quotaPeriod struct {
+	name  string
+	limit int
+	start time.Time
+	end   time.Time
+}
+
+func (l QuotaLimits) periods(now time.Time) []quotaPeriod {
+	now = now.UTC()
+	day := now.Truncate(24 * time.Hour)
+	minute := now.Truncate(time.Minute)
+	return []quotaPeriod{
+		{perMinute, l.PerMinute, minute, minute.Add(time.Minute)},
+		{perDay, l.PerDay, day, day.Add(24 * time.Hour)},
+	}
+}
+
+// ConsumeQuota counts a single call to provider, returns ErrQuotaExhausted if any of provider's budgets is used up.
+func (env Env) ConsumeQuota(provider string) error {
+	return env.ConsumeQuotas(provider)
+}
+
+// ConsumeQuotas counts a single call to each of providers, when any of their budgets is used up
+// nothing is counted and ErrQuotaExhausted is returned, so no budget is spent on call which is not made.
+func (env Env) ConsumeQuotas(providers ...string) error {
+	consumed := map[string][]quotaPeriod{}
+	for _, provider := range providers {
+		periods, err := env.consumeQuota(provider)
+		if err == nil {
+			consumed[provider] = periods
+			continue
+		}
+		for consumedProvider, periods := range consumed {
+			releaseErr := env.releaseQuota(consumedProvider, periods)
+			if releaseErr != nil {
+				return fmt.Errorf("Failed on call to releaseQuota for %v in ConsumeQuotas, %v", consumedProvider, releaseErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// consumeQuota counts a single call to provider in all its limited periods and returns them.
+func (env Env) consumeQuota(provider string) ([]quotaPeriod, error) {
+	limits, present := env.quotas[provider]
+	if !present {
+		return nil, nil
+	}
+	consumed := []quotaPeriod{}
+	for _, p := range limits.periods(time.Now()) {
+		if p.limit == 0 {
+			continue
+		}
+		ok, err := env.consumeQuotaPeriod(provider, p)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on call to consumeQuotaPeriod for %v in consumeQuota, %v", provider, err)
+		}
+		if !ok {
+			err := env.releaseQuota(provider, consumed)
+			if err != nil {
+				return nil, fmt.Errorf("Failed on call to releaseQuota for %v in consumeQuota, %v", provider, err)
+			}
+			log.Debug(fmt.Sprintf("%v quota for %v exhausted", p.name, provider))
+			return nil, ErrQuotaExhausted
+		}
+		consumed = append(consumed, p)
+	}
+	return consumed, nil
+}
+
+func (env Env) releaseQuota(provider string, periods []quotaPeriod) error {
+	for _, p := range periods {
+		err := env.releaseQuotaPeriod(provider, p)
+		if err != nil {
+			return fmt.Errorf("Failed on call to releaseQuotaPeriod for %v, %v", provider, err)
+		}
+	}
+	return nil
+}
+
+func (s sqlStore) consumeQuotaPeriod(provider string, p quotaPeriod) (bool, error) {
+	return s.consumeQuotaPeriodWithRetry(provider, p, true)
+}
+
+func (s sqlStore) consumeQuotaPeriodWithRetry(provider string, p quotaPeriod, retry bool) (bool, error) {
+	res, err := s.exec("UPDATE quota_usage SET calls=calls+1 WHERE provider=? AND period=? AND period_start=? AND calls<?", provider, p.name, p.start, p.limit)
+	if err != nil {
+		return false, fmt.Errorf("Failed on updating quota_usage in consumeQuotaPeriod, %v", err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to RowsAffected in consumeQuotaPeriod, %v", err)
+	}
+	if updated != 0 {
+		return true, nil
+	}
+	_, present, err := s.getQuotaUsage(provider, p)
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to getQuotaUsage in consumeQuotaPeriod, %v", err)
+	}
+	if present {
+		return false, nil
+	}
+	_, err = s.exec("INSERT INTO quota_usage (provider, period, period_start, calls) VALUES (?, ?, ?, 1)", provider, p.name, p.start)
+	if err != nil {
+		//Row for this period could have been inserted concurrently
+		if retry {
+			return s.consumeQuotaPeriodWithRetry(provider, p, false)
+		}
+		return false, fmt.Errorf("Failed on inserting to quota_usage in consumeQuotaPeriod, %v", err)
+	}
+	return true, nil
+}
+
+func (s sqlStore) releaseQuotaPeriod(provider string, p quotaPeriod) error {
+	_, err := s.exec("UPDATE quota_usage SET calls=calls-1 WHERE provider=? AND period=? AND period_start=?", provider, p.name, p.start)
+	if err != nil {
+		return fmt.Errorf("Failed on releasing %v quota for %v in releaseQuotaPeriod, %v", p.name, provider, err)
+	}
+	return nil
+}
+
+func (s sqlStore) getQuotaUsage(provider string, p quotaPeriod) (int, bool, error) {
+	rows, err := s.query("SELECT calls FROM quota_usage WHERE provider=? AND period=? AND period_start=?", provider, p.name, p.start)
+	if err != nil {
+		return 0, false, fmt.Errorf("Failed on selecting quota_usage for %v in getQuotaUsage, %v", provider, err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, false, nil
+	}
+	calls := 0
+	if err := rows.Scan(&calls); err != nil {
+		return 0, false, fmt.Errorf("Rows scan failed in getQuotaUsage on %v", err)
+	}
+	return calls, true, nil
+}
+
+// QuotaAvailable checks whether provider can be called at least once without exceeding its budgets.
+func (env Env) QuotaAvailable(provider string) (bool, error) {
+	limits, present := env.quotas[provider]
+	if !present {
+		return true, nil
+	}
+	for _, p := range limits.periods(time.Now()) {
+		if p.limit == 0 {
+			continue
+		}
+		calls, _, err := env.getQuotaUsage(provider, p)
+		if err != nil {
+			return false, fmt.Errorf("Failed on call to getQuotaUsage in QuotaAvailable, %v", err)
+		}
+		if calls >= p.limit {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (env Env) GetQuotaBudgets() ([]QuotaBudget, error) {
+	budgets := []QuotaBudget{}
+	now := time.Now()
+	for provider, limits := range env.quotas {
+		for _, p := range limits.periods(now) {
+			if p.limit == 0 {
+				continue
+			}
+			calls, _, err := env.getQuotaUsage(provider, p)
+			if err != nil {
+				return nil, fmt.Errorf("Failed on call to getQuotaUsage in GetQuotaBudgets, %v", err)
+			}
+			remaining := p.limit - calls
+			if remaining < 0 {
+				remaining = 0
+			}
+			budgets = append(budgets, QuotaBudget{provider, p.name, p.limit, calls, remaining, p.end})
+		}
+	}
+	return budgets, nil
+}
+
+// PruneQuotaUsage removes counters of periods started before given time.
+func (s sqlStore) PruneQuotaUsage(before time.Time) error {
+	_, err := s.exec("DELETE FROM quota_usage WHERE period_start<?", before.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on deleting from quota_usage in PruneQuotaUsage, %v", err)
+	}
+	return nil
+}
+
+func (m *memoryStore) consumeQuotaPeriod(provider string, p quotaPeriod) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := quotaKey{provider, p.name, p.start.Unix()}
+	if m.quotaUsage[key] >= p.limit {
+		return false, nil
+	}
+	m.quotaUsage[key]++
+	return true, nil
+}
+
+func (m *memoryStore) releaseQuotaPeriod(provider string, p quotaPeriod) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quotaUsage[quotaKey{provider, p.name, p.start.Unix()}]--
+	return nil
+}
+
+func (m *memoryStore) getQuotaUsage(provider string, p quotaPeriod) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	calls, present := m.quotaUsage[quotaKey{provider, p.name, p.start.Unix()}]
+	return calls, present, nil
+}
+
+func (m *memoryStore) PruneQuotaUsage(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.quotaUsage {
+		if key.start < before.Unix() {
+			delete(m.quotaUsage, key)
+		}
+	}
+	return nil
+}
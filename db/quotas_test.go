@@ -0,0 +1,83 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestConsumeQuota(t *testing.T) {
+	env := setupEnv()
+	env.quotas = map[string]QuotaLimits{TwitterProvider: NewQuotaLimits(10, 2)}
+	for i := 0; i < 2; i++ {
+		err := env.ConsumeQuota(TwitterProvider)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := env.ConsumeQuota(TwitterProvider)
+	if err != ErrQuotaExhausted {
+		t.Fatalf("Quota should be exhausted, got %v", err)
+	}
+	available, err := env.QuotaAvailable(TwitterProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Fatal("Quota should not be available")
+	}
+	err = env.ConsumeQuota(NewsProvider)
+	if err != nil {
+		t.Fatal("Provider without limits should not be limited")
+	}
+	cleanUp()
+}
+
+func TestGetQuotaBudgets(t *testing.T) {
+	env := setupEnv()
+	env.quotas = map[string]QuotaLimits{NewsProvider: NewQuotaLimits(10, 0)}
+	err := env.ConsumeQuota(NewsProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	budgets, err := env.GetQuotaBudgets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(budgets) != 1 {
+		t.Fatalf("Expected only daily budget, got %v", budgets)
+	}
+	if budgets[0].Used != 1 || budgets[0].Remaining != 9 {
+		t.Fatalf("Unexpected budget %v", budgets[0])
+	}
+	cleanUp()
+}
+
+func TestConsumeQuotas(t *testing.T) {
+	env := setupEnv()
+	env.quotas = map[string]QuotaLimits{TwitterProvider: NewQuotaLimits(10, 5), NewsProvider: NewQuotaLimits(1, 0)}
+	err := env.ConsumeQuotas(TwitterProvider, NewsProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.ConsumeQuotas(TwitterProvider, NewsProvider)
+	if err != ErrQuotaExhausted {
+		t.Fatalf("News quota should be exhausted, got %v", err)
+	}
+	budgets, err := env.GetQuotaBudgets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	twitterBudgets := 0
+	for _, b := range budgets {
+		if b.Provider != TwitterProvider {
+			continue
+		}
+		twitterBudgets++
+		if b.Used != 1 {
+			t.Fatalf("Twitter %v budget should not be spent when news quota is exhausted, got %v", b.Period, b)
+		}
+	}
+	if twitterBudgets != 2 {
+		t.Fatalf("Expected daily and minute budgets of twitter, got %v", budgets)
+	}
+	cleanUp()
+}
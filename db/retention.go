@@ -0,0 +1,129 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetentionPolicy holds for how many days raw analyzes with their texts and hourly rollups are kept, zero means forever.
+// Daily rollups are never removed.
+type RetentionPolicy struct {
+	RawDays    int `json:"raw_days"`
+	HourlyDays int `json:"hourly_days"`
+}
+
+func NewRetentionPolicy(rawDays, hourlyDays int) RetentionPolicy {
+	return RetentionPolicy{rawDays, hourlyDays}
+}
+
+type RetentionReport struct {
+	DryRun               bool      `json:"dry_run"`
+	RawCutoff            time.Time `json:"raw_cutoff"`
+	HourlyCutoff         time.Time `json:"hourly_cutoff"`
+	RollupsRepaired      int       `json:"rollups_repaired"`
+	AnalyzesDeleted      int64     `json:"analyzes_deleted"`
+	TextsDeleted         int64     `json:"texts_deleted"`
+	HourlyRollupsDeleted int64     `json:"hourly_rollups_deleted"`
+}
+
+func retentionCutoff(now time.Time, days int) time.Time {
+	return bucketStart(now.AddDate(0, 0, -days), DayInterval)
+}
+
+// ApplyRetention downsamples analyzes older than policy allows into rollups and deletes them along with their texts,
+// in dry run it only reports what would be done.
+func (env Env) ApplyRetention(policy RetentionPolicy, now time.Time, dryRun bool) (RetentionReport, error) {
+	report := RetentionReport{DryRun: dryRun}
+	if policy.RawDays > 0 {
+		report.RawCutoff = retentionCutoff(now, policy.RawDays)
+		repaired, err := env.downsample(report.RawCutoff, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("Failed on call to downsample in ApplyRetention, %v", err)
+		}
+		report.RollupsRepaired = repaired
+		report.AnalyzesDeleted, err = env.pruneAnalyzes(report.RawCutoff, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("Failed on call to pruneAnalyzes in ApplyRetention, %v", err)
+		}
+		report.TextsDeleted, err = env.pruneTexts(report.RawCutoff, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("Failed on call to pruneTexts in ApplyRetention, %v", err)
+		}
+	}
+	if policy.HourlyDays > 0 {
+		report.HourlyCutoff = retentionCutoff(now, policy.HourlyDays)
+		deleted, err := env.pruneRollups(HourInterval, report.HourlyCutoff, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("Failed on call to pruneRollups in ApplyRetention, %v", err)
+		}
+		report.HourlyRollupsDeleted = deleted
+	}
+	return report, nil
+}
+
+// downsample makes sure analyzes started before cutoff are counted in rollups before they are deleted,
+// rollups missing some of them, e.g. created before rollups were introduced, are recomputed.
+func (env Env) downsample(cutoff time.Time, dryRun bool) (int, error) {
+	keywords, err := env.GetKeywords()
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to GetKeywords in downsample, %v", err)
+	}
+	repaired := 0
+	for _, k := range keywords {
+		analyzes, err := env.GetKeywordAnalyzes(k.ID, time.Time{}, cutoff.Add(-time.Nanosecond), "any")
+		if err != nil {
+			return 0, fmt.Errorf("Failed on call to GetKeywordAnalyzes for %v in downsample, %v", k.Name, err)
+		}
+		if len(analyzes) == 0 {
+			continue
+		}
+		for _, interval := range rollupIntervals {
+			stored, err := env.GetKeywordRollups(interval, k.ID, bucketStart(analyzes[0].Timestamp, interval), cutoff, "any")
+			if err != nil {
+				return 0, fmt.Errorf("Failed on call to GetKeywordRollups for %v in downsample, %v", k.Name, err)
+			}
+			counts := map[rollupKey]int{}
+			for _, r := range stored {
+				counts[rollupKey{r.KeywordID, r.Country, r.Start.Unix()}] = r.Count
+			}
+			for _, r := range rollUp(analyzes, k.ID, interval) {
+				if counts[rollupKey{r.KeywordID, r.Country, r.Start.Unix()}] >= r.Count {
+					continue
+				}
+				repaired++
+				if dryRun {
+					continue
+				}
+				err := env.deleteRollup(interval, r)
+				if err != nil {
+					return 0, fmt.Errorf("Failed on call to deleteRollup for %v in downsample, %v", k.Name, err)
+				}
+				err = env.mergeRollup(interval, r)
+				if err != nil {
+					return 0, fmt.Errorf("Failed on call to mergeRollup for %v in downsample, %v", k.Name, err)
+				}
+			}
+		}
+	}
+	return repaired, nil
+}
+
+func (s sqlStore) pruneAnalyzes(before time.Time, dryRun bool) (int64, error) {
+	return s.prune("analyzes", "timestamp", before, dryRun)
+}
+
+func (m *memoryStore) pruneAnalyzes(before time.Time, dryRun bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := []Analyzis{}
+	for _, a := range m.analyzes {
+		if !a.Timestamp.Before(before) {
+			kept = append(kept, a)
+		}
+	}
+	pruned := int64(len(m.analyzes) - len(kept))
+	if !dryRun {
+		m.analyzes = kept
+	}
+	return pruned, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyRetention(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateKeyword(NewKeyword("trend", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keywordID, err := env.GetKeywordID("trend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2018, 3, 20, 12, 0, 0, 0, time.UTC)
+	old := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, a := range []Analyzis{
+		NewAnalyzis(keywordID, "pl", old, 10, 0, 0.5, 0.5, 0),
+		NewAnalyzis(keywordID, "pl", old.Add(30*time.Minute), 30, 0, -0.5, -0.5, 0),
+		NewAnalyzis(keywordID, "pl", now.Add(-time.Hour), 4, 4, 0.25, 0.5, 0),
+	} {
+		err := env.CreateAnalyzis(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = env.CreateTexts([]Text{NewText(keywordID, "pl", "twitter", "old", 0.5, old), NewText(keywordID, "pl", "news", "new", -0.5, now.Add(-time.Hour))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Simulates rollup missing analyzis stored before rollups were maintained
+	err = env.deleteRollup(DayInterval, Rollup{KeywordID: keywordID, Country: "pl", Start: bucketStart(old, DayInterval)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewRetentionPolicy(7, 14)
+	report, err := env.ApplyRetention(policy, now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.AnalyzesDeleted != 2 || report.TextsDeleted != 1 || report.RollupsRepaired != 1 || report.HourlyRollupsDeleted != 1 {
+		t.Fatalf("Unexpected dry run report %+v", report)
+	}
+	analyzes, err := env.GetKeywordAnalyzes(keywordID, time.Time{}, now, "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analyzes) != 3 {
+		t.Fatalf("Dry run should not delete analyzes, got %v", analyzes)
+	}
+	report, err = env.ApplyRetention(policy, now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.AnalyzesDeleted != 2 || report.TextsDeleted != 1 || report.RollupsRepaired != 1 || report.HourlyRollupsDeleted != 1 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	analyzes, err = env.GetKeywordAnalyzes(keywordID, time.Time{}, now, "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analyzes) != 1 {
+		t.Fatalf("Old analyzes should be deleted, got %v", analyzes)
+	}
+	daily, err := env.GetAggregatedAnalyzes("trend", old.Add(-time.Hour), now, "any", DayInterval, WeightedAgg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 2 || daily[0].AmountOfTweets != 40 || daily[0].ReactionTweets != -0.25 {
+		t.Fatalf("Deleted analyzes should be kept in daily rollups, got %v", daily)
+	}
+	hourly, err := env.GetAggregatedAnalyzes("trend", old.Add(-time.Hour), now, "any", HourInterval, AvgAgg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly) != 1 || !hourly[0].Timestamp.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("Only recent hourly rollups should be kept, got %v", hourly)
+	}
+	err = env.RebuildRollups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily, err = env.GetAggregatedAnalyzes("trend", old.Add(-time.Hour), now, "any", DayInterval, WeightedAgg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 2 || daily[0].AmountOfTweets != 40 {
+		t.Fatalf("Rebuild should keep rollups of deleted analyzes, got %v", daily)
+	}
+	cleanUp()
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	AdminRole   = "admin"
+	AnalystRole = "analyst"
+	ViewerRole  = "viewer"
+	DefaultRole = ViewerRole
+)
+
+type Permission string
+
+const (
+	ReadPermission           Permission = "read"
+	AnalyzePermission        Permission = "analyze"
+	ManageKeywordsPermission Permission = "manage_keywords"
+	ManageUsersPermission    Permission = "manage_users"
+)
+
+var rolePermissions = map[string][]Permission{
+	AdminRole:   {ReadPermission, AnalyzePermission, ManageKeywordsPermission, ManageUsersPermission},
+	AnalystRole: {ReadPermission, AnalyzePermission, ManageKeywordsPermission},
+	ViewerRole:  {ReadPermission},
+}
+
+var (
+	ErrInvalidRole  = errors.New("Role not supported")
+	ErrUserNotFound = errors.New("User not found")
+	ErrLastAdmin    = errors.New("Last admin cannot be demoted")
+)
+
+// UserInfo is public part of user.
+type UserInfo struct {
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func (u User) info() UserInfo {
+	return UserInfo{u.id, u.username, u.email, u.role, u.emailVerified}
+}
+
+func ValidRole(role string) bool {
+	_, found := rolePermissions[role]
+	return found
+}
+
+func RoleHasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func (env Env) GetUsers() ([]UserInfo, error) {
+	users, err := env.getAllUsers()
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getAllUsers in GetUsers, %v", err)
+	}
+	infos := []UserInfo{}
+	for _, u := range users {
+		infos = append(infos, u.info())
+	}
+	return infos, nil
+}
+
+// SetUserRole promotes or demotes user, at least one admin always stays.
+func (env Env) SetUserRole(username, role string) (UserInfo, error) {
+	if !ValidRole(role) {
+		return UserInfo{}, ErrInvalidRole
+	}
+	set, err := env.setUserRoleKeepingAdmin(username, role)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to setUserRoleKeepingAdmin in SetUserRole, %v", err)
+	}
+	users, err := env.getUsersWithName(username)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to getUsersWithName in SetUserRole, %v", err)
+	}
+	if len(users) == 0 {
+		return UserInfo{}, ErrUserNotFound
+	}
+	//mysql does not count rows already having given role as affected
+	if !set && users[0].role != role {
+		return UserInfo{}, ErrLastAdmin
+	}
+	return users[0].info(), nil
+}
+
+func (s sqlStore) setUserRole(username, role string) error {
+	_, err := s.exec("UPDATE users SET role=? WHERE username=?", role, username)
+	if err != nil {
+		return fmt.Errorf("failed on updating role of user %v, %v", username, err)
+	}
+	return nil
+}
+
+// setUserRoleKeepingAdmin sets role unless it would demote the last admin, check and update are one statement.
+// Rows of admins are locked first, so concurrent demotions of two last admins do not both see the other one.
+func (s sqlStore) setUserRoleKeepingAdmin(username, role string) (bool, error) {
+	set := false
+	err := s.inTx(func(tx sqlStore) error {
+		//sqlite transactions hold write lock of whole database already, see OpenStore
+		if tx.dialect != SQLiteDriver {
+			rows, err := tx.query("SELECT id FROM users WHERE role=? FOR UPDATE", AdminRole)
+			if err != nil {
+				return fmt.Errorf("failed on locking admins, %v", err)
+			}
+			rows.Close()
+		}
+		//mysql does not allow selecting from updated table, unless it is wrapped in derived table
+		res, err := tx.exec("UPDATE users SET role=? WHERE username=? AND (role<>? OR (SELECT COUNT(*) FROM (SELECT id FROM users WHERE role=?) admins)>1)", role, username, AdminRole, AdminRole)
+		if err != nil {
+			return fmt.Errorf("failed on updating role of user %v, %v", username, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed on reading updated role of user %v, %v", username, err)
+		}
+		set = n > 0
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return set, nil
+}
+
+func (m *memoryStore) setUserRole(username, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.users {
+		if m.users[i].username == username {
+			m.users[i].role = role
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) setUserRoleKeepingAdmin(username, role string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	admins := 0
+	for _, u := range m.users {
+		if u.role == AdminRole {
+			admins++
+		}
+	}
+	set := false
+	for i := range m.users {
+		if m.users[i].username == username && (m.users[i].role != AdminRole || admins > 1) {
+			m.users[i].role = role
+			set = true
+		}
+	}
+	return set, nil
+}
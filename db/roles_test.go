@@ -0,0 +1,141 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestFirstUserIsAdmin(t *testing.T) {
+	env := setupEnv()
+	for _, name := range []string{"abc15", "abc16"} {
+		err := env.CreateUser(name, name, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	users, err := env.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Role != AdminRole || users[1].Role != DefaultRole {
+		t.Fatalf("Only first user should be admin, got %v", users)
+	}
+}
+
+func TestConcurrentFirstUsersYieldOneAdmin(t *testing.T) {
+	env := setupEnv()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			err := env.CreateUser(name, name, name)
+			if err != nil {
+				t.Error(err)
+			}
+		}(fmt.Sprintf("abc%v", 40+i))
+	}
+	wg.Wait()
+	users, err := env.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admins := 0
+	for _, u := range users {
+		if u.Role == AdminRole {
+			admins++
+		}
+	}
+	if len(users) != 8 || admins != 1 {
+		t.Fatalf("Exactly one of concurrent first users should be admin, got %v", users)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	env := setupEnv()
+	for _, name := range []string{"abc17", "abc18"} {
+		err := env.CreateUser(name, name, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := env.SetUserRole("abc17", ViewerRole)
+	if err != ErrLastAdmin {
+		t.Fatalf("Last admin should not be demoted, got %v", err)
+	}
+	_, err = env.SetUserRole("abc18", "owner")
+	if err != ErrInvalidRole {
+		t.Fatalf("Unknown role should fail with ErrInvalidRole, got %v", err)
+	}
+	_, err = env.SetUserRole("abc19", AnalystRole)
+	if err != ErrUserNotFound {
+		t.Fatalf("Unknown user should fail with ErrUserNotFound, got %v", err)
+	}
+	user, err := env.SetUserRole("abc18", AdminRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != AdminRole {
+		t.Fatalf("abc18 should be promoted, got %v", user)
+	}
+	_, err = env.SetUserRole("abc17", AnalystRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := env.CreateSession("abc17", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _, err := env.AuthenticateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Role != AnalystRole || !RoleHasPermission(info.Role, AnalyzePermission) || RoleHasPermission(info.Role, ManageUsersPermission) {
+		t.Fatalf("abc17 should be analyst, got %v", info)
+	}
+}
+
+func TestConcurrentDemotionsKeepAdmin(t *testing.T) {
+	env := setupEnv()
+	names := []string{"abc20", "abc21"}
+	for _, name := range names {
+		err := env.CreateUser(name, name, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = env.SetUserRole(name, AdminRole)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	errs := make(chan error, len(names))
+	for _, name := range names {
+		go func(name string) {
+			_, err := env.SetUserRole(name, ViewerRole)
+			errs <- err
+		}(name)
+	}
+	demoted := 0
+	for range names {
+		err := <-errs
+		if err == nil {
+			demoted++
+		} else if err != ErrLastAdmin {
+			t.Fatal(err)
+		}
+	}
+	users, err := env.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admins := 0
+	for _, u := range users {
+		if u.Role == AdminRole {
+			admins++
+		}
+	}
+	if demoted != 1 || admins != 1 {
+		t.Fatalf("Exactly one of concurrently demoted last admins should stay, got %v", users)
+	}
+}
@@ -0,0 +1,353 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReactionStats holds mergeable statistics of a reaction, weights are amounts of texts the reaction was computed from.
+type ReactionStats struct {
+	Sum         float64 `json:"sum"`
+	SumSquares  float64 `json:"sum_squares"`
+	WeightedSum float64 `json:"weighted_sum"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+}
+
+// Rollup summarizes analyzes of keyword in country started during period beginning at Start.
+type Rollup struct {
+	KeywordID      int           `json:"keyword_id"`
+	Country        string        `json:"country"`
+	Start          time.Time     `json:"start"`
+	Count          int           `json:"count"`
+	AmountOfTweets int           `json:"amount_of_tweets"`
+	AmountOfNews   int           `json:"amount_of_news"`
+	ReactionAvg    ReactionStats `json:"reaction_avg"`
+	ReactionTweets ReactionStats `json:"reaction_tweets"`
+	ReactionNews   ReactionStats `json:"reaction_news"`
+}
+
+func newReactionStats(reaction float32, weight int) ReactionStats {
+	r := float64(reaction)
+	return ReactionStats{r, r * r, r * float64(weight), r, r}
+}
+
+func newRollup(a Analyzis, interval string) Rollup {
+	return Rollup{
+		KeywordID:      a.KeywordID,
+		Country:        a.Country,
+		Start:          bucketStart(a.Timestamp, interval),
+		Count:          1,
+		AmountOfTweets: a.AmountOfTweets,
+		AmountOfNews:   a.AmountOfNews,
+		ReactionAvg:    newReactionStats(a.ReactionAvg, a.AmountOfTweets+a.AmountOfNews),
+		ReactionTweets: newReactionStats(a.ReactionTweets, a.AmountOfTweets),
+		ReactionNews:   newReactionStats(a.ReactionNews, a.AmountOfNews),
+	}
+}
+
+func (s ReactionStats) merge(o ReactionStats, empty bool) ReactionStats {
+	if empty {
+		return o
+	}
+	return ReactionStats{s.Sum + o.Sum, s.SumSquares + o.SumSquares, s.WeightedSum + o.WeightedSum, math.Min(s.Min, o.Min), math.Max(s.Max, o.Max)}
+}
+
+func (r Rollup) merge(o Rollup) Rollup {
+	empty := r.Count == 0
+	r.Count += o.Count
+	r.AmountOfTweets += o.AmountOfTweets
+	r.AmountOfNews += o.AmountOfNews
+	r.ReactionAvg = r.ReactionAvg.merge(o.ReactionAvg, empty)
+	r.ReactionTweets = r.ReactionTweets.merge(o.ReactionTweets, empty)
+	r.ReactionNews = r.ReactionNews.merge(o.ReactionNews, empty)
+	return r
+}
+
+// value aggregates reaction with agg, weighted one falls back to average when there were no texts to weight with.
+func (s ReactionStats) value(agg string, count, weights int) float32 {
+	mean := s.Sum / float64(count)
+	switch agg {
+	case MinAgg:
+		return float32(s.Min)
+	case MaxAgg:
+		return float32(s.Max)
+	case StddevAgg:
+		return float32(math.Sqrt(math.Max(s.SumSquares/float64(count)-mean*mean, 0)))
+	case WeightedAgg:
+		if weights != 0 {
+			return float32(s.WeightedSum / float64(weights))
+		}
+	}
+	return float32(mean)
+}
+
+func (r Rollup) analyzis(agg string) Analyzis {
+	return NewAnalyzis(r.KeywordID, r.Country, r.Start, r.AmountOfTweets, r.AmountOfNews,
+		r.ReactionAvg.value(agg, r.Count, r.AmountOfTweets+r.AmountOfNews),
+		r.ReactionTweets.value(agg, r.Count, r.AmountOfTweets),
+		r.ReactionNews.value(agg, r.Count, r.AmountOfNews))
+}
+
+// mergeRollups merges rollups sorted by start into interval buckets, keywordID and country are set on merged ones.
+func mergeRollups(rollups []Rollup, keywordID int, country, interval string) []Rollup {
+	merged := []Rollup{}
+	for _, r := range rollups {
+		start := bucketStart(r.Start, interval)
+		if len(merged) == 0 || !merged[len(merged)-1].Start.Equal(start) {
+			merged = append(merged, Rollup{KeywordID: keywordID, Country: country, Start: start})
+		}
+		merged[len(merged)-1] = merged[len(merged)-1].merge(r)
+	}
+	return merged
+}
+
+// rollupIntervals are intervals of rollups maintained whenever analyzis is stored.
+var rollupIntervals = []string{HourInterval, DayInterval}
+
+func rollUp(analyzes []Analyzis, keywordID int, interval string) []Rollup {
+	byCountry := map[string][]Rollup{}
+	countries := []string{}
+	for _, a := range analyzes {
+		if _, present := byCountry[a.Country]; !present {
+			countries = append(countries, a.Country)
+		}
+		byCountry[a.Country] = append(byCountry[a.Country], newRollup(a, interval))
+	}
+	rollups := []Rollup{}
+	for _, country := range countries {
+		rollups = append(rollups, mergeRollups(byCountry[country], keywordID, country, interval)...)
+	}
+	return rollups
+}
+
+// RebuildRollups recomputes rollups from stored analyzes. Periods older than the oldest stored analyzis are kept,
+// as their raw analyzes could have been removed by retention, analyzes created meanwhile may be counted twice.
+func (env Env) RebuildRollups() error {
+	keywords, err := env.GetKeywords()
+	if err != nil {
+		return fmt.Errorf("Failed on call to GetKeywords in RebuildRollups, %v", err)
+	}
+	for _, k := range keywords {
+		analyzes, err := env.GetKeywordAnalyzes(k.ID, time.Time{}, time.Now().Add(24*time.Hour), "any")
+		if err != nil {
+			return fmt.Errorf("Failed on call to GetKeywordAnalyzes for %v in RebuildRollups, %v", k.Name, err)
+		}
+		if len(analyzes) == 0 {
+			continue
+		}
+		for _, interval := range rollupIntervals {
+			err := env.deleteRollups(interval, k.ID, bucketStart(analyzes[0].Timestamp, DayInterval))
+			if err != nil {
+				return fmt.Errorf("Failed on call to deleteRollups for %v in RebuildRollups, %v", k.Name, err)
+			}
+			for _, r := range rollUp(analyzes, k.ID, interval) {
+				err := env.mergeRollup(interval, r)
+				if err != nil {
+					return fmt.Errorf("Failed on call to mergeRollup for %v in RebuildRollups, %v", k.Name, err)
+				}
+			}
+		}
+		log.Info(fmt.Sprintf("Rebuilt rollups of %v from %v analyzes", k.Name, len(analyzes)))
+	}
+	return nil
+}
+
+func rollupTable(interval string) string {
+	if interval == HourInterval {
+		return "hourly_analyzes"
+	}
+	return "daily_analyzes"
+}
+
+var reactionColumns = []string{"reaction_avg", "reaction_tweets", "reaction_news"}
+
+func rollupColumns() string {
+	columns := []string{"keyword_id", "country", "period_start", "analyzes_count", "amount_of_tweets", "amount_of_news"}
+	for _, c := range reactionColumns {
+		columns = append(columns, c+"_sum", c+"_sum_squares", c+"_weighted_sum", c+"_min", c+"_max")
+	}
+	return strings.Join(columns, ", ")
+}
+
+func (r Rollup) reactions() []ReactionStats {
+	return []ReactionStats{r.ReactionAvg, r.ReactionTweets, r.ReactionNews}
+}
+
+func (s sqlStore) mergeRollup(interval string, r Rollup) error {
+	return s.mergeRollupWithRetry(interval, r, true)
+}
+
+func (s sqlStore) mergeRollupWithRetry(interval string, r Rollup, retry bool) error {
+	table := rollupTable(interval)
+	set := []string{"analyzes_count=analyzes_count+?", "amount_of_tweets=amount_of_tweets+?", "amount_of_news=amount_of_news+?"}
+	args := []interface{}{r.Count, r.AmountOfTweets, r.AmountOfNews}
+	for i, c := range reactionColumns {
+		stats := r.reactions()[i]
+		set = append(set,
+			c+"_sum="+c+"_sum+?",
+			c+"_sum_squares="+c+"_sum_squares+?",
+			c+"_weighted_sum="+c+"_weighted_sum+?",
+			c+"_min=CASE WHEN ? < "+c+"_min THEN ? ELSE "+c+"_min END",
+			c+"_max=CASE WHEN ? > "+c+"_max THEN ? ELSE "+c+"_max END")
+		args = append(args, stats.Sum, stats.SumSquares, stats.WeightedSum, stats.Min, stats.Min, stats.Max, stats.Max)
+	}
+	args = append(args, r.KeywordID, r.Country, r.Start.UTC())
+	res, err := s.exec("UPDATE "+table+" SET "+strings.Join(set, ", ")+" WHERE keyword_id=? AND country=? AND period_start=?", args...)
+	if err != nil {
+		return fmt.Errorf("Failed on updating %v in mergeRollup, %v", table, err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Failed on call to RowsAffected in mergeRollup, %v", err)
+	}
+	if updated != 0 {
+		return nil
+	}
+	args = []interface{}{r.KeywordID, r.Country, r.Start.UTC(), r.Count, r.AmountOfTweets, r.AmountOfNews}
+	for _, stats := range r.reactions() {
+		args = append(args, stats.Sum, stats.SumSquares, stats.WeightedSum, stats.Min, stats.Max)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	_, err = s.exec("INSERT INTO "+table+" ("+rollupColumns()+") VALUES ("+placeholders+")", args...)
+	if err != nil {
+		//Row for this period could have been inserted concurrently
+		if retry {
+			return s.mergeRollupWithRetry(interval, r, false)
+		}
+		return fmt.Errorf("Failed on inserting to %v in mergeRollup, %v", table, err)
+	}
+	return nil
+}
+
+func (s sqlStore) GetKeywordRollups(interval string, keywordID int, after, before time.Time, country string) ([]Rollup, error) {
+	query := "SELECT " + rollupColumns() + " FROM " + rollupTable(interval) + " WHERE keyword_id=? AND period_start >=? AND period_start <=?"
+	args := []interface{}{keywordID, after.UTC(), before.UTC()}
+	if country != "any" {
+		query += " AND country=?"
+		args = append(args, country)
+	}
+	query += " ORDER BY period_start"
+	rollups := []Rollup{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting %v with %v in GetKeywordRollups, %v", query, args, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := Rollup{}
+		dest := append([]interface{}{&r.KeywordID, &r.Country, &r.Start}, r.scanDestinations()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in GetKeywordRollups on %v", err)
+		}
+		r.Start = r.Start.UTC()
+		rollups = append(rollups, r)
+	}
+	log.Debug(rollups)
+	return rollups, nil
+}
+
+func (r *Rollup) scanDestinations() []interface{} {
+	dest := []interface{}{&r.Count, &r.AmountOfTweets, &r.AmountOfNews}
+	for _, stats := range []*ReactionStats{&r.ReactionAvg, &r.ReactionTweets, &r.ReactionNews} {
+		dest = append(dest, &stats.Sum, &stats.SumSquares, &stats.WeightedSum, &stats.Min, &stats.Max)
+	}
+	return dest
+}
+
+// deleteRollups removes rollups of keyword starting at or after given time.
+func (s sqlStore) deleteRollups(interval string, keywordID int, after time.Time) error {
+	_, err := s.exec("DELETE FROM "+rollupTable(interval)+" WHERE keyword_id=? AND period_start >=?", keywordID, after.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on deleting from %v in deleteRollups, %v", rollupTable(interval), err)
+	}
+	return nil
+}
+
+func (s sqlStore) deleteRollup(interval string, r Rollup) error {
+	_, err := s.exec("DELETE FROM "+rollupTable(interval)+" WHERE keyword_id=? AND country=? AND period_start=?", r.KeywordID, r.Country, r.Start.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on deleting from %v in deleteRollup, %v", rollupTable(interval), err)
+	}
+	return nil
+}
+
+// pruneRollups removes rollups started before given time, only counting them in dry run.
+func (s sqlStore) pruneRollups(interval string, before time.Time, dryRun bool) (int64, error) {
+	return s.prune(rollupTable(interval), "period_start", before, dryRun)
+}
+
+func (m *memoryStore) mergeRollup(interval string, r Rollup) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mergeRollupLocked(interval, r)
+	return nil
+}
+
+// mergeRollupLocked expects m.mu to be held, so rollup is merged together with other changes.
+func (m *memoryStore) mergeRollupLocked(interval string, r Rollup) {
+	key := rollupKey{r.KeywordID, r.Country, r.Start.Unix()}
+	if m.rollups[interval] == nil {
+		m.rollups[interval] = map[rollupKey]Rollup{}
+	}
+	if existing, present := m.rollups[interval][key]; present {
+		r = existing.merge(r)
+	}
+	m.rollups[interval][key] = r
+}
+
+func (m *memoryStore) GetKeywordRollups(interval string, keywordID int, after, before time.Time, country string) ([]Rollup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rollups := []Rollup{}
+	for _, r := range m.rollups[interval] {
+		if r.KeywordID != keywordID || r.Start.Before(after) || r.Start.After(before) {
+			continue
+		}
+		if country != "any" && r.Country != country {
+			continue
+		}
+		rollups = append(rollups, r)
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Start.Before(rollups[j].Start) })
+	return rollups, nil
+}
+
+func (m *memoryStore) deleteRollups(interval string, keywordID int, after time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, r := range m.rollups[interval] {
+		if r.KeywordID == keywordID && !r.Start.Before(after) {
+			delete(m.rollups[interval], key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) deleteRollup(interval string, r Rollup) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rollups[interval], rollupKey{r.KeywordID, r.Country, r.Start.Unix()})
+	return nil
+}
+
+func (m *memoryStore) pruneRollups(interval string, before time.Time, dryRun bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pruned := int64(0)
+	for key, r := range m.rollups[interval] {
+		if !r.Start.Before(before) {
+			continue
+		}
+		pruned++
+		if !dryRun {
+			delete(m.rollups[interval], key)
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRollupMerge(t *testing.T) {
+	ts := time.Date(2018, 3, 14, 10, 0, 0, 0, time.UTC)
+	r := newRollup(NewAnalyzis(1, "pl", ts, 10, 0, 1, 1, 0), DayInterval)
+	r = r.merge(newRollup(NewAnalyzis(1, "pl", ts.Add(time.Hour), 30, 0, -1, -1, 0), DayInterval))
+	if r.Count != 2 || r.AmountOfTweets != 40 || !r.Start.Equal(time.Date(2018, 3, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected merged rollup %v", r)
+	}
+	expected := map[string]float32{AvgAgg: 0, MinAgg: -1, MaxAgg: 1, WeightedAgg: -0.5, StddevAgg: 1}
+	for agg, e := range expected {
+		if v := r.ReactionTweets.value(agg, r.Count, r.AmountOfTweets); math.Abs(float64(v-e)) > 1e-6 {
+			t.Fatalf("%v of reaction tweets should be %v, got %v", agg, e, v)
+		}
+	}
+	if v := r.ReactionNews.value(WeightedAgg, r.Count, r.AmountOfNews); v != 0 {
+		t.Fatalf("Weighted reaction without texts should fall back to average, got %v", v)
+	}
+}
+
+func TestRebuildRollups(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateKeyword(NewKeyword("trend", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keywordID, err := env.GetKeywordID("trend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2018, 3, 14, 0, 0, 0, 0, time.UTC)
+	for _, a := range []Analyzis{
+		NewAnalyzis(keywordID, "pl", day.Add(time.Hour), 10, 2, 0.5, 0.5, 0.5),
+		NewAnalyzis(keywordID, "us", day.Add(2*time.Hour), 20, 4, -0.5, -0.5, -0.5),
+		NewAnalyzis(keywordID, "pl", day.Add(3*time.Hour), 30, 6, 0.25, 0.25, 0.25),
+	} {
+		err := env.CreateAnalyzis(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	incremental, err := env.GetKeywordRollups(DayInterval, keywordID, day, day.Add(24*time.Hour), "pl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.RebuildRollups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := env.GetKeywordRollups(DayInterval, keywordID, day, day.Add(24*time.Hour), "pl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incremental) != 1 || len(rebuilt) != 1 {
+		t.Fatalf("Expected single pl rollup, got %v and %v", incremental, rebuilt)
+	}
+	if incremental[0].Count != 2 || incremental[0].AmountOfNews != 8 || incremental[0].ReactionAvg.Min != 0.25 || incremental[0].ReactionAvg.Max != 0.5 {
+		t.Fatalf("Unexpected incremental rollup %v", incremental[0])
+	}
+	if !rollupAlmostEqual(incremental[0], rebuilt[0]) {
+		t.Fatalf("Rebuilt rollup %v is not equal to incremental one %v", rebuilt[0], incremental[0])
+	}
+	cleanUp()
+}
+
+func rollupAlmostEqual(a, b Rollup) bool {
+	const eps = 1e-6
+	if a.KeywordID != b.KeywordID || a.Country != b.Country || !a.Start.Equal(b.Start) || a.Count != b.Count || a.AmountOfTweets != b.AmountOfTweets || a.AmountOfNews != b.AmountOfNews {
+		return false
+	}
+	for i, s := range a.reactions() {
+		o := b.reactions()[i]
+		for _, d := range []float64{s.Sum - o.Sum, s.SumSquares - o.SumSquares, s.WeightedSum - o.WeightedSum, s.Min - o.Min, s.Max - o.Max} {
+			if math.Abs(d) > eps {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestCreateAnalyzisAtomic(t *testing.T) {
+	env := setupEnv()
+	s, ok := env.Store.(sqlStore)
+	if !ok {
+		t.Skip("Memory store merges rollups under the same lock as analyzis")
+	}
+	_, err := s.exec("ALTER TABLE daily_analyzes RENAME TO daily_analyzes_off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2018, 3, 14, 10, 0, 0, 0, time.UTC)
+	err = env.CreateAnalyzis(NewAnalyzis(1, "pl", ts, 10, 0, 0.5, 0.5, 0))
+	_, renameErr := s.exec("ALTER TABLE daily_analyzes_off RENAME TO daily_analyzes")
+	if renameErr != nil {
+		t.Fatal(renameErr)
+	}
+	if err == nil {
+		t.Fatal("Analyzis should not be created without its daily rollup")
+	}
+	analyzes, err := env.GetKeywordAnalyzes(1, time.Time{}, ts.Add(time.Hour), "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hourly, err := env.GetKeywordRollups(HourInterval, 1, time.Time{}, ts.Add(time.Hour), "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analyzes) != 0 || len(hourly) != 0 {
+		t.Fatalf("Failed analyzis should be rolled back with its rollups, got %v, %v", analyzes, hourly)
+	}
+	cleanUp()
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("Schedule not found")
+	ErrInvalidSchedule  = errors.New("Schedule bounds not valid")
+)
+
+// Schedule tells when keyword is analyzed next, country is the one keyword is analyzed in
+// and the one volatility is measured on.
+type Schedule struct {
+	KeywordID   int       `json:"keyword_id"`
+	MinInterval int       `json:"min_interval"`
+	MaxInterval int       `json:"max_interval"`
+	Interval    int       `json:"interval"`
+	NextRun     time.Time `json:"next_run"`
+	Country     string    `json:"country"`
+}
+
+func NewSchedule(keywordID, minInterval, maxInterval, interval int, nextRun time.Time, country string) Schedule {
+	return Schedule{keywordID, minInterval, maxInterval, interval, nextRun, country}
+}
+
+// ValidCountry tells whether keyword can be analyzed in country, any means texts from everywhere.
+func ValidCountry(country string) bool {
+	switch country {
+	case "any", "pl", "gb", "us", "de", "fr":
+		return true
+	}
+	return false
+}
+
+func (env Env) GetKeywordSchedule(name string) (Schedule, error) {
+	keywordID, err := env.GetKeywordID(name)
+	if err != nil {
+		return Schedule{}, err
+	}
+	schedules, err := env.getKeywordSchedules(keywordID)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Failed on call to getKeywordSchedules in GetKeywordSchedule, %v", err)
+	}
+	if len(schedules) == 0 {
+		return Schedule{}, ErrScheduleNotFound
+	}
+	return schedules[0], nil
+}
+
+// SetKeywordSchedule overrides dispatcher's bounds and country for keyword, current interval is kept within new bounds.
+// Keyword which was not dispatched yet gets schedule due right away.
+func (env Env) SetKeywordSchedule(name string, minInterval, maxInterval int, country string, now time.Time) (Schedule, error) {
+	if minInterval < 1 || maxInterval < minInterval || !ValidCountry(country) {
+		return Schedule{}, ErrInvalidSchedule
+	}
+	s, err := env.GetKeywordSchedule(name)
+	if err == ErrScheduleNotFound {
+		keywordID, err := env.GetKeywordID(name)
+		if err != nil {
+			return Schedule{}, err
+		}
+		s = NewSchedule(keywordID, minInterval, maxInterval, minInterval, now.UTC().Truncate(time.Second), country)
+		err = env.CreateScheduleIfNotPresent(s)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("Failed on call to CreateScheduleIfNotPresent in SetKeywordSchedule, %v", err)
+		}
+		return env.GetKeywordSchedule(name)
+	}
+	if err != nil {
+		return Schedule{}, err
+	}
+	s.MinInterval, s.MaxInterval, s.Country = minInterval, maxInterval, country
+	if s.Interval < minInterval {
+		s.Interval = minInterval
+	}
+	if s.Interval > maxInterval {
+		s.Interval = maxInterval
+	}
+	err = env.UpdateSchedule(s)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("Failed on call to UpdateSchedule in SetKeywordSchedule, %v", err)
+	}
+	return s, nil
+}
+
+func (s sqlStore) CreateScheduleIfNotPresent(schedule Schedule) error {
+	schedules, err := s.getKeywordSchedules(schedule.KeywordID)
+	if err != nil {
+		return fmt.Errorf("Failed on call to getSchedules in CreateScheduleIfNotPresent, %v", err)
+	}
+	if len(schedules) != 0 {
+		return nil
+	}
+	_, err = s.exec("INSERT INTO schedules (keyword_id, min_interval, max_interval, next_interval, next_run, country) VALUES (?, ?, ?, ?, ?, ?)", schedule.KeywordID, schedule.MinInterval, schedule.MaxInterval, schedule.Interval, schedule.NextRun.UTC(), schedule.Country)
+	if err != nil {
+		return fmt.Errorf("Failed on inserting schedule in CreateScheduleIfNotPresent, %v", err)
+	}
+	log.Debug(schedule)
+	return nil
+}
+
+func (s sqlStore) GetSchedules() ([]Schedule, error) {
+	return s.getSchedules("SELECT keyword_id, min_interval, max_interval, next_interval, next_run, country FROM schedules")
+}
+
+func (s sqlStore) getKeywordSchedules(keywordID int) ([]Schedule, error) {
+	return s.getSchedules("SELECT keyword_id, min_interval, max_interval, next_interval, next_run, country FROM schedules WHERE keyword_id=?", keywordID)
+}
+
+func (s sqlStore) UpdateSchedule(schedule Schedule) error {
+	_, err := s.exec("UPDATE schedules SET min_interval=?, max_interval=?, next_interval=?, next_run=?, country=? WHERE keyword_id=?", schedule.MinInterval, schedule.MaxInterval, schedule.Interval, schedule.NextRun.UTC(), schedule.Country, schedule.KeywordID)
+	if err != nil {
+		return fmt.Errorf("Failed on updating schedule for keyword %v in UpdateSchedule, %v", schedule.KeywordID, err)
+	}
+	return nil
+}
+
+func (s sqlStore) getSchedules(query string, args ...interface{}) ([]Schedule, error) {
+	schedules := []Schedule{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting %v with %v in getSchedules, %v", query, args, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		schedule := Schedule{}
+		if err := rows.Scan(&schedule.KeywordID, &schedule.MinInterval, &schedule.MaxInterval, &schedule.Interval, &schedule.NextRun, &schedule.Country); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getSchedules on %v", err)
+		}
+		schedule.NextRun = schedule.NextRun.UTC()
+		schedules = append(schedules, schedule)
+	}
+	log.Debug(schedules)
+	return schedules, nil
+}
+
+func (m *memoryStore) CreateScheduleIfNotPresent(schedule Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.schedules {
+		if s.KeywordID == schedule.KeywordID {
+			return nil
+		}
+	}
+	m.schedules = append(m.schedules, schedule)
+	return nil
+}
+
+func (m *memoryStore) GetSchedules() ([]Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Schedule{}, m.schedules...), nil
+}
+
+func (m *memoryStore) getKeywordSchedules(keywordID int) ([]Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedules := []Schedule{}
+	for _, s := range m.schedules {
+		if s.KeywordID == keywordID {
+			schedules = append(schedules, s)
+		}
+	}
+	return schedules, nil
+}
+
+func (m *memoryStore) UpdateSchedule(schedule Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.schedules {
+		if m.schedules[i].KeywordID == schedule.KeywordID {
+			m.schedules[i] = schedule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreateScheduleIfNotPresent(t *testing.T) {
+	env := setupEnv()
+	nextRun := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	err := env.CreateScheduleIfNotPresent(NewSchedule(1, 5, 120, 20, nextRun, "any"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.CreateScheduleIfNotPresent(NewSchedule(1, 10, 60, 30, nextRun, "pl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedules, err := env.GetSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedules) != 1 {
+		t.Fatalf("Expected one schedule, got %v", schedules)
+	}
+	if schedules[0].MinInterval != 5 || schedules[0].Interval != 20 {
+		t.Fatalf("%v should not be overwritten", schedules[0])
+	}
+	cleanUp()
+}
+
+func TestUpdateSchedule(t *testing.T) {
+	env := setupEnv()
+	nextRun := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	err := env.CreateScheduleIfNotPresent(NewSchedule(1, 5, 120, 20, nextRun, "any"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := NewSchedule(1, 5, 120, 40, nextRun.Add(40*time.Minute), "pl")
+	err = env.UpdateSchedule(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedules, err := env.GetSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedules[0] != updated {
+		t.Fatalf("%v is not equal to %v", schedules[0], updated)
+	}
+	cleanUp()
+}
+
+func TestSetKeywordSchedule(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateKeyword(NewKeyword("orlen", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := env.GetKeywordSchedule("orlen"); err != ErrScheduleNotFound {
+		t.Fatalf("Keyword should not have schedule yet, got %v", err)
+	}
+	s, err := env.SetKeywordSchedule("orlen", 30, 60, "pl", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.MinInterval != 30 || s.MaxInterval != 60 || s.Interval != 30 || s.Country != "pl" || !s.NextRun.Equal(now) {
+		t.Fatalf("Schedule due right away should be created, got %v", s)
+	}
+	s.Interval = 60
+	err = env.UpdateSchedule(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = env.SetKeywordSchedule("orlen", 10, 40, "any", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Interval != 40 || s.Country != "any" {
+		t.Fatalf("Interval should be kept within new bounds, got %v", s)
+	}
+	for _, tc := range []struct{ min, max int }{{0, 10}, {20, 10}} {
+		if _, err := env.SetKeywordSchedule("orlen", tc.min, tc.max, "any", now); err != ErrInvalidSchedule {
+			t.Fatalf("Bounds %v should be rejected, got %v", tc, err)
+		}
+	}
+	if _, err := env.SetKeywordSchedule("orlen", 10, 40, "xx", now); err != ErrInvalidSchedule {
+		t.Fatalf("Unknown country should be rejected, got %v", err)
+	}
+	if _, err := env.SetKeywordSchedule("missing", 10, 40, "any", now); err != ErrKeywordNotFound {
+		t.Fatalf("Schedule of missing keyword should not be set, got %v", err)
+	}
+	cleanUp()
+}
@@ -0,0 +1,248 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SortByName           = "name"
+	SortByLastAnalyzed   = "last_analyzed"
+	SortByLatestReaction = "latest_reaction"
+	maxSearchLimit       = 500
+)
+
+var (
+	ErrInvalidCursor = errors.New("Cursor is not valid")
+	ErrInvalidSort   = errors.New("Sorting not supported")
+)
+
+// KeywordSummary is keyword with its latest analyzis, summary fields are nil if keyword was never analyzed.
+type KeywordSummary struct {
+	Keyword
+	LastAnalyzed      *time.Time `json:"last_analyzed"`
+	LatestReactionAvg *float32   `json:"latest_reaction_avg"`
+}
+
+// KeywordFilter selects keywords, empty fields match everything, archived keywords match only on demand.
+type KeywordFilter struct {
+	Prefix          string
+	Provider        string
+	Tag             string
+	Status          string
+	IncludeArchived bool
+}
+
+type KeywordSearch struct {
+	KeywordFilter
+	SortBy string
+	Desc   bool
+	Cursor string
+	Limit  int
+}
+
+// KeywordPage holds found keywords, NextCursor is empty on the last page.
+type KeywordPage struct {
+	Keywords   []KeywordSummary `json:"keywords"`
+	NextCursor string           `json:"next_cursor"`
+}
+
+func (f KeywordFilter) matches(k Keyword) bool {
+	if f.Provider != "" && k.Provider != f.Provider {
+		return false
+	}
+	if f.Status != "" && k.Status != f.Status {
+		return false
+	}
+	if f.Status == "" && !f.IncludeArchived && k.Status == KeywordArchived {
+		return false
+	}
+	return strings.HasPrefix(strings.ToLower(k.Name), strings.ToLower(f.Prefix))
+}
+
+// SearchKeywords filters keywords in store, then sorts and pages them, amount of keywords is small enough to do it in memory.
+// Limit of zero returns all matching keywords.
+func (env Env) SearchKeywords(search KeywordSearch) (KeywordPage, error) {
+	if search.SortBy == "" {
+		search.SortBy = SortByName
+	}
+	if search.SortBy != SortByName && search.SortBy != SortByLastAnalyzed && search.SortBy != SortByLatestReaction {
+		return KeywordPage{}, ErrInvalidSort
+	}
+	if search.Limit < 0 || search.Limit > maxSearchLimit {
+		search.Limit = maxSearchLimit
+	}
+	summaries, err := env.GetKeywordSummaries(search.KeywordFilter)
+	if err != nil {
+		return KeywordPage{}, fmt.Errorf("Failed on call to GetKeywordSummaries in SearchKeywords, %v", err)
+	}
+	less := func(a, b KeywordSummary) bool { return keywordLess(a, b, search.SortBy, search.Desc) }
+	sort.Slice(summaries, func(i, j int) bool { return less(summaries[i], summaries[j]) })
+	if search.Cursor != "" {
+		after, err := decodeCursor(search.Cursor)
+		if err != nil {
+			return KeywordPage{}, ErrInvalidCursor
+		}
+		start := sort.Search(len(summaries), func(i int) bool { return less(after, summaries[i]) })
+		summaries = summaries[start:]
+	}
+	page := KeywordPage{Keywords: summaries}
+	if search.Limit != 0 && len(summaries) > search.Limit {
+		page.Keywords = summaries[:search.Limit]
+		page.NextCursor = encodeCursor(page.Keywords[search.Limit-1])
+	}
+	return page, nil
+}
+
+// keywordLess orders keywords by sortBy, never analyzed ones go last in both directions and ties are broken by ID.
+func keywordLess(a, b KeywordSummary, sortBy string, desc bool) bool {
+	cmp := 0
+	switch sortBy {
+	case SortByName:
+		cmp = strings.Compare(a.Name, b.Name)
+	case SortByLastAnalyzed:
+		if a.LastAnalyzed == nil || b.LastAnalyzed == nil {
+			return nullsLast(a.LastAnalyzed == nil, b.LastAnalyzed == nil, a.ID, b.ID)
+		}
+		cmp = a.LastAnalyzed.Compare(*b.LastAnalyzed)
+	case SortByLatestReaction:
+		if a.LatestReactionAvg == nil || b.LatestReactionAvg == nil {
+			return nullsLast(a.LatestReactionAvg == nil, b.LatestReactionAvg == nil, a.ID, b.ID)
+		}
+		switch {
+		case *a.LatestReactionAvg < *b.LatestReactionAvg:
+			cmp = -1
+		case *a.LatestReactionAvg > *b.LatestReactionAvg:
+			cmp = 1
+		}
+	}
+	if desc {
+		cmp = -cmp
+	}
+	if cmp != 0 {
+		return cmp < 0
+	}
+	return a.ID < b.ID
+}
+
+func nullsLast(aNull, bNull bool, aID, bID int) bool {
+	if aNull != bNull {
+		return bNull
+	}
+	return aID < bID
+}
+
+// Cursor carries sorting fields of the last keyword of a page, so it stays valid when that keyword is changed.
+func encodeCursor(s KeywordSummary) string {
+	cursor, _ := json.Marshal(s)
+	return base64.RawURLEncoding.EncodeToString(cursor)
+}
+
+func decodeCursor(cursor string) (KeywordSummary, error) {
+	s := KeywordSummary{}
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(decoded, &s)
+	return s, err
+}
+
+func (s sqlStore) GetKeywordSummaries(filter KeywordFilter) ([]KeywordSummary, error) {
+	query := `SELECT k.id, k.name, k.provider, k.additional_info, k.status, a.timestamp, a.reaction_avg FROM keywords k
+	  LEFT JOIN analyzes a ON a.keyword_id=k.id AND a.timestamp=(SELECT MAX(timestamp) FROM analyzes WHERE keyword_id=k.id)
+	  WHERE 1=1`
+	args := []interface{}{}
+	if filter.Provider != "" {
+		query += " AND k.provider=?"
+		args = append(args, filter.Provider)
+	}
+	if filter.Status != "" {
+		query += " AND k.status=?"
+		args = append(args, filter.Status)
+	} else if !filter.IncludeArchived {
+		query += " AND k.status<>?"
+		args = append(args, KeywordArchived)
+	}
+	if filter.Prefix != "" {
+		query += " AND LOWER(k.name) LIKE LOWER(?) ESCAPE '!'"
+		args = append(args, escapeLike(filter.Prefix)+"%")
+	}
+	if filter.Tag != "" {
+		query += " AND k.id IN (SELECT keyword_id FROM keyword_tags WHERE tag=?)"
+		args = append(args, filter.Tag)
+	}
+	summaries := []KeywordSummary{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting %v with %v in GetKeywordSummaries, %v", query, args, err)
+	}
+	defer rows.Close()
+	seen := map[int]bool{}
+	for rows.Next() {
+		summary := KeywordSummary{}
+		lastAnalyzed := sql.NullTime{}
+		latestReaction := sql.NullFloat64{}
+		if err := rows.Scan(&summary.ID, &summary.Name, &summary.Provider, &summary.AdditionalInfo, &summary.Status, &lastAnalyzed, &latestReaction); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in GetKeywordSummaries on %v", err)
+		}
+		//Keyword analyzed twice at the same time is joined twice
+		if seen[summary.ID] {
+			continue
+		}
+		seen[summary.ID] = true
+		if lastAnalyzed.Valid {
+			t := lastAnalyzed.Time.UTC()
+			summary.LastAnalyzed = &t
+		}
+		if latestReaction.Valid {
+			r := float32(latestReaction.Float64)
+			summary.LatestReactionAvg = &r
+		}
+		summaries = append(summaries, summary)
+	}
+	log.Debug(summaries)
+	return summaries, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func (m *memoryStore) GetKeywordSummaries(filter KeywordFilter) ([]KeywordSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summaries := []KeywordSummary{}
+	for _, k := range m.keywords {
+		if !filter.matches(k) || (filter.Tag != "" && !m.tagged(k.ID, filter.Tag)) {
+			continue
+		}
+		summary := KeywordSummary{Keyword: k}
+		for i := range m.analyzes {
+			a := m.analyzes[i]
+			if a.KeywordID == k.ID && (summary.LastAnalyzed == nil || a.Timestamp.After(*summary.LastAnalyzed)) {
+				summary.LastAnalyzed = &a.Timestamp
+				summary.LatestReactionAvg = &a.ReactionAvg
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func (m *memoryStore) tagged(keywordID int, tag string) bool {
+	for _, t := range m.keywordTags {
+		if t.keywordID == keywordID && t.tag == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchKeywords(t *testing.T) {
+	env := setupEnv()
+	for _, k := range []Keyword{NewKeyword("pko", "stock", ""), NewKeyword("PKN", "stock", ""), NewKeyword("bitcoin", "crypto", ""), NewKeyword("p_k", "stock", "")} {
+		err := env.CreateKeyword(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := env.TagKeyword("pko", "banks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]int{}
+	for _, name := range []string{"pko", "PKN", "bitcoin", "p_k"} {
+		ids[name], err = env.GetKeywordID(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := time.Date(2018, 3, 14, 12, 0, 0, 0, time.UTC)
+	for _, a := range []Analyzis{
+		NewAnalyzis(ids["pko"], "pl", ts, 1, 1, 0.5, 0.5, 0.5),
+		NewAnalyzis(ids["pko"], "pl", ts.Add(time.Hour), 1, 1, -0.5, -0.5, -0.5),
+		NewAnalyzis(ids["bitcoin"], "us", ts.Add(2*time.Hour), 1, 1, 0.25, 0.25, 0.25),
+	} {
+		err := env.CreateAnalyzis(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = env.ArchiveKeyword("p_k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := env.SearchKeywords(KeywordSearch{KeywordFilter: KeywordFilter{Prefix: "pk"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Keywords) != 2 || page.Keywords[0].Name != "PKN" || page.Keywords[1].Name != "pko" || page.NextCursor != "" {
+		t.Fatalf("Prefix should match PKN and pko, got %v", page)
+	}
+	pko := page.Keywords[1]
+	if pko.LastAnalyzed == nil || !pko.LastAnalyzed.Equal(ts.Add(time.Hour)) || pko.LatestReactionAvg == nil || *pko.LatestReactionAvg != -0.5 {
+		t.Fatalf("Summary of pko should come from its latest analyzis, got %v", pko)
+	}
+	if page.Keywords[0].LastAnalyzed != nil {
+		t.Fatalf("Never analyzed keyword should have no summary, got %v", page.Keywords[0])
+	}
+	page, err = env.SearchKeywords(KeywordSearch{KeywordFilter: KeywordFilter{Prefix: "p_", IncludeArchived: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Keywords) != 1 || page.Keywords[0].Name != "p_k" {
+		t.Fatalf("Prefix should be matched literally, got %v", page)
+	}
+	page, err = env.SearchKeywords(KeywordSearch{KeywordFilter: KeywordFilter{Tag: "banks", Provider: "stock"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Keywords) != 1 || page.Keywords[0].Name != "pko" {
+		t.Fatalf("Tag should match pko, got %v", page)
+	}
+	expected := []string{"bitcoin", "pko", "PKN"}
+	names := []string{}
+	search := KeywordSearch{SortBy: SortByLatestReaction, Desc: true, Limit: 2}
+	for {
+		page, err = env.SearchKeywords(search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range page.Keywords {
+			names = append(names, k.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		search.Cursor = page.NextCursor
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected pages of %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("Expected pages of %v, got %v", expected, names)
+		}
+	}
+	_, err = env.SearchKeywords(KeywordSearch{Cursor: "!"})
+	if err != ErrInvalidCursor {
+		t.Fatalf("Malformed cursor should fail with ErrInvalidCursor, got %v", err)
+	}
+	_, err = env.SearchKeywords(KeywordSearch{SortBy: "id"})
+	if err != ErrInvalidSort {
+		t.Fatalf("Unknown sorting should fail with ErrInvalidSort, got %v", err)
+	}
+	cleanUp()
+}
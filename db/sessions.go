@@ -0,0 +1,314 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SessionTTL = 24 * time.Hour
+	//Last use of session is stored at most once per sessionTouchInterval to spare writes on every request
+	sessionTouchInterval = time.Minute
+	tokenBytes           = 32
+)
+
+var ErrSessionNotFound = errors.New("Session not found")
+
+// Session is login of user on one device, only hash of its token is stored.
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// CreateSession logs user in and returns token of new session, other sessions of user stay valid.
+func (env Env) CreateSession(username, userAgent, ip string) (string, Session, error) {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return "", Session{}, fmt.Errorf("Failed on call to getUserWithName in CreateSession, %v", err)
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", Session{}, fmt.Errorf("Failed on call to newToken in CreateSession, %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	session := Session{UserID: user.id, UserAgent: userAgent, IP: ip, CreatedAt: now, LastUsedAt: now, ExpiresAt: now.Add(SessionTTL)}
+	err = env.insertSession(session, hashToken(token))
+	if err != nil {
+		return "", Session{}, fmt.Errorf("Failed on call to insertSession in CreateSession, %v", err)
+	}
+	session, err = env.GetSession(token)
+	if err != nil {
+		return "", Session{}, fmt.Errorf("Failed on call to GetSession in CreateSession, %v", err)
+	}
+	_, err = env.pruneSessions(now)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on call to pruneSessions in CreateSession, %v", err))
+	}
+	return token, session, nil
+}
+
+// GetSession returns unexpired session of token and records its use.
+func (env Env) GetSession(token string) (Session, error) {
+	sessions, err := env.getSessionsWithTokenHash(hashToken(token))
+	if err != nil {
+		return Session{}, fmt.Errorf("Failed on call to getSessionsWithTokenHash in GetSession, %v", err)
+	}
+	now := time.Now().UTC()
+	if len(sessions) != 1 || !now.Before(sessions[0].ExpiresAt) {
+		return Session{}, ErrSessionNotFound
+	}
+	session := sessions[0]
+	if now.Sub(session.LastUsedAt) >= sessionTouchInterval {
+		session.LastUsedAt = now.Truncate(time.Second)
+		err = env.touchSession(session.ID, session.LastUsedAt)
+		if err != nil {
+			return Session{}, fmt.Errorf("Failed on call to touchSession in GetSession, %v", err)
+		}
+	}
+	return session, nil
+}
+
+// AuthenticateToken returns user logged in with session token.
+func (env Env) AuthenticateToken(token string) (UserInfo, Session, error) {
+	session, err := env.GetSession(token)
+	if err != nil {
+		return UserInfo{}, Session{}, err
+	}
+	users, err := env.getUsersWithID(session.UserID)
+	if err != nil {
+		return UserInfo{}, Session{}, fmt.Errorf("Failed on call to getUsersWithID in AuthenticateToken, %v", err)
+	}
+	if len(users) != 1 {
+		return UserInfo{}, Session{}, ErrSessionNotFound
+	}
+	return users[0].info(), session, nil
+}
+
+func (env Env) AuthenticateUser(username string, token string) (bool, error) {
+	session, err := env.GetSession(token)
+	if err == ErrSessionNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed on call to GetSession in AuthenticateUser, %v", err)
+	}
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return false, err
+	}
+	return user.id == session.UserID, nil
+}
+
+// GetSessions lists unexpired sessions of user, newest first.
+func (env Env) GetSessions(username string) ([]Session, error) {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getUserWithName in GetSessions, %v", err)
+	}
+	return env.getUserSessions(user.id, time.Now().UTC())
+}
+
+// RevokeSession logs user out of one of its sessions.
+func (env Env) RevokeSession(username string, id int) error {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return fmt.Errorf("Failed on call to getUserWithName in RevokeSession, %v", err)
+	}
+	deleted, err := env.deleteSession(user.id, id)
+	if err != nil {
+		return fmt.Errorf("Failed on call to deleteSession in RevokeSession, %v", err)
+	}
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// Logout revokes session of token, unknown tokens are ignored.
+func (env Env) Logout(token string) error {
+	err := env.deleteSessionWithTokenHash(hashToken(token))
+	if err != nil {
+		return fmt.Errorf("Failed on call to deleteSessionWithTokenHash in Logout, %v", err)
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func (s sqlStore) insertSession(session Session, tokenHash string) error {
+	_, err := s.exec("INSERT INTO sessions (user_id, token_hash, user_agent, ip, created_at, last_used_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)", session.UserID, tokenHash, session.UserAgent, session.IP, session.CreatedAt.UTC(), session.LastUsedAt.UTC(), session.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting session in insertSession, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) getSessionsWithTokenHash(tokenHash string) ([]Session, error) {
+	return s.getSessions("SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at FROM sessions WHERE token_hash=?", tokenHash)
+}
+
+func (s sqlStore) getUserSessions(userID int, now time.Time) ([]Session, error) {
+	return s.getSessions("SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at FROM sessions WHERE user_id=? AND expires_at >? ORDER BY created_at DESC, id DESC", userID, now.UTC())
+}
+
+func (s sqlStore) getSessions(query string, args ...interface{}) ([]Session, error) {
+	sessions := []Session{}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting %v in getSessions, %v", query, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		session := Session{}
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getSessions on %v", err)
+		}
+		session.CreatedAt = session.CreatedAt.UTC()
+		session.LastUsedAt = session.LastUsedAt.UTC()
+		session.ExpiresAt = session.ExpiresAt.UTC()
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (s sqlStore) touchSession(id int, lastUsedAt time.Time) error {
+	_, err := s.exec("UPDATE sessions SET last_used_at=? WHERE id=?", lastUsedAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("Failed on updating session %v in touchSession, %v", id, err)
+	}
+	return nil
+}
+
+func (s sqlStore) deleteSession(userID, id int) (int64, error) {
+	res, err := s.exec("DELETE FROM sessions WHERE user_id=? AND id=?", userID, id)
+	if err != nil {
+		return 0, fmt.Errorf("Failed on deleting session %v in deleteSession, %v", id, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to RowsAffected in deleteSession, %v", err)
+	}
+	return deleted, nil
+}
+
+func (s sqlStore) deleteSessionWithTokenHash(tokenHash string) error {
+	_, err := s.exec("DELETE FROM sessions WHERE token_hash=?", tokenHash)
+	if err != nil {
+		return fmt.Errorf("Failed on deleting session in deleteSessionWithTokenHash, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) deleteUserSessions(userID int) error {
+	_, err := s.exec("DELETE FROM sessions WHERE user_id=?", userID)
+	if err != nil {
+		return fmt.Errorf("Failed on deleting sessions of user %v in deleteUserSessions, %v", userID, err)
+	}
+	return nil
+}
+
+func (s sqlStore) pruneSessions(before time.Time) (int64, error) {
+	return s.prune("sessions", "expires_at", before, false)
+}
+
+func (m *memoryStore) insertSession(session Session, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSessionID++
+	session.ID = m.lastSessionID
+	m.sessions = append(m.sessions, storedSession{session, tokenHash})
+	return nil
+}
+
+func (m *memoryStore) getSessionsWithTokenHash(tokenHash string) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := []Session{}
+	for _, s := range m.sessions {
+		if s.tokenHash == tokenHash {
+			sessions = append(sessions, s.Session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memoryStore) getUserSessions(userID int, now time.Time) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := []Session{}
+	//Sessions are appended in order of creation
+	for i := len(m.sessions) - 1; i >= 0; i-- {
+		s := m.sessions[i].Session
+		if s.UserID == userID && s.ExpiresAt.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memoryStore) touchSession(id int, lastUsedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.sessions {
+		if m.sessions[i].ID == id {
+			m.sessions[i].LastUsedAt = lastUsedAt
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) deleteSession(userID, id int) (int64, error) {
+	return m.deleteSessions(func(s storedSession) bool { return s.UserID == userID && s.ID == id }), nil
+}
+
+func (m *memoryStore) deleteSessionWithTokenHash(tokenHash string) error {
+	m.deleteSessions(func(s storedSession) bool { return s.tokenHash == tokenHash })
+	return nil
+}
+
+func (m *memoryStore) deleteUserSessions(userID int) error {
+	m.deleteSessions(func(s storedSession) bool { return s.UserID == userID })
+	return nil
+}
+
+func (m *memoryStore) pruneSessions(before time.Time) (int64, error) {
+	return m.deleteSessions(func(s storedSession) bool { return s.ExpiresAt.Before(before) }), nil
+}
+
+func (m *memoryStore) deleteSessions(matches func(s storedSession) bool) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.sessions[:0]
+	for _, s := range m.sessions {
+		if !matches(s) {
+			kept = append(kept, s)
+		}
+	}
+	deleted := int64(len(m.sessions) - len(kept))
+	m.sessions = kept
+	return deleted
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreateSession(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc10", "abc10", "abc10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, session, err := env.CreateSession("abc10", "laptop", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token2, _, err := env.CreateSession("abc10", "phone", "127.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == token2 {
+		t.Fatal("Sessions should have different tokens")
+	}
+	if !session.ExpiresAt.Equal(session.CreatedAt.Add(SessionTTL)) {
+		t.Fatalf("Session should expire after %v, got %v", SessionTTL, session)
+	}
+	for _, tok := range []string{token, token2} {
+		authenticated, err := env.AuthenticateUser("abc10", tok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !authenticated {
+			t.Fatal("User should be authenticated on both devices")
+		}
+	}
+	authenticated, err := env.AuthenticateUser("abc10", "abc10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated {
+		t.Fatal("User should not be authenticated with unknown token")
+	}
+	sessions, err := env.GetSessions("abc10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].UserAgent != "phone" || sessions[1].UserAgent != "laptop" {
+		t.Fatalf("Unexpected sessions %v", sessions)
+	}
+}
+
+func TestAuthenticateUserOfOtherSession(t *testing.T) {
+	env := setupEnv()
+	for _, name := range []string{"abc11", "abc12"} {
+		err := env.CreateUser(name, name, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, _, err := env.CreateSession("abc11", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticated, err := env.AuthenticateUser("abc12", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated {
+		t.Fatal("Token should authenticate only its own user")
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc13", "abc13", "abc13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, session, err := env.CreateSession("abc13", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token2, _, err := env.CreateSession("abc13", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.RevokeSession("abc13", session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.RevokeSession("abc13", session.ID)
+	if err != ErrSessionNotFound {
+		t.Fatalf("Revoked session should not be found, got %v", err)
+	}
+	_, err = env.GetSession(token)
+	if err != ErrSessionNotFound {
+		t.Fatalf("Revoked session should not be found, got %v", err)
+	}
+	err = env.Logout(token2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.GetSession(token2)
+	if err != ErrSessionNotFound {
+		t.Fatalf("Logged out session should not be found, got %v", err)
+	}
+}
+
+func TestExpiredSession(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc14", "abc14", "abc14")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := env.getUserWithName("abc14")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().UTC().Add(-2 * SessionTTL).Truncate(time.Second)
+	expired := Session{UserID: user.id, CreatedAt: created, LastUsedAt: created, ExpiresAt: created.Add(SessionTTL)}
+	err = env.insertSession(expired, hashToken("expired"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.GetSession("expired")
+	if err != ErrSessionNotFound {
+		t.Fatalf("Expired session should not be found, got %v", err)
+	}
+	_, _, err = env.CreateSession("abc14", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := env.getSessionsWithTokenHash(hashToken("expired"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("Expired session should be pruned on login, got %v", sessions)
+	}
+}
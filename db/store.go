@@ -0,0 +1,339 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	//import mysql driver
+	_ "github.com/go-sql-driver/mysql"
+	//import postgres driver
+	_ "github.com/lib/pq"
+	//import sqlite driver
+	_ "modernc.org/sqlite"
+)
+
+const (
+	MySQLDriver    = "mysql"
+	PostgresDriver = "postgres"
+	SQLiteDriver   = "sqlite"
+	MemoryDriver   = "memory"
+)
+
+// Store persists keywords, analyzes, users and dispatcher's state.
+// It is implemented by sqlStore for SQL databases and by memoryStore, which keeps everything in process memory.
+type Store interface {
+	KeywordStore
+	AnalyzisStore
+	WatchlistStore
+	AlertStore
+	DigestStore
+	UserStore
+	SessionStore
+	InviteStore
+	ScheduleStore
+	QuotaStore
+	MigrationStore
+}
+
+// KeywordStore keeps keywords with their renames and tags.
+type KeywordStore interface {
+	InsertKeyword(keyword Keyword) error
+	GetKeywordsWithName(name string) ([]Keyword, error)
+	GetKeywords() ([]Keyword, error)
+	updateKeyword(keyword Keyword) error
+	renameKeyword(keyword Keyword, rename KeywordRename) error
+	GetKeywordRenames(keywordID int) ([]KeywordRename, error)
+	addKeywordTag(keywordID int, tag string) error
+	removeKeywordTag(keywordID int, tag string) error
+	GetKeywordTags(keywordID int) ([]string, error)
+	GetTags() ([]Tag, error)
+	GetTaggedKeywords(tag string) ([]Keyword, error)
+	GetKeywordSummaries(filter KeywordFilter) ([]KeywordSummary, error)
+}
+
+// AnalyzisStore keeps analyzes with their rollups and example texts.
+type AnalyzisStore interface {
+	CreateAnalyzis(a Analyzis) error
+	GetKeywordAnalyzes(keywordID int, after, before time.Time, country string) ([]Analyzis, error)
+	pruneAnalyzes(before time.Time, dryRun bool) (int64, error)
+	CreateTexts(tt []Text) error
+	GetTopTexts(keywordID int, after, before time.Time, positive bool, limit int) ([]Text, error)
+	pruneTexts(before time.Time, dryRun bool) (int64, error)
+	GetKeywordRollups(interval string, keywordID int, after, before time.Time, country string) ([]Rollup, error)
+	mergeRollup(interval string, r Rollup) error
+	deleteRollups(interval string, keywordID int, after time.Time) error
+	deleteRollup(interval string, r Rollup) error
+	pruneRollups(interval string, before time.Time, dryRun bool) (int64, error)
+}
+
+// WatchlistStore keeps keywords followed by users.
+type WatchlistStore interface {
+	followKeyword(f followedKeyword) error
+	unfollowKeyword(userID, keywordID int) (int64, error)
+	getFollowedKeywords(userID int) ([]followedKeyword, error)
+}
+
+// AlertStore keeps alert rules of users and log of their webhook deliveries.
+type AlertStore interface {
+	insertAlertRule(r AlertRule) error
+	getUserAlertRules(userID int) ([]AlertRule, error)
+	getKeywordAlertRules(keywordID int) ([]AlertRule, error)
+	setAlertRuleTriggered(id int, triggered bool, lastTriggeredAt *time.Time) error
+	deleteAlertRule(userID, id int) (int64, error)
+	insertAlertDelivery(d AlertDelivery) error
+	getAlertDeliveries(ruleID, limit int) ([]AlertDelivery, error)
+	deleteAlertDeliveries(ruleID int) error
+	pruneAlertDeliveries(before time.Time) (int64, error)
+}
+
+// DigestStore keeps subscriptions of users to watchlist digests.
+type DigestStore interface {
+	getDigestSubscriptions() ([]digestSubscription, error)
+	getUserDigestSubscriptions(userID int) ([]digestSubscription, error)
+	insertDigestSubscription(d digestSubscription) error
+	setDigestFrequency(userID int, frequency string) error
+	claimDigest(userID int, sentAt, dueBefore time.Time) (bool, error)
+	releaseDigest(userID int, claimedAt time.Time, lastSentAt *time.Time) error
+	deleteDigestSubscription(userID int) error
+}
+
+// UserStore keeps users with their external identities.
+type UserStore interface {
+	getUsersWithName(username string) ([]User, error)
+	getUsersWithID(id int) ([]User, error)
+	getAllUsers() ([]User, error)
+	insertUser(username, email, hash, hashAlgorithm, role string) error
+	bootstrapAdmin(username string) (bool, error)
+	setUserRole(username, role string) error
+	setUserRoleKeepingAdmin(username, role string) (bool, error)
+	setPasswordHash(username, hash, hashAlgorithm string) error
+	getUsersWithEmail(email string) ([]User, error)
+	setEmailVerified(userID int, verified bool) error
+	getUsersWithIdentity(issuer, subject string) ([]User, error)
+	insertUserWithIdentity(username, email, role string, emailVerified bool, i userIdentity) error
+}
+
+// SessionStore keeps sessions, API keys and login attempts.
+type SessionStore interface {
+	insertSession(session Session, tokenHash string) error
+	getSessionsWithTokenHash(tokenHash string) ([]Session, error)
+	getUserSessions(userID int, now time.Time) ([]Session, error)
+	touchSession(id int, lastUsedAt time.Time) error
+	deleteSession(userID, id int) (int64, error)
+	deleteSessionWithTokenHash(tokenHash string) error
+	deleteUserSessions(userID int) error
+	pruneSessions(before time.Time) (int64, error)
+	insertLoginAttempt(a LoginAttempt) (int, error)
+	setLoginAttemptOutcome(id int, succeeded bool, throttled int) error
+	addThrottledLogin(username, ip string, after, now time.Time) (bool, error)
+	GetLoginAttempts(filter LoginAttemptFilter) ([]LoginAttempt, error)
+	pruneLoginAttempts(before time.Time) (int64, error)
+	insertAPIKey(k APIKey, keyHash string) error
+	getAPIKeysWithHash(keyHash string) ([]APIKey, error)
+	getUserAPIKeys(userID int) ([]APIKey, error)
+	touchAPIKey(id int, lastUsedAt time.Time) error
+	deleteAPIKey(userID, id int) (int64, error)
+	deleteUserAPIKeys(userID int) error
+}
+
+// InviteStore keeps invite codes and their redemptions.
+type InviteStore interface {
+	insertInvite(i Invite, codeHash string) error
+	getInvitesWithHash(codeHash string) ([]Invite, error)
+	getAllInvites() ([]Invite, error)
+	useInvite(id int) (bool, error)
+	releaseInvite(id int) error
+	insertInviteRedemption(inviteID, userID int, redeemedAt time.Time) error
+	deleteInvite(id int) (int64, error)
+}
+
+// ScheduleStore keeps dispatcher's schedules of keywords.
+type ScheduleStore interface {
+	CreateScheduleIfNotPresent(s Schedule) error
+	GetSchedules() ([]Schedule, error)
+	getKeywordSchedules(keywordID int) ([]Schedule, error)
+	UpdateSchedule(s Schedule) error
+}
+
+// QuotaStore keeps usage of text and market data providers' budgets.
+type QuotaStore interface {
+	consumeQuotaPeriod(provider string, p quotaPeriod) (bool, error)
+	releaseQuotaPeriod(provider string, p quotaPeriod) error
+	getQuotaUsage(provider string, p quotaPeriod) (int, bool, error)
+	PruneQuotaUsage(before time.Time) error
+}
+
+// MigrationStore migrates schema and closes connection to the store.
+type MigrationStore interface {
+	Migrate(target int) error
+	GetMigrationStatuses() ([]MigrationStatus, error)
+	Close() error
+}
+
+// OpenStore connects to the store without migrating it, dataSource is ignored by memory driver.
+func OpenStore(driver, dataSource string) (Store, error) {
+	switch driver {
+	case MemoryDriver:
+		return NewMemoryStore(), nil
+	case MySQLDriver:
+		db, err := sql.Open(driver, dataSource+"?parseTime=true")
+		if err != nil {
+			return nil, fmt.Errorf("Failed on openning mysql connection in OpenStore, %v", err)
+		}
+		return sqlStore{db, driver, nil}, nil
+	case PostgresDriver:
+		db, err := sql.Open(driver, dataSource)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on openning postgres connection in OpenStore, %v", err)
+		}
+		return sqlStore{db, driver, nil}, nil
+	case SQLiteDriver:
+		//Transactions take write lock on begin, so ones of other processes wait for it instead of failing on upgrade
+		db, err := sql.Open(driver, dataSource+"?_time_format=sqlite&_txlock=immediate&_pragma=busy_timeout(10000)")
+		if err != nil {
+			return nil, fmt.Errorf("Failed on openning sqlite connection in OpenStore, %v", err)
+		}
+		//sqlite does not handle concurrent writes from multiple connections
+		db.SetMaxOpenConns(1)
+		return sqlStore{db, driver, nil}, nil
+	}
+	return nil, fmt.Errorf("Driver %v not supported", driver)
+}
+
+// InitStore connects to the store and migrates it to the latest schema.
+func InitStore(driver, dataSource string) (Store, error) {
+	store, err := OpenStore(driver, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to OpenStore in InitStore, %v", err)
+	}
+	statuses, err := store.GetMigrationStatuses()
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetMigrationStatuses in InitStore, %v", err)
+	}
+	err = store.Migrate(LatestMigration(statuses))
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to Migrate in InitStore, %v", err)
+	}
+	return store, nil
+}
+
+type sqlStore struct {
+	db      *sql.DB
+	dialect string
+	//tx is set on store running statements within transaction
+	tx *sql.Tx
+}
+
+func (s sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s sqlStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	if s.tx != nil {
+		return s.tx.Exec(s.rebind(query), args...)
+	}
+	return s.db.Exec(s.rebind(query), args...)
+}
+
+func (s sqlStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if s.tx != nil {
+		return s.tx.Query(s.rebind(query), args...)
+	}
+	return s.db.Query(s.rebind(query), args...)
+}
+
+// inTx runs f with store whose statements make one transaction, which is committed when f succeeds
+// and rolled back otherwise.
+func (s sqlStore) inTx(f func(tx sqlStore) error) error {
+	if s.tx != nil {
+		return f(s)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Failed on beginning transaction in inTx, %v", err)
+	}
+	err = f(sqlStore{s.db, s.dialect, tx})
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Error(fmt.Errorf("Failed on rolling back transaction in inTx, %v", rollbackErr))
+		}
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("Failed on committing transaction in inTx, %v", err)
+	}
+	return nil
+}
+
+// rebind replaces ? placeholders with numbered ones for postgres, queries are written with ? for all dialects.
+func (s sqlStore) rebind(query string) string {
+	if s.dialect != PostgresDriver {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c != '?' {
+			b.WriteRune(c)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// insertReturningID executes insert and returns id of inserted row, postgres driver does not support LastInsertId.
+func (s sqlStore) insertReturningID(query string, args ...interface{}) (int, error) {
+	if s.dialect == PostgresDriver {
+		rows, err := s.query(query+" RETURNING id", args...)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		id := 0
+		if !rows.Next() {
+			return 0, fmt.Errorf("Inserted id not returned in insertReturningID, %v", rows.Err())
+		}
+		err = rows.Scan(&id)
+		return id, err
+	}
+	res, err := s.exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// prune removes rows of table with column older than before, only counting them in dry run.
+func (s sqlStore) prune(table, column string, before time.Time, dryRun bool) (int64, error) {
+	if dryRun {
+		rows, err := s.query("SELECT COUNT(*) FROM "+table+" WHERE "+column+" <?", before.UTC())
+		if err != nil {
+			return 0, fmt.Errorf("Failed on counting %v in prune, %v", table, err)
+		}
+		defer rows.Close()
+		count := int64(0)
+		if rows.Next() {
+			if err := rows.Scan(&count); err != nil {
+				return 0, fmt.Errorf("Rows scan failed in prune on %v", err)
+			}
+		}
+		return count, nil
+	}
+	res, err := s.exec("DELETE FROM "+table+" WHERE "+column+" <?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("Failed on deleting from %v in prune, %v", table, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to RowsAffected in prune, %v", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	//TextsPerAnalyzis is how many of the most positive and of the most negative texts are kept for each analyzis
+	TextsPerAnalyzis = 5
+	maxTextLength    = 1000
+)
+
+// Text is analyzed tweet or news kept as example of reaction to keyword, timestamp is the one of its analyzis.
+type Text struct {
+	ID           int       `json:"id"`
+	KeywordID    int       `json:"keyword_id"`
+	Country      string    `json:"country"`
+	TextProvider string    `json:"text_provider"`
+	Text         string    `json:"text"`
+	Reaction     float32   `json:"reaction"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+func NewText(keywordID int, country, textProvider, text string, reaction float32, timestamp time.Time) Text {
+	return Text{0, keywordID, country, textProvider, truncateText(text), reaction, timestamp}
+}
+
+func truncateText(text string) string {
+	if len(text) <= maxTextLength {
+		return text
+	}
+	text = text[:maxTextLength]
+	for !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+func (s sqlStore) CreateTexts(tt []Text) error {
+	for _, t := range tt {
+		_, err := s.exec("INSERT INTO texts (keyword_id, country, text_provider, text, reaction, timestamp) VALUES (?, ?, ?, ?, ?, ?)", t.KeywordID, t.Country, t.TextProvider, t.Text, t.Reaction, t.Timestamp.UTC())
+		if err != nil {
+			return fmt.Errorf("Failed on inserting text in CreateTexts, %v", err)
+		}
+	}
+	return nil
+}
+
+// GetTopTexts returns limit texts on keyword between after and before with the highest reaction above zero when positive
+// and with the lowest one below zero otherwise.
+func (s sqlStore) GetTopTexts(keywordID int, after, before time.Time, positive bool, limit int) ([]Text, error) {
+	query := "SELECT id, keyword_id, country, text_provider, text, reaction, timestamp FROM texts WHERE keyword_id=? AND timestamp >=? AND timestamp <=?"
+	if positive {
+		query += " AND reaction >0 ORDER BY reaction DESC, id"
+	} else {
+		query += " AND reaction <0 ORDER BY reaction, id"
+	}
+	query += " LIMIT " + strconv.Itoa(limit)
+	texts := []Text{}
+	rows, err := s.query(query, keywordID, after.UTC(), before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting texts in GetTopTexts, %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := Text{}
+		if err := rows.Scan(&t.ID, &t.KeywordID, &t.Country, &t.TextProvider, &t.Text, &t.Reaction, &t.Timestamp); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in GetTopTexts on %v", err)
+		}
+		t.Timestamp = t.Timestamp.UTC()
+		texts = append(texts, t)
+	}
+	return texts, nil
+}
+
+func (s sqlStore) pruneTexts(before time.Time, dryRun bool) (int64, error) {
+	return s.prune("texts", "timestamp", before, dryRun)
+}
+
+func (m *memoryStore) CreateTexts(tt []Text) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range tt {
+		m.lastTextID++
+		t.ID = m.lastTextID
+		m.texts = append(m.texts, t)
+	}
+	return nil
+}
+
+func (m *memoryStore) GetTopTexts(keywordID int, after, before time.Time, positive bool, limit int) ([]Text, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	texts := []Text{}
+	for _, t := range m.texts {
+		if t.KeywordID != keywordID || t.Timestamp.Before(after) || t.Timestamp.After(before) || (positive && t.Reaction <= 0) || (!positive && t.Reaction >= 0) {
+			continue
+		}
+		texts = append(texts, t)
+	}
+	sort.SliceStable(texts, func(i, j int) bool {
+		if positive {
+			return texts[i].Reaction > texts[j].Reaction
+		}
+		return texts[i].Reaction < texts[j].Reaction
+	})
+	if len(texts) > limit {
+		texts = texts[:limit]
+	}
+	return texts, nil
+}
+
+func (m *memoryStore) pruneTexts(before time.Time, dryRun bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := []Text{}
+	for _, t := range m.texts {
+		if !t.Timestamp.Before(before) {
+			kept = append(kept, t)
+		}
+	}
+	pruned := int64(len(m.texts) - len(kept))
+	if !dryRun {
+		m.texts = kept
+	}
+	return pruned, nil
+}
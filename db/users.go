@@ -2,33 +2,58 @@ package db
 
 import (
 	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
-	"math/rand"
-	"time"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	BcryptAlgorithm = "bcrypt"
+	//SHA1Algorithm hashes password with global salt, such hashes are only verified and replaced on login
+	SHA1Algorithm = "sha1"
+	//NoPassword is set for users provisioned by single sign-on, they cannot log in with password until they reset it
+	NoPassword = "none"
+	bcryptCost = 12
 )
 
 type User struct {
-	id       int
-	username string
-	email    string
-	hash     string
-	token    string
+	id            int
+	username      string
+	email         string
+	hash          string
+	hashAlgorithm string
+	role          string
+	emailVerified bool
+}
+
+const userColumns = "id, username, email, hash, hash_algorithm, role, email_verified"
+
+func (s sqlStore) getUsersWithName(username string) ([]User, error) {
+	return s.getUsers("SELECT "+userColumns+" FROM users where username=?", username)
+}
+
+func (s sqlStore) getUsersWithID(id int) ([]User, error) {
+	return s.getUsers("SELECT "+userColumns+" FROM users where id=?", id)
+}
+
+func (s sqlStore) getAllUsers() ([]User, error) {
+	return s.getUsers("SELECT " + userColumns + " FROM users ORDER BY id")
 }
 
-func (env Env) getUsersWithName(username string) ([]User, error) {
+func (s sqlStore) getUsers(query string, args ...interface{}) ([]User, error) {
 	users := []User{}
-	rows, err := env.db.Query("SELECT * FROM users where username=?", username)
+	rows, err := s.query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed on selecting users with name %v, %v", username, err)
+		return nil, fmt.Errorf("failed on selecting users with %v, %v", args, err)
 	}
 	defer rows.Close()
-	for i := 0; rows.Next(); i++ {
+	for rows.Next() {
 		user := User{}
-		if err := rows.Scan(&user.id, &user.username, &user.email, &user.hash, &user.token); err != nil {
-			return nil, fmt.Errorf("Rows scan failed in getUsersWithName %v, %v", username, err)
+		if err := rows.Scan(&user.id, &user.username, &user.email, &user.hash, &user.hashAlgorithm, &user.role, &user.emailVerified); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getUsers %v, %v", args, err)
 		}
 		users = append(users, user)
 	}
@@ -59,55 +84,198 @@ func (env Env) UserIsPresent(username string) (bool, error) {
 	return false, nil
 }
 
-func (env Env) CreateUser(username, email, password string) (string, error) {
-	token := newToken()
-	_, err := env.db.Exec("INSERT INTO users (username, email, hash, token) VALUES (?, ?, ?, ?)", username, email, getSHA1Hash(password+env.salt), token)
+// CreateUser registers user with default role, the first user becomes admin.
+func (env Env) CreateUser(username, email, password string) error {
+	return env.createUser(username, email, password, DefaultRole)
+}
+
+func (env Env) createUser(username, email, password, role string) error {
+	hash, err := hashPassword(password)
 	if err != nil {
-		return "", fmt.Errorf("failed on inserting user %v, %v", username, err)
+		return fmt.Errorf("failed on call to hashPassword %v, %v", username, err)
 	}
-	return token, nil
+	return env.createUserWithHash(username, email, hash, BcryptAlgorithm, role)
+}
 
+// createUserWithHash inserts user and makes it an admin when it is the first one,
+// admin role is claimed once, so concurrent first registrations yield only one admin.
+func (env Env) createUserWithHash(username, email, hash, hashAlgorithm, role string) error {
+	err := env.insertUser(username, email, hash, hashAlgorithm, role)
+	if err != nil {
+		return fmt.Errorf("failed on call to insertUser %v, %v", username, err)
+	}
+	return env.bootstrapFirstAdmin(username)
 }
+
+// bootstrapFirstAdmin makes user an admin when it is the first one.
+func (env Env) bootstrapFirstAdmin(username string) error {
+	claimed, err := env.bootstrapAdmin(username)
+	if err != nil {
+		return fmt.Errorf("failed on call to bootstrapAdmin %v, %v", username, err)
+	}
+	if claimed {
+		log.Info(fmt.Sprintf("User %v is the first one and became an admin", username))
+	}
+	return nil
+}
+
+// PasswordIsCorrect verifies password against stored hash and rehashes it with bcrypt at current cost when it was stored otherwise.
 func (env Env) PasswordIsCorrect(username, password string) (bool, error) {
 	user, err := env.getUserWithName(username)
 	if err != nil {
 		return false, err
 	}
-	if getSHA1Hash(password+env.salt) == user.hash {
+	if !env.passwordMatches(user, password) {
+		return false, nil
+	}
+	if !needsRehash(user) {
 		return true, nil
 	}
-	return false, nil
+	hash, err := hashPassword(password)
+	if err != nil {
+		return false, fmt.Errorf("failed on call to hashPassword %v, %v", username, err)
+	}
+	err = env.setPasswordHash(username, hash, BcryptAlgorithm)
+	if err != nil {
+		return false, fmt.Errorf("failed on call to setPasswordHash %v, %v", username, err)
+	}
+	log.Info("Password hash of user " + username + " upgraded to " + BcryptAlgorithm)
+	return true, nil
 
 }
-func (env Env) UpdateToken(username string) (string, error) {
-	token := newToken()
-	_, err := env.db.Exec("UPDATE users SET token=? WHERE username=?", token, username)
-	return token, err
 
+func (env Env) passwordMatches(user User, password string) bool {
+	switch user.hashAlgorithm {
+	case BcryptAlgorithm:
+		return bcrypt.CompareHashAndPassword([]byte(user.hash), []byte(password)) == nil
+	case SHA1Algorithm:
+		return subtle.ConstantTimeCompare([]byte(getSHA1Hash(password+env.salt)), []byte(user.hash)) == 1
+	case NoPassword:
+		return false
+	}
+	log.Error(fmt.Errorf("Unknown hash algorithm %v of user %v", user.hashAlgorithm, user.username))
+	return false
 }
-func (env Env) AuthenticateUser(username string, token string) (bool, error) {
-	user, err := env.getUserWithName(username)
+
+func needsRehash(user User) bool {
+	if user.hashAlgorithm != BcryptAlgorithm {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(user.hash))
+	return err != nil || cost < bcryptCost
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	return string(hash), err
+}
+
+func (s sqlStore) insertUser(username, email, hash, hashAlgorithm, role string) error {
+	_, err := s.exec("INSERT INTO users (username, email, hash, hash_algorithm, role) VALUES (?, ?, ?, ?, ?)", username, email, hash, hashAlgorithm, role)
+	if err != nil {
+		return fmt.Errorf("failed on inserting user %v, %v", username, err)
+	}
+	return nil
+}
+
+func (s sqlStore) bootstrapAdmin(username string) (bool, error) {
+	claimed := false
+	err := s.inTx(func(tx sqlStore) error {
+		res, err := tx.exec("UPDATE admin_bootstrap SET claimed=? WHERE id=1 AND claimed=?", true, false)
+		if err != nil {
+			return fmt.Errorf("failed on claiming admin bootstrap for %v, %v", username, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed on reading claimed admin bootstrap for %v, %v", username, err)
+		}
+		if n == 0 {
+			return nil
+		}
+		claimed = true
+		return tx.setUserRole(username, AdminRole)
+	})
 	if err != nil {
 		return false, err
 	}
-	if user.token == token {
-		return true, nil
+	return claimed, nil
+}
+
+func (s sqlStore) setPasswordHash(username, hash, hashAlgorithm string) error {
+	_, err := s.exec("UPDATE users SET hash=?, hash_algorithm=? WHERE username=?", hash, hashAlgorithm, username)
+	if err != nil {
+		return fmt.Errorf("failed on updating password hash of user %v, %v", username, err)
 	}
-	return false, nil
+	return nil
+}
+
+func (m *memoryStore) getUsersWithName(username string) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := []User{}
+	for _, u := range m.users {
+		if u.username == username {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
 
+func (m *memoryStore) getUsersWithID(id int) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := []User{}
+	for _, u := range m.users {
+		if u.id == id {
+			users = append(users, u)
+		}
+	}
+	return users, nil
 }
-func init() {
-	rand.Seed(time.Now().UnixNano())
+
+func (m *memoryStore) getAllUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]User{}, m.users...), nil
 }
 
-var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+func (m *memoryStore) insertUser(username, email, hash, hashAlgorithm, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.username == username {
+			return fmt.Errorf("user %v already exists", username)
+		}
+	}
+	m.users = append(m.users, User{len(m.users) + 1, username, email, hash, hashAlgorithm, role, false})
+	return nil
+}
 
-func randSeq(n int) string {
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+func (m *memoryStore) bootstrapAdmin(username string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.adminClaimed {
+		return false, nil
 	}
-	return string(b)
+	m.adminClaimed = true
+	for i := range m.users {
+		if m.users[i].username == username {
+			m.users[i].role = AdminRole
+		}
+	}
+	return true, nil
+}
+
+func (m *memoryStore) setPasswordHash(username, hash, hashAlgorithm string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.users {
+		if m.users[i].username == username {
+			m.users[i].hash = hash
+			m.users[i].hashAlgorithm = hashAlgorithm
+		}
+	}
+	return nil
 }
 
 func getSHA1Hash(text string) string {
@@ -115,8 +283,3 @@ func getSHA1Hash(text string) string {
 	hasher.Write([]byte(text))
 	return hex.EncodeToString(hasher.Sum(nil))
 }
-
-func newToken() string {
-	token := randSeq(32)
-	return token
-}
@@ -13,7 +13,7 @@ func TestGetUsersWithName(t *testing.T) {
 	if len(users) != 0 {
 		t.Error("There should be no users with name abc")
 	}
-	_, err = env.CreateUser("abc", "abc", "abc")
+	err = env.CreateUser("abc", "abc", "abc")
 	if err != nil {
 		t.Error(err)
 	}
@@ -39,7 +39,7 @@ func TestGetUserWithName(t *testing.T) {
 	if err == nil {
 		t.Error("There should be error in case user is not present")
 	}
-	_, err = env.CreateUser("abc3", "abc3", "abc3")
+	err = env.CreateUser("abc3", "abc3", "abc3")
 	if err != nil {
 		t.Error(err)
 	}
@@ -58,7 +58,7 @@ func TestUserIsPresent(t *testing.T) {
 	if present {
 		t.Error("User abc4 should not be present")
 	}
-	_, err = env.CreateUser("abc4", "abc4", "abc4")
+	err = env.CreateUser("abc4", "abc4", "abc4")
 	if err != nil {
 		t.Error(err)
 	}
@@ -73,7 +73,7 @@ func TestUserIsPresent(t *testing.T) {
 
 func TestCreateUser(t *testing.T) {
 	env := setupEnv()
-	_, err := env.CreateUser("abc5", "abc5", "abc5")
+	err := env.CreateUser("abc5", "abc5", "abc5")
 	if err != nil {
 		t.Error(err)
 	}
@@ -90,9 +90,28 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestCreateUserRejectsDuplicate(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc6", "abc6", "abc6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.CreateUser("abc6", "other", "other")
+	if err == nil {
+		t.Fatal("Duplicate username should be rejected")
+	}
+	users, err := env.getUsersWithName("abc6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].email != "abc6" {
+		t.Fatalf("Duplicate should not change stored user, got %v", users)
+	}
+}
+
 func TestPasswordIsCorrect(t *testing.T) {
 	env := setupEnv()
-	_, err := env.CreateUser("abc6", "abc6", "abc6")
+	err := env.CreateUser("abc6", "abc6", "abc6")
 	if err != nil {
 		t.Error(err)
 	}
@@ -112,39 +131,33 @@ func TestPasswordIsCorrect(t *testing.T) {
 	}
 }
 
-func TestUpdateToken(t *testing.T) {
+func TestPasswordIsRehashed(t *testing.T) {
 	env := setupEnv()
-	token, err := env.CreateUser("abc7", "abc7", "abc7")
+	env.salt = "salt"
+	err := env.insertUser("abc9", "abc9", getSHA1Hash("abc9"+env.salt), SHA1Algorithm, DefaultRole)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	token2, err := env.UpdateToken("abc7")
+	correct, err := env.PasswordIsCorrect("abc9", "abc9")
 	if err != nil {
-		t.Error(err)
-	}
-	if token == token2 {
-		t.Error("Token should be updateed")
+		t.Fatal(err)
 	}
-}
-
-func TestAuthenticateUser(t *testing.T) {
-	env := setupEnv()
-	token, err := env.CreateUser("abc8", "abc8", "abc8")
-	if err != nil {
-		t.Error(err)
+	if !correct {
+		t.Fatal("Legacy password should be correct")
 	}
-	authenticated, err := env.AuthenticateUser("abc8", "abc8")
+	user, err := env.getUserWithName("abc9")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	if authenticated {
-		t.Error("User should not be authenticated")
+	if user.hashAlgorithm != BcryptAlgorithm || needsRehash(user) {
+		t.Fatalf("Password of %v should be rehashed with bcrypt", user.username)
 	}
-	authenticated, err = env.AuthenticateUser("abc8", token)
+	env.salt = ""
+	correct, err = env.PasswordIsCorrect("abc9", "abc9")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	if !authenticated {
-		t.Error("User should be authenticated")
+	if !correct {
+		t.Fatal("Rehashed password should not depend on salt")
 	}
 }
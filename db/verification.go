@@ -0,0 +1,249 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	EmailVerificationTTL = 48 * time.Hour
+	PasswordResetTTL     = time.Hour
+	verifyEmailPurpose   = "verify_email"
+	resetPasswordPurpose = "reset_password"
+	//passwordResetPrefix keeps password reset requests in login attempts apart from logins of users
+	passwordResetPrefix = "password-reset:"
+)
+
+var (
+	ErrInvalidToken = errors.New("Token invalid or expired")
+	ErrNoSecret     = errors.New("Token secret not configured")
+)
+
+// signedToken is payload of email verification and password reset tokens, they are not stored but signed with tokenSecret.
+// Binding ties token to state of user it was issued for, verification token to email and reset token to password hash,
+// so reset token stops working once used.
+type signedToken struct {
+	Purpose   string `json:"p"`
+	UserID    int    `json:"u"`
+	ExpiresAt int64  `json:"e"`
+	Binding   string `json:"b"`
+}
+
+// PasswordReset is token to be mailed to user who asked for new password.
+type PasswordReset struct {
+	User  UserInfo
+	Token string
+}
+
+// CreateEmailVerificationToken returns token confirming current email of user.
+func (env Env) CreateEmailVerificationToken(username string) (string, UserInfo, error) {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return "", UserInfo{}, fmt.Errorf("Failed on call to getUserWithName in CreateEmailVerificationToken, %v", err)
+	}
+	token, err := env.signToken(verifyEmailPurpose, user, user.email, EmailVerificationTTL)
+	if err != nil {
+		return "", UserInfo{}, fmt.Errorf("Failed on call to signToken in CreateEmailVerificationToken, %v", err)
+	}
+	return token, user.info(), nil
+}
+
+// VerifyEmail marks email of user as verified, verifying it again is not an error.
+func (env Env) VerifyEmail(token string) (UserInfo, error) {
+	user, err := env.parseToken(token, verifyEmailPurpose, func(u User) string { return u.email })
+	if err != nil {
+		return UserInfo{}, err
+	}
+	err = env.setEmailVerified(user.id, true)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to setEmailVerified in VerifyEmail, %v", err)
+	}
+	user.emailVerified = true
+	log.Info("Email of user " + user.username + " verified")
+	return user.info(), nil
+}
+
+// CreatePasswordResetTokens returns token for every user registered with email, email is matched case insensitively.
+// ThrottlePasswordReset logs password reset request, unless there were too many of them for the email or failed logins
+// from the IP lately, then ErrLoginThrottled is returned with time left until next request. Requests are logged
+// as login attempts of passwordResetPrefix and email, so they are throttled the same way as logins.
+func (env Env) ThrottlePasswordReset(email, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+	key := passwordResetPrefix + strings.ToLower(strings.TrimSpace(email))
+	wait, err := env.loginWait(key, ip, now)
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to loginWait in ThrottlePasswordReset, %v", err)
+	}
+	if wait > 0 {
+		_, wait, err = env.throttleLogin(key, ip, now, wait)
+		return wait, err
+	}
+	id, err := env.insertLoginAttempt(LoginAttempt{Username: key, IP: ip, AttemptedAt: now})
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to insertLoginAttempt in ThrottlePasswordReset, %v", err)
+	}
+	wait, err = env.loginWaitExcept(key, ip, now, id)
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to loginWaitExcept in ThrottlePasswordReset, %v", err)
+	}
+	if wait > 0 {
+		err = env.setLoginAttemptOutcome(id, false, 1)
+		if err != nil {
+			return 0, fmt.Errorf("Failed on call to setLoginAttemptOutcome in ThrottlePasswordReset, %v", err)
+		}
+		return wait, ErrLoginThrottled
+	}
+	return 0, nil
+}
+
+func (env Env) CreatePasswordResetTokens(email string) ([]PasswordReset, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return []PasswordReset{}, nil
+	}
+	users, err := env.getUsersWithEmail(email)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getUsersWithEmail in CreatePasswordResetTokens, %v", err)
+	}
+	resets := []PasswordReset{}
+	for _, u := range users {
+		token, err := env.signToken(resetPasswordPurpose, u, u.hash, PasswordResetTTL)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on call to signToken in CreatePasswordResetTokens, %v", err)
+		}
+		resets = append(resets, PasswordReset{u.info(), token})
+	}
+	return resets, nil
+}
+
+// ResetPassword sets new password, logs user out of all sessions and deletes API keys. Receiving token proves ownership of email,
+// so email is verified too.
+func (env Env) ResetPassword(token, password string) (UserInfo, error) {
+	user, err := env.parseToken(token, resetPasswordPurpose, func(u User) string { return u.hash })
+	if err != nil {
+		return UserInfo{}, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to hashPassword in ResetPassword, %v", err)
+	}
+	err = env.setPasswordHash(user.username, hash, BcryptAlgorithm)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to setPasswordHash in ResetPassword, %v", err)
+	}
+	err = env.deleteUserSessions(user.id)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to deleteUserSessions in ResetPassword, %v", err)
+	}
+	err = env.deleteUserAPIKeys(user.id)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("Failed on call to deleteUserAPIKeys in ResetPassword, %v", err)
+	}
+	if !user.emailVerified {
+		err = env.setEmailVerified(user.id, true)
+		if err != nil {
+			return UserInfo{}, fmt.Errorf("Failed on call to setEmailVerified in ResetPassword, %v", err)
+		}
+		user.emailVerified = true
+	}
+	log.Info("Password of user " + user.username + " reset")
+	return user.info(), nil
+}
+
+func (env Env) signToken(purpose string, user User, binding string, ttl time.Duration) (string, error) {
+	if len(env.tokenSecret) == 0 {
+		return "", ErrNoSecret
+	}
+	payload, err := json.Marshal(signedToken{purpose, user.id, time.Now().Add(ttl).Unix(), bindingHash(binding)})
+	if err != nil {
+		return "", fmt.Errorf("Failed on marshalling token in signToken, %v", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(env.tokenMAC(encoded)), nil
+}
+
+// parseToken checks signature, purpose, expiry and binding of token and returns user it was issued for.
+func (env Env) parseToken(token, purpose string, binding func(u User) string) (User, error) {
+	if len(env.tokenSecret) == 0 {
+		return User{}, ErrNoSecret
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return User{}, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, env.tokenMAC(parts[0])) {
+		return User{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return User{}, ErrInvalidToken
+	}
+	t := signedToken{}
+	err = json.Unmarshal(payload, &t)
+	if err != nil || t.Purpose != purpose || time.Now().Unix() >= t.ExpiresAt {
+		return User{}, ErrInvalidToken
+	}
+	users, err := env.getUsersWithID(t.UserID)
+	if err != nil {
+		return User{}, fmt.Errorf("Failed on call to getUsersWithID in parseToken, %v", err)
+	}
+	if len(users) != 1 || !hmac.Equal([]byte(bindingHash(binding(users[0]))), []byte(t.Binding)) {
+		return User{}, ErrInvalidToken
+	}
+	return users[0], nil
+}
+
+func (env Env) tokenMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, env.tokenSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// bindingHash keeps bound values out of tokens, which are readable by anyone holding them.
+func bindingHash(value string) string {
+	return hashToken(value)[:16]
+}
+
+func (s sqlStore) getUsersWithEmail(email string) ([]User, error) {
+	return s.getUsers("SELECT "+userColumns+" FROM users WHERE LOWER(email)=LOWER(?) ORDER BY id", email)
+}
+
+func (s sqlStore) setEmailVerified(userID int, verified bool) error {
+	_, err := s.exec("UPDATE users SET email_verified=? WHERE id=?", verified, userID)
+	if err != nil {
+		return fmt.Errorf("Failed on updating user %v in setEmailVerified, %v", userID, err)
+	}
+	return nil
+}
+
+func (m *memoryStore) getUsersWithEmail(email string) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := []User{}
+	for _, u := range m.users {
+		if strings.EqualFold(u.email, email) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (m *memoryStore) setEmailVerified(userID int, verified bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.users {
+		if m.users[i].id == userID {
+			m.users[i].emailVerified = verified
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	env := setupEnv()
+	_, _, err := env.CreateEmailVerificationToken("abc28")
+	if err == nil {
+		t.Fatal("Token should not be created for missing user")
+	}
+	err = env.CreateUser("abc28", "abc28@example.com", "abc28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = env.CreateEmailVerificationToken("abc28")
+	if err == nil {
+		t.Fatal("Token should not be signed without secret")
+	}
+	env.tokenSecret = []byte("secret")
+	token, info, err := env.CreateEmailVerificationToken("abc28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.EmailVerified || info.Email != "abc28@example.com" {
+		t.Fatalf("Unexpected user %v", info)
+	}
+	if _, err := env.VerifyEmail(token + "x"); err != ErrInvalidToken {
+		t.Fatalf("Tampered token should be invalid, got %v", err)
+	}
+	if _, err := env.ResetPassword(token, "abc29"); err != ErrInvalidToken {
+		t.Fatalf("Verification token should not reset password, got %v", err)
+	}
+	other := env
+	other.tokenSecret = []byte("other")
+	if _, err := other.VerifyEmail(token); err != ErrInvalidToken {
+		t.Fatalf("Token signed with other secret should be invalid, got %v", err)
+	}
+	info, err = env.VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.EmailVerified {
+		t.Fatalf("Email should be verified, got %v", info)
+	}
+	user, err := env.getUserWithName("abc28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.emailVerified {
+		t.Fatal("Verified email should be stored")
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	env := setupEnv()
+	env.tokenSecret = []byte("secret")
+	for _, name := range []string{"abc30", "abc31"} {
+		err := env.CreateUser(name, "Shared@example.com", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	resets, err := env.CreatePasswordResetTokens("nobody@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resets) != 0 {
+		t.Fatalf("Unknown email should get no tokens, got %v", resets)
+	}
+	resets, err = env.CreatePasswordResetTokens(" shared@EXAMPLE.com ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resets) != 2 || resets[0].User.Username != "abc30" || resets[1].User.Username != "abc31" {
+		t.Fatalf("Every user with email should get token, got %v", resets)
+	}
+	_, _, err = env.CreateSession("abc30", "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _, err := env.CreateAPIKey("abc30", "ci", []Permission{ReadPermission})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.VerifyEmail(resets[0].Token); err != ErrInvalidToken {
+		t.Fatalf("Reset token should not verify email, got %v", err)
+	}
+	info, err := env.ResetPassword(resets[0].Token, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Username != "abc30" || !info.EmailVerified {
+		t.Fatalf("Unexpected user %v", info)
+	}
+	correct, err := env.PasswordIsCorrect("abc30", "new")
+	if err != nil || !correct {
+		t.Fatalf("New password should be correct, got %v, %v", correct, err)
+	}
+	sessions, err := env.GetSessions("abc30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("Reset should log user out, got %v", sessions)
+	}
+	if _, _, err := env.AuthenticateAPIKey(key); err == nil {
+		t.Fatalf("Reset should delete API keys")
+	}
+	if _, err := env.ResetPassword(resets[0].Token, "newer"); err != ErrInvalidToken {
+		t.Fatalf("Used reset token should be invalid, got %v", err)
+	}
+	if _, err := env.ResetPassword(strings.Replace(resets[1].Token, ".", "", 1), "newer"); err != ErrInvalidToken {
+		t.Fatalf("Malformed token should be invalid, got %v", err)
+	}
+	correct, err = env.PasswordIsCorrect("abc31", "abc31")
+	if err != nil || !correct {
+		t.Fatalf("Password of other user should stay, got %v, %v", correct, err)
+	}
+}
+
+func TestThrottlePasswordReset(t *testing.T) {
+	env := setupEnv()
+	for i := 0; i < accountFreeFailures; i++ {
+		_, err := env.ThrottlePasswordReset("abc32@example.com", fmt.Sprintf("10.0.1.%v", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait, err := env.ThrottlePasswordReset(" ABC32@example.com", "10.0.1.100")
+	if err != ErrLoginThrottled || wait <= 0 {
+		t.Fatalf("Reset requests for the same email should be throttled, got %v, %v", wait, err)
+	}
+	_, err = env.ThrottlePasswordReset("abc33@example.com", "10.0.1.100")
+	if err != nil {
+		t.Fatalf("Reset requests for other email should not be throttled, got %v", err)
+	}
+	_, wait, err = env.Login("abc32@example.com", "password", "10.0.1.101")
+	if err != nil || wait > 0 {
+		t.Fatalf("Reset requests should not throttle logins of the same name, got %v, %v", wait, err)
+	}
+}
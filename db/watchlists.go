@@ -0,0 +1,224 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrNotFollowed = errors.New("Keyword is not followed")
+
+// WatchlistEntry is followed keyword with its volume weighted reaction and volume in current period,
+// changes are against previous period of the same length and are nil when either period has no analyzes.
+type WatchlistEntry struct {
+	KeywordSummary
+	FollowedAt     time.Time `json:"followed_at"`
+	Reaction       *float32  `json:"reaction"`
+	ReactionChange *float32  `json:"reaction_change"`
+	AmountOfTweets int       `json:"amount_of_tweets"`
+	AmountOfNews   int       `json:"amount_of_news"`
+	VolumeChange   *int      `json:"volume_change"`
+}
+
+type followedKeyword struct {
+	userID     int
+	keywordID  int
+	followedAt time.Time
+}
+
+// Follow adds keyword to watchlist of user, following it again is not an error.
+func (env Env) Follow(username, keywordName string) error {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return fmt.Errorf("Failed on call to getUserWithName in Follow, %v", err)
+	}
+	keywordID, err := env.GetKeywordID(keywordName)
+	if err != nil {
+		return ErrKeywordNotFound
+	}
+	followed, err := env.getFollowedKeywords(user.id)
+	if err != nil {
+		return fmt.Errorf("Failed on call to getFollowedKeywords in Follow, %v", err)
+	}
+	for _, f := range followed {
+		if f.keywordID == keywordID {
+			return nil
+		}
+	}
+	err = env.followKeyword(followedKeyword{user.id, keywordID, time.Now().UTC().Truncate(time.Second)})
+	if err != nil {
+		return fmt.Errorf("Failed on call to followKeyword in Follow, %v", err)
+	}
+	return nil
+}
+
+func (env Env) Unfollow(username, keywordName string) error {
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return fmt.Errorf("Failed on call to getUserWithName in Unfollow, %v", err)
+	}
+	keywordID, err := env.GetKeywordID(keywordName)
+	if err != nil {
+		return ErrKeywordNotFound
+	}
+	deleted, err := env.unfollowKeyword(user.id, keywordID)
+	if err != nil {
+		return fmt.Errorf("Failed on call to unfollowKeyword in Unfollow, %v", err)
+	}
+	if deleted == 0 {
+		return ErrNotFollowed
+	}
+	return nil
+}
+
+// GetWatchlist summarizes keywords followed by user sorted by name. Period is day or week, current one
+// covers last 24 hours or 7 days including the running hour or day.
+func (env Env) GetWatchlist(username, period string) ([]WatchlistEntry, error) {
+	if period != DayInterval && period != WeekInterval {
+		return nil, fmt.Errorf("Period %v not supported", period)
+	}
+	user, err := env.getUserWithName(username)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getUserWithName in GetWatchlist, %v", err)
+	}
+	followed, err := env.getFollowedKeywords(user.id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to getFollowedKeywords in GetWatchlist, %v", err)
+	}
+	summaries, err := env.GetKeywordSummaries(KeywordFilter{IncludeArchived: true})
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to GetKeywordSummaries in GetWatchlist, %v", err)
+	}
+	byID := map[int]KeywordSummary{}
+	for _, s := range summaries {
+		byID[s.ID] = s
+	}
+	entries := []WatchlistEntry{}
+	for _, f := range followed {
+		summary, found := byID[f.keywordID]
+		if !found {
+			continue
+		}
+		entry, err := env.watchlistEntry(summary, period, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("Failed on call to watchlistEntry for %v in GetWatchlist, %v", summary.Name, err)
+		}
+		entry.FollowedAt = f.followedAt
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// watchlistEntry merges hourly rollups for daily period and daily ones for weekly period into current and previous period.
+func (env Env) watchlistEntry(summary KeywordSummary, period string, now time.Time) (WatchlistEntry, error) {
+	rollupInterval, length := HourInterval, 24*time.Hour
+	if period == WeekInterval {
+		rollupInterval, length = DayInterval, 7*24*time.Hour
+	}
+	end := bucketStart(now, rollupInterval).Add(time.Hour)
+	if rollupInterval == DayInterval {
+		end = bucketStart(now, rollupInterval).AddDate(0, 0, 1)
+	}
+	rollups, err := env.GetKeywordRollups(rollupInterval, summary.ID, end.Add(-2*length), end, "any")
+	if err != nil {
+		return WatchlistEntry{}, fmt.Errorf("Failed on call to GetKeywordRollups in watchlistEntry, %v", err)
+	}
+	current, previous := Rollup{}, Rollup{}
+	for _, r := range rollups {
+		if !r.Start.Before(end) {
+			continue
+		}
+		if r.Start.Before(end.Add(-length)) {
+			previous = previous.merge(r)
+		} else {
+			current = current.merge(r)
+		}
+	}
+	entry := WatchlistEntry{KeywordSummary: summary, AmountOfTweets: current.AmountOfTweets, AmountOfNews: current.AmountOfNews}
+	if current.Count == 0 {
+		return entry, nil
+	}
+	reaction := current.ReactionAvg.value(WeightedAgg, current.Count, current.AmountOfTweets+current.AmountOfNews)
+	entry.Reaction = &reaction
+	if previous.Count == 0 {
+		return entry, nil
+	}
+	change := reaction - previous.ReactionAvg.value(WeightedAgg, previous.Count, previous.AmountOfTweets+previous.AmountOfNews)
+	volumeChange := current.AmountOfTweets + current.AmountOfNews - previous.AmountOfTweets - previous.AmountOfNews
+	entry.ReactionChange = &change
+	entry.VolumeChange = &volumeChange
+	return entry, nil
+}
+
+func (s sqlStore) followKeyword(f followedKeyword) error {
+	_, err := s.exec("INSERT INTO watchlist (user_id, keyword_id, followed_at) VALUES (?, ?, ?)", f.userID, f.keywordID, f.followedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("Failed on inserting to watchlist in followKeyword, %v", err)
+	}
+	return nil
+}
+
+func (s sqlStore) unfollowKeyword(userID, keywordID int) (int64, error) {
+	res, err := s.exec("DELETE FROM watchlist WHERE user_id=? AND keyword_id=?", userID, keywordID)
+	if err != nil {
+		return 0, fmt.Errorf("Failed on deleting from watchlist in unfollowKeyword, %v", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Failed on call to RowsAffected in unfollowKeyword, %v", err)
+	}
+	return deleted, nil
+}
+
+func (s sqlStore) getFollowedKeywords(userID int) ([]followedKeyword, error) {
+	followed := []followedKeyword{}
+	rows, err := s.query("SELECT user_id, keyword_id, followed_at FROM watchlist WHERE user_id=? ORDER BY keyword_id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on selecting watchlist in getFollowedKeywords, %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f := followedKeyword{}
+		if err := rows.Scan(&f.userID, &f.keywordID, &f.followedAt); err != nil {
+			return nil, fmt.Errorf("Rows scan failed in getFollowedKeywords on %v", err)
+		}
+		f.followedAt = f.followedAt.UTC()
+		followed = append(followed, f)
+	}
+	return followed, nil
+}
+
+func (m *memoryStore) followKeyword(f followedKeyword) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchlist = append(m.watchlist, f)
+	return nil
+}
+
+func (m *memoryStore) unfollowKeyword(userID, keywordID int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.watchlist[:0]
+	for _, f := range m.watchlist {
+		if f.userID != userID || f.keywordID != keywordID {
+			kept = append(kept, f)
+		}
+	}
+	deleted := int64(len(m.watchlist) - len(kept))
+	m.watchlist = kept
+	return deleted, nil
+}
+
+func (m *memoryStore) getFollowedKeywords(userID int) ([]followedKeyword, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	followed := []followedKeyword{}
+	for _, f := range m.watchlist {
+		if f.userID == userID {
+			followed = append(followed, f)
+		}
+	}
+	return followed, nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWatchlist(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateUser("abc38", "abc38", "abc38")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pko", "pkn"} {
+		err = env.CreateKeyword(NewKeyword(name, "", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.Follow("abc38", "missing"); err != ErrKeywordNotFound {
+		t.Fatalf("Missing keyword should not be followed, got %v", err)
+	}
+	for _, name := range []string{"pkn", "pko", "pkn"} {
+		err = env.Follow("abc38", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := env.GetWatchlist("abc38", DayInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "pkn" || entries[1].Name != "pko" || entries[0].Reaction != nil {
+		t.Fatalf("Keywords should be listed once by name, got %v", entries)
+	}
+	if _, err := env.GetWatchlist("abc38", MonthInterval); err == nil {
+		t.Fatal("Monthly period should not be supported")
+	}
+	err = env.Unfollow("abc38", "pkn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Unfollow("abc38", "pkn"); err != ErrNotFollowed {
+		t.Fatalf("Unfollowed keyword should fail with ErrNotFollowed, got %v", err)
+	}
+	entries, err = env.GetWatchlist("abc38", WeekInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "pko" {
+		t.Fatalf("Only pko should be followed, got %v", entries)
+	}
+}
+
+func TestWatchlistEntry(t *testing.T) {
+	env := setupEnv()
+	err := env.CreateKeyword(NewKeyword("trend", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keywordID, err := env.GetKeywordID("trend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2018, 3, 14, 15, 30, 0, 0, time.UTC)
+	for _, a := range []Analyzis{
+		NewAnalyzis(keywordID, "pl", now.Add(-40*time.Hour), 10, 0, -0.5, -0.5, 0),
+		NewAnalyzis(keywordID, "us", now.Add(-30*time.Hour), 10, 0, 0.5, 0.5, 0),
+		NewAnalyzis(keywordID, "pl", now.Add(-2*time.Hour), 20, 10, 0.4, 0.4, 0.4),
+		NewAnalyzis(keywordID, "pl", now.Add(time.Minute), 10, 0, 0, 0, 0),
+		NewAnalyzis(keywordID, "pl", now.Add(time.Hour), 100, 0, 1, 1, 0),
+	} {
+		err := env.CreateAnalyzis(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary := KeywordSummary{Keyword: Keyword{ID: keywordID, Name: "trend"}}
+	entry, err := env.watchlistEntry(summary, DayInterval, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.AmountOfTweets != 30 || entry.AmountOfNews != 10 || entry.Reaction == nil || math.Abs(float64(*entry.Reaction-0.3)) > 1e-6 {
+		t.Fatalf("Current day should weight running hour in, got %v", entry)
+	}
+	if entry.ReactionChange == nil || math.Abs(float64(*entry.ReactionChange-0.3)) > 1e-6 || *entry.VolumeChange != 20 {
+		t.Fatalf("Previous day should be compared with, got %v", entry)
+	}
+	entry, err = env.watchlistEntry(summary, WeekInterval, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.AmountOfTweets != 150 || entry.ReactionChange != nil || entry.VolumeChange != nil {
+		t.Fatalf("Week without previous analyzes should have no changes, got %v", entry)
+	}
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+const (
+	AnalyzisEvent = "analyzis"
+	JobEvent      = "job"
+	JobStarted    = "started"
+	JobFinished   = "finished"
+	JobFailed     = "failed"
+	//eventBuffer is how many events subscriber may fall behind before further ones are dropped for it
+	eventBuffer = 64
+)
+
+// Event tells about new analyzis of keyword or about status change of job analyzing it.
+// Failed jobs carry no error, errors of text providers may quote requests with API keys.
+type Event struct {
+	Type     string       `json:"type"`
+	Keyword  string       `json:"keyword"`
+	Analyzis *db.Analyzis `json:"analyzis,omitempty"`
+	Status   string       `json:"status,omitempty"`
+	Time     time.Time    `json:"time"`
+}
+
+func NewAnalyzisEvent(keyword string, a db.Analyzis) Event {
+	return Event{Type: AnalyzisEvent, Keyword: keyword, Analyzis: &a, Time: time.Now().UTC()}
+}
+
+func NewJobEvent(keyword, status string) Event {
+	return Event{Type: JobEvent, Keyword: keyword, Status: status, Time: time.Now().UTC()}
+}
+
+// Bus passes events to subscribers within the process, events are not stored anywhere.
+// Nil bus drops everything published, so analyzes run also without anyone listening.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]bool
+}
+
+// Subscription receives events on its keywords through C until it is unsubscribed.
+type Subscription struct {
+	C        chan Event
+	keywords map[string]bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[*Subscription]bool{}}
+}
+
+func (b *Bus) Subscribe(keywords []string) *Subscription {
+	s := &Subscription{C: make(chan Event, eventBuffer), keywords: map[string]bool{}}
+	for _, k := range keywords {
+		s.keywords[k] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[s] = true
+	return s
+}
+
+// Unsubscribe closes C of subscription, unsubscribing twice is harmless.
+func (b *Bus) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[s] {
+		delete(b.subscribers, s)
+		close(s.C)
+	}
+}
+
+// Subscribers is how many subscriptions are open.
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// Publish never blocks, subscribers which do not keep up miss events instead of holding analyzes back.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		if !s.keywords[e.Keyword] {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+		}
+	}
+}
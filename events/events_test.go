@@ -0,0 +1,37 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	trump := bus.Subscribe([]string{"trump"})
+	both := bus.Subscribe([]string{"trump", "orlen"})
+	bus.Publish(NewJobEvent("orlen", JobStarted))
+	bus.Publish(NewAnalyzisEvent("trump", db.NewAnalyzis(1, "us", time.Now(), 10, 0, 0.5, 0.5, 0)))
+	if e := <-trump.C; e.Type != AnalyzisEvent || e.Keyword != "trump" || e.Analyzis == nil || e.Analyzis.ReactionAvg != 0.5 {
+		t.Fatalf("Subscriber should get analyzis of its keyword, got %v", e)
+	}
+	if len(trump.C) != 0 {
+		t.Fatalf("Subscriber should not get events of other keywords, got %v", <-trump.C)
+	}
+	if e := <-both.C; e.Type != JobEvent || e.Status != JobStarted {
+		t.Fatalf("Events should be passed in order, got %v", e)
+	}
+	bus.Unsubscribe(both)
+	bus.Unsubscribe(both)
+	for i := 0; i < eventBuffer+1; i++ {
+		bus.Publish(NewJobEvent("trump", JobFinished))
+	}
+	if len(trump.C) != eventBuffer {
+		t.Fatalf("Events should be dropped for subscriber which does not keep up, got %v buffered", len(trump.C))
+	}
+	<-both.C
+	if e, open := <-both.C; open {
+		t.Fatalf("Unsubscribed subscription should be closed after its pending events, got %v", e)
+	}
+}
@@ -0,0 +1,100 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Mailer sends plain text emails.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type SMTPMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPMailer authenticates with PLAIN auth when username is given, net/smtp upgrades connection with STARTTLS when server supports it.
+func NewSMTPMailer(host string, port int, username, password, from string) SMTPMailer {
+	return SMTPMailer{host, port, username, password, from}
+}
+
+func (m SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	addr := m.host + ":" + strconv.Itoa(m.port)
+	err := smtp.SendMail(addr, auth, m.from, []string{to}, message(m.from, to, subject, body, time.Now()))
+	if err != nil {
+		return fmt.Errorf("Failed on call to SendMail to %v in Send, %v", to, err)
+	}
+	return nil
+}
+
+// FileMailer drops every email into its own file in dir, it is meant for local testing.
+type FileMailer struct {
+	dir  string
+	from string
+	sent *int64
+}
+
+func NewFileMailer(dir, from string) FileMailer {
+	return FileMailer{dir, from, new(int64)}
+}
+
+func (m FileMailer) Send(to, subject, body string) error {
+	now := time.Now()
+	name := fmt.Sprintf("%v-%v.eml", now.UTC().Format("20060102T150405"), atomic.AddInt64(m.sent, 1))
+	err := os.WriteFile(filepath.Join(m.dir, name), message(m.from, to, subject, body, now), 0600)
+	if err != nil {
+		return fmt.Errorf("Failed on writing email to %v in Send, %v", to, err)
+	}
+	return nil
+}
+
+// LogMailer only logs emails, it is used when no other mailer is configured. Bodies contain verification and password
+// reset links, so they are logged only when asked for, which is meant for local development.
+type LogMailer struct {
+	bodies bool
+}
+
+func NewLogMailer(bodies bool) LogMailer {
+	return LogMailer{bodies}
+}
+
+func (m LogMailer) Send(to, subject, body string) error {
+	if !m.bodies {
+		log.Info(fmt.Sprintf("Email to %v, %v", to, subject))
+		return nil
+	}
+	log.Info(fmt.Sprintf("Email to %v, %v:\n%v", to, subject, body))
+	return nil
+}
+
+func message(from, to, subject, body string, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %v\r\n", from)
+	fmt.Fprintf(&b, "To: %v\r\n", to)
+	fmt.Fprintf(&b, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %v\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	date := time.Date(2018, 3, 14, 12, 0, 0, 0, time.UTC)
+	msg := string(message("from@example.com", "to@example.com", "Zażółć", "line\nnext", date))
+	expected := "From: from@example.com\r\nTo: to@example.com\r\nSubject: =?utf-8?q?Za=C5=BC=C3=B3=C5=82=C4=87?=\r\n" +
+		"Date: Wed, 14 Mar 2018 12:00:00 +0000\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nline\r\nnext"
+	if msg != expected {
+		t.Fatalf("Message %q does not match expected %q", msg, expected)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir, "from@example.com")
+	for i := 0; i < 2; i++ {
+		err := mailer.Send("to@example.com", "subject", "body")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Every email should be dropped to own file, got %v", files)
+	}
+	content, err := os.ReadFile(dir + "/" + files[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(content), "\r\n\r\nbody") {
+		t.Fatalf("Unexpected email %q", content)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/mail"
+)
+
+// accountMailer sends account emails with links to frontend served at publicURL.
+type accountMailer struct {
+	mail.Mailer
+	publicURL string
+}
+
+func newAccountMailer(mailer mail.Mailer, publicURL string) accountMailer {
+	return accountMailer{mailer, strings.TrimSuffix(publicURL, "/")}
+}
+
+func (m accountMailer) link(path, token string) string {
+	return m.publicURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+func (m accountMailer) sendVerification(user db.UserInfo, token string) error {
+	body := fmt.Sprintf("Hi %v,\n\nplease confirm your email address by opening the link below, it is valid for %v hours.\n\n%v\n",
+		user.Username, int(db.EmailVerificationTTL.Hours()), m.link("/verify-email", token))
+	return m.Send(user.Email, "Confirm your email address", body)
+}
+
+func (m accountMailer) sendPasswordReset(reset db.PasswordReset) error {
+	body := fmt.Sprintf("Hi %v,\n\nsomebody asked to reset your password. Open the link below within %v minutes to set a new one, "+
+		"ignore this email otherwise.\n\n%v\n", reset.User.Username, int(db.PasswordResetTTL.Minutes()), m.link("/password-reset", reset.Token))
+	return m.Send(reset.User.Email, "Reset your password", body)
+}
+
+// sendVerificationEmail failures are only logged, user can ask to resend it.
+func sendVerificationEmail(env db.Env, mailer accountMailer, username string) error {
+	token, user, err := env.CreateEmailVerificationToken(username)
+	if err != nil {
+		return fmt.Errorf("Failed on call to CreateEmailVerificationToken in sendVerificationEmail, %v", err)
+	}
+	err = mailer.sendVerification(user, token)
+	if err != nil {
+		return fmt.Errorf("Failed on call to sendVerification in sendVerificationEmail, %v", err)
+	}
+	return nil
+}
+
+func verifyEmail(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dat map[string]string
+		err := json.NewDecoder(r.Body).Decode(&dat)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in verifyEmail, %v", err))
+			return
+		}
+		_, err = env.VerifyEmail(dat["token"])
+		if err == db.ErrInvalidToken {
+			io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, TokenIncorrect))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on call to VerifyEmail in verifyEmail, %v", err))
+			return
+		}
+		io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, EverythingOk))
+	}
+}
+
+func resendVerification(env db.Env, mailer accountMailer) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := requestAuth(r)
+		if info.user.EmailVerified {
+			io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, EverythingOk))
+			return
+		}
+		err := sendVerificationEmail(env, mailer, info.user.Username)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on call to sendVerificationEmail in resendVerification, %v", err))
+			return
+		}
+		io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, EverythingOk))
+	}
+}
+
+// requestPasswordReset answers the same whether email is registered or not, emails are sent in background
+// so response time does not tell it either. Requests are throttled per email and IP like logins.
+func requestPasswordReset(env db.Env, mailer accountMailer) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dat map[string]string
+		err := json.NewDecoder(r.Body).Decode(&dat)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in requestPasswordReset, %v", err))
+			return
+		}
+		wait, err := env.ThrottlePasswordReset(dat["email"], clientIP(r))
+		if err == db.ErrLoginThrottled {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeStatus(w, http.StatusTooManyRequests, TooManyAttempts)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on call to ThrottlePasswordReset in requestPasswordReset, %v", err))
+			return
+		}
+		resets, err := env.CreatePasswordResetTokens(dat["email"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on call to CreatePasswordResetTokens in requestPasswordReset, %v", err))
+			return
+		}
+		go func() {
+			for _, reset := range resets {
+				err := mailer.sendPasswordReset(reset)
+				if err != nil {
+					log.Error(fmt.Errorf("Failed on call to sendPasswordReset in requestPasswordReset, %v", err))
+				}
+			}
+		}()
+		io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, EverythingOk))
+	}
+}
+
+func resetPassword(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dat map[string]string
+		err := json.NewDecoder(r.Body).Decode(&dat)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in resetPassword, %v", err))
+			return
+		}
+		password := dat["password"]
+		if password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("password not found in body of resetPassword"))
+			return
+		}
+		_, err = env.ResetPassword(dat["token"], password)
+		if err == db.ErrInvalidToken {
+			io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, TokenIncorrect))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on call to ResetPassword in resetPassword, %v", err))
+			return
+		}
+		io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, EverythingOk))
+	}
+}
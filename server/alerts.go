@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+const (
+	defaultAlertDeliveriesLimit = 100
+	maxAlertDeliveriesLimit     = 1000
+)
+
+type alertRuleRequest struct {
+	Keyword       string  `json:"keyword"`
+	Kind          string  `json:"kind"`
+	Threshold     float32 `json:"threshold"`
+	Country       string  `json:"country"`
+	WebhookURL    string  `json:"webhook_url"`
+	WebhookFormat string  `json:"webhook_format"`
+}
+
+func alertRules(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := requestAuth(r)
+		rules, err := env.GetAlertRules(info.user.Username)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetAlertRules in alertRules, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, rules, "alertRules")
+	}
+}
+
+func createAlertRule(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req alertRuleRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in createAlertRule, %v", err))
+			return
+		}
+		info, _ := requestAuth(r)
+		rule := db.AlertRule{Keyword: req.Keyword, Kind: req.Kind, Threshold: req.Threshold, Country: req.Country, WebhookURL: req.WebhookURL, WebhookFormat: req.WebhookFormat}
+		rule, err = env.CreateAlertRule(info.user.Username, rule)
+		if err == db.ErrKeywordNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err == db.ErrInvalidAlert {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to CreateAlertRule in createAlertRule, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, rule, "createAlertRule")
+	}
+}
+
+func deleteAlertRule(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		info, _ := requestAuth(r)
+		err = env.DeleteAlertRule(info.user.Username, id)
+		if err == db.ErrAlertNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to DeleteAlertRule in deleteAlertRule, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// alertDeliveries lists delivery log of alert rule, newest first.
+func alertDeliveries(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit := defaultAlertDeliveriesLimit
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 1 || limit > maxAlertDeliveriesLimit {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		info, _ := requestAuth(r)
+		deliveries, err := env.GetAlertDeliveries(info.user.Username, id, limit)
+		if err == db.ErrAlertNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetAlertDeliveries in alertDeliveries, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, deliveries, "alertDeliveries")
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+type apiKeyRequest struct {
+	Name   string          `json:"name"`
+	Scopes []db.Permission `json:"scopes"`
+}
+
+// createdAPIKey is the only response carrying key itself.
+type createdAPIKey struct {
+	Key string `json:"key"`
+	db.APIKey
+}
+
+func apiKeys(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := requestAuth(r)
+		keys, err := env.GetAPIKeys(info.user.Username)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetAPIKeys in apiKeys, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, keys, "apiKeys")
+	}
+}
+
+func createAPIKey(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req apiKeyRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in createAPIKey, %v", err))
+			return
+		}
+		info, _ := requestAuth(r)
+		key, apiKey, err := env.CreateAPIKey(info.user.Username, req.Name, req.Scopes)
+		if err == db.ErrInvalidAPIKey || err == db.ErrInvalidScope {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to CreateAPIKey in createAPIKey, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, createdAPIKey{key, apiKey}, "createAPIKey")
+	}
+}
+
+func revokeAPIKey(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		info, _ := requestAuth(r)
+		err = env.RevokeAPIKey(info.user.Username, id)
+		if err == db.ErrAPIKeyNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to RevokeAPIKey in revokeAPIKey, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
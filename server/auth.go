@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+const (
+	Unauthorized = "UNAUTHORIZED"
+	Forbidden    = "FORBIDDEN"
+)
+
+// Access levels of routes, routes are matched to them by name.
+const (
+	//publicAccess routes handle credentials themselves
+	publicAccess = iota
+	//readAccess routes need authentication only with private reads
+	readAccess
+	//accountAccess routes always need authentication with session, also in read only mode
+	accountAccess
+	//writeAccess routes need authentication and are forbidden in read only mode
+	writeAccess
+)
+
+// routeRule is access level of route and permission its user needs, empty permission is granted to everyone.
+type routeRule struct {
+	access     int
+	permission db.Permission
+}
+
+var routeRules = map[string]routeRule{
+	"status":               {readAccess, db.ReadPermission},
+	"keywords":             {readAccess, db.ReadPermission},
+	"renames":              {readAccess, db.ReadPermission},
+	"keywordTags":          {readAccess, db.ReadPermission},
+	"keywordSchedule":      {readAccess, db.ReadPermission},
+	"groups":               {readAccess, db.ReadPermission},
+	"groupMembers":         {readAccess, db.ReadPermission},
+	"groupAnalyzes":        {readAccess, db.ReadPermission},
+	"groupIndex":           {readAccess, db.ReadPermission},
+	"quotas":               {readAccess, db.ReadPermission},
+	"analyzes":             {readAccess, db.ReadPermission},
+	"events":               {readAccess, db.ReadPermission},
+	"countries":            {readAccess, db.ReadPermission},
+	"rates":                {readAccess, db.ReadPermission},
+	"stocks":               {readAccess, db.ReadPermission},
+	"crypto":               {readAccess, db.ReadPermission},
+	"login":                {publicAccess, ""},
+	"register":             {publicAccess, ""},
+	"authenticate":         {publicAccess, ""},
+	"logout":               {publicAccess, ""},
+	"verifyEmail":          {publicAccess, ""},
+	"requestPasswordReset": {publicAccess, ""},
+	"resetPassword":        {publicAccess, ""},
+	"oidcLogin":            {publicAccess, ""},
+	"oidcCallback":         {publicAccess, ""},
+	"resendVerification":   {accountAccess, ""},
+	"me":                   {accountAccess, ""},
+	"watchlist":            {accountAccess, db.ReadPermission},
+	"follow":               {accountAccess, db.ReadPermission},
+	"unfollow":             {accountAccess, db.ReadPermission},
+	"digestSettings":       {accountAccess, db.ReadPermission},
+	"setDigest":            {accountAccess, db.ReadPermission},
+	"alertRules":           {accountAccess, db.ReadPermission},
+	"createAlertRule":      {accountAccess, db.ReadPermission},
+	"deleteAlertRule":      {accountAccess, db.ReadPermission},
+	"alertDeliveries":      {accountAccess, db.ReadPermission},
+	"sessions":             {accountAccess, ""},
+	"revokeSession":        {accountAccess, ""},
+	"apiKeys":              {accountAccess, ""},
+	"createAPIKey":         {accountAccess, ""},
+	"revokeAPIKey":         {accountAccess, ""},
+	"users":                {accountAccess, db.ManageUsersPermission},
+	"setUserRole":          {accountAccess, db.ManageUsersPermission},
+	"loginAttempts":        {accountAccess, db.ManageUsersPermission},
+	"invites":              {accountAccess, db.ManageUsersPermission},
+	"createInvite":         {accountAccess, db.ManageUsersPermission},
+	"revokeInvite":         {accountAccess, db.ManageUsersPermission},
+	"analyze":              {writeAccess, db.AnalyzePermission},
+	"updateKeyword":        {writeAccess, db.ManageKeywordsPermission},
+	"archiveKeyword":       {writeAccess, db.ManageKeywordsPermission},
+	"tagKeyword":           {writeAccess, db.ManageKeywordsPermission},
+	"untagKeyword":         {writeAccess, db.ManageKeywordsPermission},
+	"setKeywordSchedule":   {writeAccess, db.ManageKeywordsPermission},
+}
+
+// unknownRouteRule fails closed for routes missing in routeRules
+var unknownRouteRule = routeRule{writeAccess, db.ManageUsersPermission}
+
+type authContextKey struct{}
+
+// authInfo describes who made request and with which session or API key.
+type authInfo struct {
+	user    db.UserInfo
+	session db.Session
+	token   string
+	apiKey  *db.APIKey
+}
+
+// can checks permission of user role, requests made with API key are limited to its scopes too.
+func (info authInfo) can(permission db.Permission) bool {
+	if permission == "" {
+		return true
+	}
+	return db.RoleHasPermission(info.user.Role, permission) && (info.apiKey == nil || info.apiKey.Allows(permission))
+}
+
+// authMiddleware authenticates requests with cookies or bearer token and gates routes by their rules,
+// it responds with 401 to unauthenticated requests and with 403 to ones lacking permission or writing in read only mode.
+func authMiddleware(env db.Env, readOnly, privateReads bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := ""
+			if route := mux.CurrentRoute(r); route != nil {
+				name = route.GetName()
+			}
+			rule, found := routeRules[name]
+			if !found {
+				rule = unknownRouteRule
+			}
+			if rule.access == publicAccess || (rule.access == readAccess && !privateReads) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if rule.access == writeAccess && readOnly {
+				writeStatus(w, http.StatusForbidden, Forbidden)
+				return
+			}
+			info, err := authenticateRequest(env, r)
+			if err != nil {
+				log.Debug(fmt.Sprintf("Request to %v is not authenticated, %v", name, err))
+				writeStatus(w, http.StatusUnauthorized, Unauthorized)
+				return
+			}
+			if (rule.access == accountAccess && info.apiKey != nil) || !info.can(rule.permission) {
+				log.Debug(fmt.Sprintf("User %v with role %v lacks %v permission for %v", info.user.Username, info.user.Role, rule.permission, name))
+				writeStatus(w, http.StatusForbidden, Forbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authContextKey{}, info)))
+		})
+	}
+}
+
+// authenticateRequest prefers bearer token, cookies of username and token are used otherwise.
+// Bearer token is either API key or session token.
+func authenticateRequest(env db.Env, r *http.Request) (authInfo, error) {
+	token, bearer := bearerToken(r)
+	if bearer && strings.HasPrefix(token, db.APIKeyPrefix) {
+		user, apiKey, err := env.AuthenticateAPIKey(token)
+		if err != nil {
+			return authInfo{}, fmt.Errorf("Failed on call to AuthenticateAPIKey in authenticateRequest, %v", err)
+		}
+		return authInfo{user: user, apiKey: &apiKey}, nil
+	}
+	cookieUsername := ""
+	if !bearer {
+		username, cookieToken, err := parseAuthCookies(r)
+		if err != nil {
+			return authInfo{}, fmt.Errorf("Failed on call to parseAuthCookies in authenticateRequest, %v", err)
+		}
+		token, cookieUsername = cookieToken, username
+	}
+	user, session, err := env.AuthenticateToken(token)
+	if err != nil {
+		return authInfo{}, fmt.Errorf("Failed on call to AuthenticateToken in authenticateRequest, %v", err)
+	}
+	if !bearer && user.Username != cookieUsername {
+		return authInfo{}, fmt.Errorf("Session of %v used by %v", user.Username, cookieUsername)
+	}
+	return authInfo{user: user, session: session, token: token}, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+// requestAuth returns authentication of request made by authMiddleware, it is absent on public routes.
+func requestAuth(r *http.Request) (authInfo, bool) {
+	info, ok := r.Context().Value(authContextKey{}).(authInfo)
+	return info, ok
+}
+
+func writeStatus(w http.ResponseWriter, code int, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, status))
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	store, err := db.InitStore(db.MemoryDriver, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := db.NewEnv(store, "", "", "", "", "", nil, "secret")
+	for _, name := range []string{"admin", "viewer"} {
+		err = env.CreateUser(name, name+"@example.com", name+"-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	adminToken, _, err := env.CreateSession("admin", "test", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewerToken, _, err := env.CreateSession("viewer", "test", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, _, err := env.CreateAPIKey("admin", "ci", []db.Permission{db.ReadPermission, db.ManageUsersPermission})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := func(readOnly, privateReads bool) *mux.Router {
+		router := mux.NewRouter()
+		router.Use(authMiddleware(env, readOnly, privateReads))
+		ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+		router.HandleFunc("/keywords", ok).Methods("GET").Name("keywords")
+		router.HandleFunc("/me", ok).Methods("GET").Name("me")
+		router.HandleFunc("/users", ok).Methods("GET").Name("users")
+		router.HandleFunc("/analyze", ok).Methods("POST").Name("analyze")
+		router.HandleFunc("/unnamed", ok).Methods("GET")
+		router.HandleFunc("/unknown", ok).Methods("GET").Name("unknown")
+		return router
+	}
+	for _, c := range []struct {
+		desc         string
+		readOnly     bool
+		privateReads bool
+		method       string
+		path         string
+		username     string
+		token        string
+		code         int
+	}{
+		{"public read", false, false, "GET", "/keywords", "", "", http.StatusOK},
+		{"private read without credentials", false, true, "GET", "/keywords", "", "", http.StatusUnauthorized},
+		{"private read with session", false, true, "GET", "/keywords", "viewer", viewerToken, http.StatusOK},
+		{"account without credentials", false, false, "GET", "/me", "", "", http.StatusUnauthorized},
+		{"account with invalid token", false, false, "GET", "/me", "", "invalid", http.StatusUnauthorized},
+		{"account with cookie of other user", false, false, "GET", "/me", "viewer", adminToken, http.StatusUnauthorized},
+		{"account with session", false, false, "GET", "/me", "viewer", viewerToken, http.StatusOK},
+		{"account with bearer session", false, false, "GET", "/me", "", adminToken, http.StatusOK},
+		{"account with API key", false, false, "GET", "/users", "", apiKey, http.StatusForbidden},
+		{"missing permission", false, false, "GET", "/users", "viewer", viewerToken, http.StatusForbidden},
+		{"granted permission", false, false, "GET", "/users", "admin", adminToken, http.StatusOK},
+		{"write without credentials", false, false, "POST", "/analyze", "", "", http.StatusUnauthorized},
+		{"write without permission", false, false, "POST", "/analyze", "viewer", viewerToken, http.StatusForbidden},
+		{"write with permission", false, false, "POST", "/analyze", "admin", adminToken, http.StatusOK},
+		{"write in read only mode", true, false, "POST", "/analyze", "admin", adminToken, http.StatusForbidden},
+		{"account in read only mode", true, false, "GET", "/me", "admin", adminToken, http.StatusOK},
+		{"unnamed route without credentials", false, false, "GET", "/unnamed", "", "", http.StatusUnauthorized},
+		{"unnamed route without permission", false, false, "GET", "/unnamed", "viewer", viewerToken, http.StatusForbidden},
+		{"unknown route with admin", false, false, "GET", "/unknown", "admin", adminToken, http.StatusOK},
+		{"unknown route in read only mode", true, false, "GET", "/unknown", "admin", adminToken, http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if c.username != "" {
+			r.AddCookie(&http.Cookie{Name: "username", Value: c.username})
+			r.AddCookie(&http.Cookie{Name: "token", Value: c.token})
+		} else if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		router(c.readOnly, c.privateReads).ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Fatalf("%v should respond with %v, got %v %v", c.desc, c.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestSetCookies(t *testing.T) {
+	for _, proto := range []string{"", "https"} {
+		r := httptest.NewRequest("POST", "/api/login", nil)
+		if proto != "" {
+			r.Header.Set("X-Forwarded-Proto", proto)
+		}
+		w := httptest.NewRecorder()
+		setCookies(w, r, "admin", "token", time.Now().Add(time.Hour))
+		cookies := w.Result().Cookies()
+		if len(cookies) != 2 {
+			t.Fatalf("Username and token cookies should be set, got %v", cookies)
+		}
+		for _, cookie := range cookies {
+			if cookie.SameSite != http.SameSiteLaxMode || cookie.Secure != (proto == "https") {
+				t.Fatalf("Cookie %v should be SameSite=Lax and Secure only behind TLS", cookie)
+			}
+		}
+	}
+}
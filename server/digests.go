@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+type digestRequest struct {
+	Frequency string `json:"frequency"`
+}
+
+func digestSettings(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := requestAuth(r)
+		settings, err := env.GetDigestSettings(info.user.Username)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetDigestSettings in digestSettings, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, settings, "digestSettings")
+	}
+}
+
+// setDigest subscribes to daily or weekly digest of watchlist, empty frequency unsubscribes.
+func setDigest(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req digestRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in setDigest, %v", err))
+			return
+		}
+		info, _ := requestAuth(r)
+		settings, err := env.SetDigestFrequency(info.user.Username, req.Frequency)
+		if err == db.ErrInvalidDigest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to SetDigestFrequency in setDigest, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, settings, "setDigest")
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/events"
+)
+
+const maxEventKeywords = 50
+
+// eventsKeepAlive keeps idle streams from being closed by proxies
+var eventsKeepAlive = 15 * time.Second
+
+// streamEvents streams new analyzes and job status changes of keywords given in query as server-sent events,
+// keywords do not need to be present yet, so stream may be opened before analyze is requested.
+func streamEvents(bus *events.Bus) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keywords := r.URL.Query()["keyword"]
+		if len(keywords) == 0 || len(keywords) > maxEventKeywords {
+			log.Error(fmt.Sprintf("Events requested for %v keywords", len(keywords)))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rc := http.NewResponseController(w)
+		//Stream outlives server's write timeout
+		err := rc.SetWriteDeadline(time.Time{})
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to SetWriteDeadline in streamEvents, %v", err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		subscription := bus.Subscribe(keywords)
+		defer bus.Unsubscribe(subscription)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		err = rc.Flush()
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to Flush in streamEvents, %v", err))
+			return
+		}
+		ticker := time.NewTicker(eventsKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			case e := <-subscription.C:
+				err = writeEvent(w, e)
+			}
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				log.Debug(fmt.Sprintf("Events stream closed, %v", err))
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	eJSON, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("Failed on marshalling %v in writeEvent, %v", e, err)
+	}
+	_, err = fmt.Fprintf(w, "event: %v\ndata: %s\n\n", e.Type, eJSON)
+	return err
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/events"
+	"github.com/cezkuj/trends-analyzer/mail"
+)
+
+// readEvent reads lines of stream until blank line ending event or keep-alive comment.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	keepAlive := eventsKeepAlive
+	eventsKeepAlive = 50 * time.Millisecond
+	defer func() { eventsKeepAlive = keepAlive }()
+	env := db.NewEnv(db.NewMemoryStore(), "", "", "", "", "", nil, "secret")
+	bus := events.NewBus()
+	srv := httptest.NewServer(createServeMux(env, Cfg{}, bus, newAccountMailer(mail.LogMailer{}, ""), nil))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Stream without keywords should be rejected, got %v", resp.StatusCode)
+	}
+	resp, err = http.Get(srv.URL + "/api/events?keyword=trump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Stream should be opened, got %v, %v", resp.StatusCode, resp.Header)
+	}
+	stream := bufio.NewReader(resp.Body)
+	if lines := readEvent(t, stream); len(lines) != 1 || !strings.HasPrefix(lines[0], ":") {
+		t.Fatalf("Idle stream should be kept alive with comments, got %v", lines)
+	}
+	bus.Publish(events.NewJobEvent("orlen", events.JobStarted))
+	bus.Publish(events.NewAnalyzisEvent("trump", db.NewAnalyzis(1, "us", time.Now(), 10, 2, 0.5, 0.5, 0.5)))
+	bus.Publish(events.NewJobEvent("trump", events.JobFinished))
+	received := []events.Event{}
+	for len(received) < 2 {
+		lines := readEvent(t, stream)
+		if len(lines) != 2 {
+			continue
+		}
+		e := events.Event{}
+		err = json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines[0] != "event: "+e.Type {
+			t.Fatalf("Event name should be its type, got %v", lines)
+		}
+		received = append(received, e)
+	}
+	if received[0].Type != events.AnalyzisEvent || received[0].Analyzis == nil || received[0].Analyzis.ReactionAvg != 0.5 {
+		t.Fatalf("Analyzis of subscribed keyword should be streamed first, got %v", received[0])
+	}
+	if received[1].Type != events.JobEvent || received[1].Keyword != "trump" || received[1].Status != events.JobFinished {
+		t.Fatalf("Job status of subscribed keyword should be streamed, got %v", received[1])
+	}
+	resp.Body.Close()
+	for i := 0; bus.Subscribers() != 0; i++ {
+		if i == 100 {
+			t.Fatal("Subscription should be closed once client disconnects")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+func tagKeyword(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		err := env.TagKeyword(vars["keyword"], vars["tag"])
+		switch err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case db.ErrKeywordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case db.ErrInvalidTag:
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			log.Error(fmt.Errorf("Call to TagKeyword failed in tagKeyword, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+}
+
+func untagKeyword(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		err := env.UntagKeyword(vars["keyword"], vars["tag"])
+		switch err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case db.ErrKeywordNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			log.Error(fmt.Errorf("Call to UntagKeyword failed in untagKeyword, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+}
+
+func keywordTags(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tags, err := env.GetTagsOfKeyword(mux.Vars(r)["keyword"])
+		if err == db.ErrKeywordNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Call to GetTagsOfKeyword failed in keywordTags, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, tags, "keywordTags")
+	}
+}
+
+func groups(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tags, err := env.GetTags()
+		if err != nil {
+			log.Error(fmt.Errorf("Call to GetTags failed in groups, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, tags, "groups")
+	}
+}
+
+func groupMembers(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		members, err := env.GetGroupMembers(mux.Vars(r)["tag"])
+		if err != nil {
+			log.Error(fmt.Errorf("Call to GetGroupMembers failed in groupMembers, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(members) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, members, "groupMembers")
+	}
+}
+
+func groupAnalyzes(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseAnalyzesQuery(r.URL.Query())
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to parseAnalyzesQuery in groupAnalyzes, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		analyzes, err := env.GetGroupAnalyzes(mux.Vars(r)["tag"], q.after, q.before, q.country, q.interval, q.agg)
+		if err != nil {
+			log.Error(fmt.Errorf("Call to GetGroupAnalyzes failed in groupAnalyzes, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(analyzes) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, analyzes, "groupAnalyzes")
+	}
+}
+
+// groupIndex responds with volume weighted sentiment of group, bucketed daily unless interval is given.
+func groupIndex(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseAnalyzesQuery(r.URL.Query())
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to parseAnalyzesQuery in groupIndex, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if q.interval == "" {
+			q.interval = db.DayInterval
+		}
+		index, err := env.GetGroupIndex(mux.Vars(r)["tag"], q.after, q.before, q.country, q.interval)
+		if err != nil {
+			log.Error(fmt.Errorf("Call to GetGroupIndex failed in groupIndex, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, index, "groupIndex")
+	}
+}
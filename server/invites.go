@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+// inviteRequest defaults to single use invite with default role valid for db.DefaultInviteTTL.
+type inviteRequest struct {
+	Role           string `json:"role"`
+	MaxUses        int    `json:"max_uses"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+}
+
+// createdInvite is the only response carrying code itself.
+type createdInvite struct {
+	Code string `json:"code"`
+	db.Invite
+}
+
+func invites(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allInvites, err := env.GetInvites()
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetInvites in invites, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, allInvites, "invites")
+	}
+}
+
+func createInvite(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := inviteRequest{MaxUses: 1}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in createInvite, %v", err))
+			return
+		}
+		ttl := db.DefaultInviteTTL
+		if req.ExpiresInHours != 0 {
+			ttl = time.Duration(req.ExpiresInHours) * time.Hour
+		}
+		info, _ := requestAuth(r)
+		code, invite, err := env.CreateInvite(info.user.Username, req.Role, req.MaxUses, ttl)
+		if err == db.ErrInvalidRole || err == db.ErrInvalidInvite {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to CreateInvite in createInvite, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, createdInvite{code, invite}, "createInvite")
+	}
+}
+
+func revokeInvite(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		err = env.RevokeInvite(id)
+		if err == db.ErrInvalidInvite {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to RevokeInvite in revokeInvite, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
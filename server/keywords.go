@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+// updateKeyword replaces all editable fields of keyword on PUT and only given ones on PATCH.
+func updateKeyword(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyword := mux.Vars(r)["keyword"]
+		decoder := json.NewDecoder(r.Body)
+		var dat map[string]string
+		err := decoder.Decode(&dat)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in updateKeyword, %v", err))
+			return
+		}
+		update, err := parseKeywordUpdate(dat, r.Method == "PUT")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on call to parseKeywordUpdate in updateKeyword, %v", err))
+			return
+		}
+		k, err := env.UpdateKeyword(keyword, update)
+		writeKeyword(w, k, err, "updateKeyword")
+	}
+}
+
+func archiveKeyword(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k, err := env.ArchiveKeyword(mux.Vars(r)["keyword"])
+		writeKeyword(w, k, err, "archiveKeyword")
+	}
+}
+
+func writeKeyword(w http.ResponseWriter, k db.Keyword, err error, caller string) {
+	switch err {
+	case nil:
+	case db.ErrKeywordNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case db.ErrKeywordExists:
+		w.WriteHeader(http.StatusConflict)
+		return
+	case db.ErrInvalidKeywordStatus:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	default:
+		log.Error(fmt.Errorf("Call to UpdateKeyword failed in %v, %v", caller, err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	keywordJSON, err := json.Marshal(k)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on marshalling %v in %v, %v", k, caller, err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Write(keywordJSON)
+}
+
+func parseKeywordUpdate(dat map[string]string, replace bool) (db.KeywordUpdate, error) {
+	update := db.KeywordUpdate{}
+	fields := map[string]**string{
+		"name":            &update.Name,
+		"provider":        &update.Provider,
+		"additional_info": &update.AdditionalInfo,
+		"status":          &update.Status,
+	}
+	for field, target := range fields {
+		value, present := dat[field]
+		if !present {
+			if replace {
+				return db.KeywordUpdate{}, fmt.Errorf("%v not present in keyword", field)
+			}
+			continue
+		}
+		v := value
+		*target = &v
+	}
+	for field := range dat {
+		if _, known := fields[field]; !known {
+			return db.KeywordUpdate{}, fmt.Errorf("%v is not editable field of keyword", field)
+		}
+	}
+	if update.Name != nil && *update.Name == "" {
+		return db.KeywordUpdate{}, fmt.Errorf("name of keyword can not be empty")
+	}
+	return update, nil
+}
+
+func renames(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renames, err := env.GetRenames(mux.Vars(r)["keyword"])
+		if err == db.ErrKeywordNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Call to GetRenames failed in renames, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		renamesJSON, err := json.Marshal(renames)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on marshalling %v in renames, %v", renames, err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(renamesJSON)
+	}
+}
+
+func keywordSchedule(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, err := env.GetKeywordSchedule(mux.Vars(r)["keyword"])
+		if err == db.ErrKeywordNotFound || err == db.ErrScheduleNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Call to GetKeywordSchedule failed in keywordSchedule, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, s, "keywordSchedule")
+	}
+}
+
+// scheduleBounds are bounds in minutes of dispatcher's interval for keyword, country defaults to any.
+type scheduleBounds struct {
+	MinInterval int    `json:"min_interval"`
+	MaxInterval int    `json:"max_interval"`
+	Country     string `json:"country"`
+}
+
+// setKeywordSchedule overrides bounds given to keyword's schedule by min and max interval flags.
+func setKeywordSchedule(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bounds := scheduleBounds{}
+		err := json.NewDecoder(r.Body).Decode(&bounds)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in setKeywordSchedule, %v", err))
+			return
+		}
+		if bounds.Country == "" {
+			bounds.Country = "any"
+		}
+		s, err := env.SetKeywordSchedule(mux.Vars(r)["keyword"], bounds.MinInterval, bounds.MaxInterval, bounds.Country, time.Now())
+		if err == db.ErrKeywordNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			if err != db.ErrInvalidSchedule {
+				log.Error(fmt.Errorf("Call to SetKeywordSchedule failed in setKeywordSchedule, %v", err))
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, s, "setKeywordSchedule")
+	}
+}
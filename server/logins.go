@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+const (
+	defaultLoginAttemptsLimit = 100
+	maxLoginAttemptsLimit     = 1000
+)
+
+// loginAttempts lists login audit log, newest first, filtered by username, ip, failed=true and after.
+func loginAttempts(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values := r.URL.Query()
+		after, err := parseTime(values.Get("after"), time.Time{})
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to parseTime in loginAttempts, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit := defaultLoginAttemptsLimit
+		if limitStr := values.Get("limit"); limitStr != "" {
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 1 || limit > maxLoginAttemptsLimit {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		filter := db.LoginAttemptFilter{Username: values.Get("username"), IP: values.Get("ip"), FailedOnly: values.Get("failed") == "true", After: after, Limit: limit}
+		attempts, err := env.GetLoginAttempts(filter)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetLoginAttempts in loginAttempts, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, attempts, "loginAttempts")
+	}
+}
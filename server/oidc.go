@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+const (
+	oidcCookie = "oidc_login"
+	//oidcLoginTTL limits time user can spend on provider login page
+	oidcLoginTTL  = 10 * time.Minute
+	oidcStateSize = 16
+)
+
+type OIDCCfg struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	defaultRole  string
+}
+
+func NewOIDCCfg(issuer, clientID, clientSecret, redirectURL, defaultRole string) OIDCCfg {
+	return OIDCCfg{issuer, clientID, clientSecret, redirectURL, defaultRole}
+}
+
+// oidcLogin signs users in with OIDC provider using authorization code flow with PKCE.
+type oidcLogin struct {
+	oauth2      oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+	defaultRole string
+	publicURL   string
+}
+
+// oidcClaims are claims of ID token used to provision user.
+type oidcClaims struct {
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+}
+
+// newOIDCLogin discovers provider endpoints, it returns nil when no issuer is configured.
+// Callback defaults to /api/oidc/callback under publicURL.
+func newOIDCLogin(ctx context.Context, cfg OIDCCfg, publicURL string) (*oidcLogin, error) {
+	if cfg.issuer == "" {
+		return nil, nil
+	}
+	if !db.ValidRole(cfg.defaultRole) {
+		return nil, fmt.Errorf("Default role %v of OIDC users not supported", cfg.defaultRole)
+	}
+	provider, err := oidc.NewProvider(ctx, cfg.issuer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed on call to NewProvider in newOIDCLogin, %v", err)
+	}
+	publicURL = strings.TrimSuffix(publicURL, "/")
+	redirectURL := cfg.redirectURL
+	if redirectURL == "" {
+		redirectURL = publicURL + "/api/oidc/callback"
+	}
+	return &oidcLogin{
+		oauth2: oauth2.Config{
+			ClientID:     cfg.clientID,
+			ClientSecret: cfg.clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier:    provider.Verifier(&oidc.Config{ClientID: cfg.clientID}),
+		defaultRole: cfg.defaultRole,
+		publicURL:   publicURL,
+	}, nil
+}
+
+// oidcStart redirects to provider, state, nonce and PKCE verifier wait for callback in cookie only browser sends.
+func oidcStart(sso *oidcLogin) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, err := randomString()
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to randomString in oidcStart, %v", err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		nonce, err := randomString()
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to randomString in oidcStart, %v", err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		verifier := oauth2.GenerateVerifier()
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcCookie,
+			Value:    strings.Join([]string{state, nonce, verifier}, "."),
+			Path:     "/api/oidc",
+			MaxAge:   int(oidcLoginTTL.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, sso.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), http.StatusFound)
+	}
+}
+
+// oidcCallback exchanges code for ID token, logs in user mapped to it and redirects to frontend.
+func oidcCallback(env db.Env, sso *oidcLogin) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/api/oidc", MaxAge: -1, HttpOnly: true})
+		identity, err := sso.identity(r)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to identity in oidcCallback, %v", err))
+			writeStatus(w, http.StatusUnauthorized, Unauthorized)
+			return
+		}
+		user, err := env.LoginWithIdentity(identity, sso.defaultRole)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to LoginWithIdentity in oidcCallback, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token, session, err := env.CreateSession(user.Username, r.UserAgent(), clientIP(r))
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to CreateSession in oidcCallback, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		setCookies(w, r, user.Username, token, session.ExpiresAt)
+		http.Redirect(w, r, sso.publicURL+"/", http.StatusFound)
+	}
+}
+
+// identity checks callback against state cookie and verifies ID token it is exchanged for.
+func (sso *oidcLogin) identity(r *http.Request) (db.Identity, error) {
+	values := r.URL.Query()
+	if idpError := values.Get("error"); idpError != "" {
+		return db.Identity{}, fmt.Errorf("Provider refused login, %v: %v", idpError, values.Get("error_description"))
+	}
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return db.Identity{}, fmt.Errorf("Login cookie not found, %v", err)
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(values.Get("state"))) != 1 {
+		return db.Identity{}, fmt.Errorf("State does not match login cookie")
+	}
+	nonce, verifier := parts[1], parts[2]
+	token, err := sso.oauth2.Exchange(r.Context(), values.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		return db.Identity{}, fmt.Errorf("Failed on call to Exchange, %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return db.Identity{}, fmt.Errorf("ID token missing in token response")
+	}
+	idToken, err := sso.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		return db.Identity{}, fmt.Errorf("Failed on call to Verify, %v", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return db.Identity{}, fmt.Errorf("Nonce of ID token does not match login cookie")
+	}
+	claims := oidcClaims{}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return db.Identity{}, fmt.Errorf("Failed on parsing claims of ID token, %v", err)
+	}
+	return db.Identity{Issuer: idToken.Issuer, Subject: idToken.Subject, Username: claims.PreferredUsername, Email: claims.Email, EmailVerified: claims.EmailVerified}, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, oidcStateSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+// mockIdP is OIDC provider issuing ID token for code "code" when PKCE verifier matches challenge of authorization request.
+type mockIdP struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		verifierHash := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.idToken(t, idp.nonce),
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *mockIdP) idToken(t *testing.T, nonce string) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":                idp.URL,
+		"sub":                "subject-1",
+		"aud":                "client",
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              nonce,
+		"preferred_username": "sso-user",
+		"email":              "sso@example.com",
+		"email_verified":     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize starts login and records its PKCE challenge and nonce at provider, as if user signed in there.
+func (idp *mockIdP) authorize(t *testing.T, sso *oidcLogin, nonce func(string) string) (string, *http.Cookie) {
+	w := httptest.NewRecorder()
+	oidcStart(sso)(w, httptest.NewRequest("GET", "/api/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Login should redirect to provider, got %v", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := location.Query()
+	if !strings.HasPrefix(location.String(), idp.URL+"/authorize") || values.Get("code_challenge_method") != "S256" || values.Get("code_challenge") == "" {
+		t.Fatalf("Login should redirect to provider with PKCE challenge, got %v", location)
+	}
+	idp.mu.Lock()
+	idp.challenge = values.Get("code_challenge")
+	idp.nonce = nonce(values.Get("nonce"))
+	idp.mu.Unlock()
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcCookie {
+		t.Fatalf("Login should set login cookie, got %v", cookies)
+	}
+	return values.Get("state"), cookies[0]
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.Close()
+	store, err := db.InitStore(db.MemoryDriver, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := db.NewEnv(store, "", "", "", "", "", nil, "secret")
+	//Existing user takes admin role of the first one
+	err = env.CreateUser("admin", "admin@example.com", "admin-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sso, err := newOIDCLogin(context.Background(), NewOIDCCfg(idp.URL, "client", "secret", "", db.AnalystRole), "https://trends.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameNonce := func(nonce string) string { return nonce }
+	callback := func(state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/oidc/callback?code=code&state="+url.QueryEscape(state), nil)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		oidcCallback(env, sso)(w, r)
+		return w
+	}
+	for _, c := range []struct {
+		desc   string
+		nonce  func(string) string
+		state  func(string) string
+		cookie func(*http.Cookie) *http.Cookie
+	}{
+		{"state mismatch", sameNonce, func(string) string { return "other" }, nil},
+		{"nonce mismatch", func(string) string { return "other" }, nil, nil},
+		{"PKCE verifier mismatch", sameNonce, nil, func(c *http.Cookie) *http.Cookie {
+			parts := strings.Split(c.Value, ".")
+			return &http.Cookie{Name: c.Name, Value: parts[0] + "." + parts[1] + ".other"}
+		}},
+	} {
+		state, cookie := idp.authorize(t, sso, c.nonce)
+		if c.state != nil {
+			state = c.state(state)
+		}
+		if c.cookie != nil {
+			cookie = c.cookie(cookie)
+		}
+		w := callback(state, cookie)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("Callback with %v should be unauthorized, got %v", c.desc, w.Code)
+		}
+		present, err := env.UserIsPresent("sso-user")
+		if err != nil || present {
+			t.Fatalf("Callback with %v should not provision user, got %v, %v", c.desc, present, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		state, cookie := idp.authorize(t, sso, sameNonce)
+		w := callback(state, cookie)
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "https://trends.example.com/" {
+			t.Fatalf("Callback should redirect to frontend, got %v %v", w.Code, w.Body.String())
+		}
+		token := ""
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "token" {
+				token = c.Value
+			}
+		}
+		user, _, err := env.AuthenticateToken(token)
+		if err != nil {
+			t.Fatalf("Callback should create session, got %v", err)
+		}
+		if user.Username != "sso-user" || user.Role != db.AnalystRole || !user.EmailVerified {
+			t.Fatalf("Identity should be provisioned with default role and verified email, got %v", user)
+		}
+	}
+	users, err := env.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("Repeated login should reuse provisioned user, got %v", users)
+	}
+}
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -17,12 +21,15 @@ import (
 	"github.com/cezkuj/trends-analyzer/crypto"
 	"github.com/cezkuj/trends-analyzer/currency"
 	"github.com/cezkuj/trends-analyzer/db"
+	"github.com/cezkuj/trends-analyzer/events"
+	"github.com/cezkuj/trends-analyzer/mail"
 	"github.com/cezkuj/trends-analyzer/stock"
 )
 
 const (
-	UserNotPresent            = "USER_NOT_PRESENT"
-	PasswordIncorrect         = "PASSWORD_INCORRECT"
+	//CredentialsIncorrect does not tell whether user exists
+	CredentialsIncorrect      = "CREDENTIALS_INCORRECT"
+	TooManyAttempts           = "TOO_MANY_ATTEMPTS"
 	EverythingOk              = "EVERYTHING_OK"
 	RegistrationCodeIncorrect = "REGISTRATION_CODE_INCORRECT"
 	TokenIncorrect            = "TOKEN_INCORRECT"
@@ -30,25 +37,99 @@ const (
 )
 
 type DbCfg struct {
-	user string
-	pass string
-	host string
-	port int
-	name string
+	driver  string
+	user    string
+	pass    string
+	host    string
+	port    int
+	name    string
+	path    string
+	sslMode string
 }
 
-func NewDbCfg(user, pass, host string, port int, name string) DbCfg {
-	return DbCfg{user, pass, host, port, name}
+func NewDbCfg(driver, user, pass, host string, port int, name, path, sslMode string) DbCfg {
+	return DbCfg{driver, user, pass, host, port, name, path, sslMode}
 }
 
-func StartServer(dbCfg DbCfg, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode string, dispatchInterval int, readOnly bool) {
-	database, err := db.InitDb(fmt.Sprintf("%v:%v@tcp(%v:%v)/%v", dbCfg.user, dbCfg.pass, dbCfg.host, dbCfg.port, dbCfg.name))
+func (c DbCfg) dataSource() string {
+	switch c.driver {
+	case db.SQLiteDriver:
+		return c.path
+	case db.PostgresDriver:
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.user, c.pass),
+			Host:     fmt.Sprintf("%v:%v", c.host, c.port),
+			Path:     c.name,
+			RawQuery: url.Values{"sslmode": {c.sslMode}}.Encode(),
+		}
+		return u.String()
+	}
+	return fmt.Sprintf("%v:%v@tcp(%v:%v)/%v", c.user, c.pass, c.host, c.port, c.name)
+}
+
+// OpenStore connects to the store without migrating it.
+func OpenStore(dbCfg DbCfg) (db.Store, error) {
+	return db.OpenStore(dbCfg.driver, dbCfg.dataSource())
+}
+
+// Cfg configures server together with dispatcher, retention and digests running next to it.
+type Cfg struct {
+	DB                DbCfg
+	TwitterAPIKey     string
+	NewsAPIKey        string
+	StocksAPIKey      string
+	Salt              string
+	RegistrationCode  string
+	TokenSecret       string
+	Quotas            map[string]db.QuotaLimits
+	DispatchInterval  int
+	MinInterval       int
+	MaxInterval       int
+	Retention         db.RetentionPolicy
+	RetentionInterval int
+	RetentionDryRun   bool
+	ReadOnly          bool
+	PrivateReads      bool
+	TrustedProxies    []*net.IPNet
+	Mailer            mail.Mailer
+	PublicURL         string
+	OIDC              OIDCCfg
+	DigestInterval    int
+}
+
+func StartServer(cfg Cfg) {
+	if cfg.TokenSecret == "" {
+		log.Warn("Token secret not set, email verification and password reset links will not survive restart")
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			log.Fatal(fmt.Errorf("Failed on generating token secret in StartServer, %v", err))
+		}
+		cfg.TokenSecret = string(secret)
+	}
+	env, err := InitEnv(cfg.DB, cfg.TwitterAPIKey, cfg.NewsAPIKey, cfg.StocksAPIKey, cfg.Salt, cfg.RegistrationCode, cfg.TokenSecret, cfg.Quotas)
 	if err != nil {
-		log.Fatal(fmt.Errorf("Failed on InitDb in StartServer, %v", err))
+		log.Fatal(fmt.Errorf("Failed on InitEnv in StartServer, %v", err))
 	}
-	env := db.NewEnv(database, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode)
-	go analyzer.StartDispatching(env, dispatchInterval)
-	startHttpServer(env, readOnly)
+	sso, err := newOIDCLogin(context.Background(), cfg.OIDC, cfg.PublicURL)
+	if err != nil {
+		log.Fatal(fmt.Errorf("Failed on newOIDCLogin in StartServer, %v", err))
+	}
+	bus := events.NewBus()
+	go analyzer.StartDispatching(env, bus, cfg.DispatchInterval, cfg.MinInterval, cfg.MaxInterval)
+	go analyzer.StartRetention(env, cfg.Retention, cfg.RetentionInterval, cfg.RetentionDryRun)
+	go analyzer.StartLoginAttemptsPruning(env)
+	go analyzer.StartDigests(env, cfg.Mailer, cfg.PublicURL, cfg.DigestInterval)
+	startHttpServer(env, cfg, bus, newAccountMailer(cfg.Mailer, cfg.PublicURL), sso)
+}
+
+func InitEnv(dbCfg DbCfg, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode, tokenSecret string, quotas map[string]db.QuotaLimits) (db.Env, error) {
+	store, err := db.InitStore(dbCfg.driver, dbCfg.dataSource())
+	if err != nil {
+		return db.Env{}, fmt.Errorf("Failed on InitStore in InitEnv, %v", err)
+	}
+	return db.NewEnv(store, twitterAPIKey, newsAPIKey, stocksAPIKey, salt, registrationCode, quotas, tokenSecret), nil
 }
 
 type analyzeParams struct {
@@ -59,7 +140,7 @@ type analyzeParams struct {
 	textProvider    string
 }
 
-func analyze(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+func analyze(env db.Env, bus *events.Bus) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 		var dat map[string]string
@@ -82,7 +163,18 @@ func analyze(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 			log.Error(fmt.Errorf("Call to CreateKeywordIfNotPresent in analyze, %v", err))
 			return
 		}
-		go analyzer.Analyze(env, k.Name, aP.textProvider, aP.country, aP.date)
+		k, err = env.GetKeyword(aP.keyword)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Call to GetKeyword in analyze, %v", err))
+			return
+		}
+		if k.Status == db.KeywordArchived {
+			log.Error(fmt.Sprintf("Keyword %v is archived", k.Name))
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		go analyzer.Analyze(env, bus, k.Name, aP.textProvider, aP.country, aP.date)
 	}
 }
 
@@ -100,7 +192,7 @@ func parseBody(dat map[string]string) (analyzeParams, error) {
 	country, present := dat["country"]
 	if !present {
 		country = "any"
-	} else if country != "pl" && country != "gb" && country != "us" && country != "de" && country != "fr" {
+	} else if country == "any" || !db.ValidCountry(country) {
 		return analyzeParams{}, fmt.Errorf("Country %v not supported", country)
 	}
 	keywordProvider, present := dat["keywordProvider"]
@@ -129,47 +221,92 @@ func status(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func quotas(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		budgets, err := env.GetQuotaBudgets()
+		if err != nil {
+			log.Error(fmt.Errorf("Call to GetQuotaBudgets failed in quotas, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		budgetsJSON, err := json.Marshal(budgets)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on marshalling %v in quotas, %v", budgets, err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(budgetsJSON)
+	}
+}
+
 func keywords(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		keywords, err := env.GetKeywords()
+		search, err := parseKeywordSearch(r.URL.Query())
 		if err != nil {
-			log.Error(fmt.Errorf("Call to GetKeywords failed in keywords, %v", err))
+			log.Error(fmt.Errorf("Call to parseKeywordSearch failed in keywords, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page, err := env.SearchKeywords(search)
+		if err == db.ErrInvalidCursor || err == db.ErrInvalidSort {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		keywordsJSON, err := json.Marshal(keywords)
 		if err != nil {
-			log.Error(fmt.Errorf("Failed on marshalling %v in keyword, %v", keywords, err))
+			log.Error(fmt.Errorf("Call to SearchKeywords failed in keywords, %v", err))
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		w.Write(keywordsJSON)
+		//Body stays a list of keywords, next page is pointed by header
+		if page.NextCursor != "" {
+			w.Header().Set("X-Next-Cursor", page.NextCursor)
+		}
+		writeJSON(w, page.Keywords, "keywords")
 	}
 
 }
 
+// parseKeywordSearch reads keyword filters, sorting and pagination, archived keywords are listed only on demand.
+func parseKeywordSearch(values url.Values) (db.KeywordSearch, error) {
+	filter := db.KeywordFilter{
+		Prefix:          values.Get("prefix"),
+		Provider:        values.Get("provider"),
+		Tag:             values.Get("tag"),
+		Status:          values.Get("status"),
+		IncludeArchived: values.Get("archived") == "true",
+	}
+	if values.Get("active") == "true" {
+		filter.Status = db.KeywordActive
+	}
+	if filter.Status != "" && !db.ValidKeywordStatus(filter.Status) {
+		return db.KeywordSearch{}, fmt.Errorf("Status %v not supported", filter.Status)
+	}
+	order := values.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		return db.KeywordSearch{}, fmt.Errorf("Order %v not supported", order)
+	}
+	limit := 0
+	if limitStr := values.Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			return db.KeywordSearch{}, fmt.Errorf("Limit %v is not valid", limitStr)
+		}
+		limit = parsed
+	}
+	return db.KeywordSearch{KeywordFilter: filter, SortBy: values.Get("sort"), Desc: order == "desc", Cursor: values.Get("cursor"), Limit: limit}, nil
+}
+
 func analyzes(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//Declaring variables beforehand, to bypass scoping problems with if - to refactor later on
 		vars := mux.Vars(r)
 		keyword := vars["keyword"]
-		values := r.URL.Query()
-		after, err := parseTime(values.Get("after"), time.Time{})
-		if err != nil {
-			log.Error(fmt.Errorf("Failed on call to parseTime in analyzes, %v", err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		before, err := parseTime(values.Get("before"), time.Now())
+		q, err := parseAnalyzesQuery(r.URL.Query())
 		if err != nil {
-			log.Error(fmt.Errorf("Failed on call to parseTime in analyzes, %v", err))
+			log.Error(fmt.Errorf("Failed on call to parseAnalyzesQuery in analyzes, %v", err))
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		country := values.Get("country")
-		if country == "" {
-			country = "any"
-		}
 		keywordPresent, err := env.KeywordIsPresent(keyword)
 		if err != nil {
 			log.Error(fmt.Errorf("Call to KeywordIsPresent failed in analyzes, %v", err))
@@ -181,7 +318,12 @@ func analyzes(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
-		analyzes, err := env.GetAnalyzes(keyword, after, before, country)
+		var analyzes []db.Analyzis
+		if q.interval == "" {
+			analyzes, err = env.GetAnalyzes(keyword, q.after, q.before, q.country)
+		} else {
+			analyzes, err = env.GetAggregatedAnalyzes(keyword, q.after, q.before, q.country, q.interval, q.agg)
+		}
 		if err != nil {
 			log.Error(fmt.Errorf("Call to GetAnalyzes failed in analyzes, %v", err))
 			w.WriteHeader(http.StatusBadRequest)
@@ -197,6 +339,48 @@ func analyzes(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type analyzesQuery struct {
+	after    time.Time
+	before   time.Time
+	country  string
+	interval string
+	agg      string
+}
+
+func parseAnalyzesQuery(values url.Values) (analyzesQuery, error) {
+	after, err := parseTime(values.Get("after"), time.Time{})
+	if err != nil {
+		return analyzesQuery{}, fmt.Errorf("Failed on call to parseTime, %v", err)
+	}
+	before, err := parseTime(values.Get("before"), time.Now())
+	if err != nil {
+		return analyzesQuery{}, fmt.Errorf("Failed on call to parseTime, %v", err)
+	}
+	country := values.Get("country")
+	if country == "" {
+		country = "any"
+	}
+	interval := values.Get("interval")
+	agg := values.Get("agg")
+	if agg == "" {
+		agg = db.AvgAgg
+	}
+	if (interval != "" && !db.ValidInterval(interval)) || !db.ValidAgg(agg) || (interval == "" && values.Get("agg") != "") {
+		return analyzesQuery{}, fmt.Errorf("Interval %v with aggregation %v not supported", interval, agg)
+	}
+	return analyzesQuery{after, before, country, interval, agg}, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, caller string) {
+	vJSON, err := json.Marshal(v)
+	if err != nil {
+		log.Error(fmt.Errorf("Failed on marshalling %v in %v, %v", v, caller, err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Write(vJSON)
+}
+
 func parseTime(timeStr string, defaultTime time.Time) (time.Time, error) {
 	if timeStr == "" {
 		return defaultTime, nil
@@ -249,6 +433,17 @@ func stocks(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		err = env.ConsumeQuota(db.AlphaVantageProvider)
+		if err == db.ErrQuotaExhausted {
+			log.Error(fmt.Errorf("Alpha Vantage quota exhausted in stocks"))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Call to ConsumeQuota failed in stocks, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		stocksSeries, err := stock.Series(env.StocksAPIKey, symbol, startDate, endDate)
 		if err != nil {
 			log.Error(fmt.Errorf("Call to stocks Series failed in stocks, %v", err))
@@ -276,6 +471,17 @@ func cryptocurrencies(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		err = env.ConsumeQuota(db.AlphaVantageProvider)
+		if err == db.ErrQuotaExhausted {
+			log.Error(fmt.Errorf("Alpha Vantage quota exhausted in crypto"))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Call to ConsumeQuota failed in crypto, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		cryptoSeries, err := crypto.Series(env.StocksAPIKey, fromCurrency, toCurrency, startDate, endDate)
 		if err != nil {
 			log.Error(fmt.Errorf("Call to crypto Series failed in crypto, %v", err))
@@ -360,40 +566,34 @@ func login(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 			log.Error(fmt.Errorf("Failed on call to parseUsernameAndPassword in login, %v", err))
 			return
 		}
-		present, err := env.UserIsPresent(username)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			log.Error(fmt.Errorf("Failed on call to IsUserPresent in login, %v", err))
-			return
-		}
-		if !present {
-			log.Debug(fmt.Sprintf("User %v is not present", username))
-			io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, UserNotPresent))
+		correct, wait, err := env.Login(username, password, clientIP(r))
+		if err == db.ErrLoginThrottled {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeStatus(w, http.StatusTooManyRequests, TooManyAttempts)
 			return
 		}
-		correct, err := env.PasswordIsCorrect(username, password)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			log.Error(fmt.Errorf("Failed on call to IsPasswordCorrect in login, %v", err))
+			log.Error(fmt.Errorf("Failed on call to Login in login, %v", err))
 			return
 		}
 		if !correct {
-			log.Debug(fmt.Sprintf("Password for %v is not correct", username))
-			io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, PasswordIncorrect))
+			log.Debug(fmt.Sprintf("Credentials of %v are not correct", username))
+			io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, CredentialsIncorrect))
 			return
 		}
-		token, err := env.UpdateToken(username)
+		token, session, err := env.CreateSession(username, r.UserAgent(), clientIP(r))
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			log.Error(fmt.Errorf("Failed on call to UpdateToken in login, %v", err))
+			log.Error(fmt.Errorf("Failed on call to CreateSession in login, %v", err))
 			return
 		}
-		setCookies(w, username, token)
+		setCookies(w, r, username, token, session.ExpiresAt)
 		io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, EverythingOk))
 	}
 }
 
-func register(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+func register(env db.Env, mailer accountMailer) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 		var dat map[string]string
@@ -410,11 +610,17 @@ func register(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 			log.Error(fmt.Errorf("failed on call to parseRegistrationInfo in register, %v", err))
 			return
 		}
-		if registrationCode != env.RegistrationCode {
+		err = env.CheckRegistrationCode(registrationCode)
+		if err == db.ErrInvalidInvite {
 			log.Debug(fmt.Sprintf("Registation code for user  %v is incorrect", username))
 			io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, RegistrationCodeIncorrect))
 			return
 		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on call to CheckRegistrationCode in register, %v", err))
+			return
+		}
 		present, err := env.UserIsPresent(username)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -427,13 +633,28 @@ func register(env db.Env) func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		token, err := env.CreateUser(username, email, password)
+		err = env.RegisterUser(username, email, password, registrationCode)
+		if err == db.ErrInvalidInvite {
+			log.Debug(fmt.Sprintf("Invite for user  %v was used up meanwhile", username))
+			io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, RegistrationCodeIncorrect))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on call to RegisterUser in register, %v", err))
+			return
+		}
+		err = sendVerificationEmail(env, mailer, username)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to sendVerificationEmail in register, %v", err))
+		}
+		token, session, err := env.CreateSession(username, r.UserAgent(), clientIP(r))
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			log.Error(fmt.Errorf("Failed on call to CreateUser in register, %v", err))
+			log.Error(fmt.Errorf("Failed on call to CreateSession in register, %v", err))
 			return
 		}
-		setCookies(w, username, token)
+		setCookies(w, r, username, token, session.ExpiresAt)
 		io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, EverythingOk))
 	}
 }
@@ -466,16 +687,22 @@ func parseRegistrationInfo(dat map[string]string) (string, string, string, strin
 	return username, password, email, registrationCode, nil
 }
 
-func setCookies(w http.ResponseWriter, username, token string) {
-	cookies := createCookies(username, token)
+// setCookies marks cookies Secure when request came over TLS, directly or through a proxy terminating it.
+// Spoofed X-Forwarded-Proto only keeps cookie from being sent back over plain HTTP, so it does not need a trusted proxy.
+func setCookies(w http.ResponseWriter, r *http.Request, username, token string, expires time.Time) {
+	secure := r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+	cookies := createCookies(username, token, expires, secure)
 	for _, cookie := range cookies {
 		http.SetCookie(w, &cookie)
 	}
 }
 
-func createCookies(username, token string) []http.Cookie {
-	nextDay := time.Now().Add(24 * time.Hour)
-	return []http.Cookie{http.Cookie{Name: "username", Value: username, Expires: nextDay}, http.Cookie{Name: "token", Value: token, Expires: nextDay}}
+// createCookies sets SameSite=Lax, so cookies are not sent with cross-site POST, PUT or DELETE requests.
+func createCookies(username, token string, expires time.Time, secure bool) []http.Cookie {
+	return []http.Cookie{
+		http.Cookie{Name: "username", Value: username, Expires: expires, Secure: secure, SameSite: http.SameSiteLaxMode},
+		http.Cookie{Name: "token", Value: token, Expires: expires, HttpOnly: true, Secure: secure, SameSite: http.SameSiteLaxMode},
+	}
 }
 
 func authenticate(env db.Env) func(w http.ResponseWriter, r *http.Request) {
@@ -513,8 +740,8 @@ func parseAuthCookies(r *http.Request) (string, string, error) {
 	return username.Value, token.Value, nil
 }
 
-func startHttpServer(env db.Env, readOnly bool) {
-	serveMux := createServeMux(env, readOnly)
+func startHttpServer(env db.Env, cfg Cfg, bus *events.Bus, mailer accountMailer, sso *oidcLogin) {
+	serveMux := createServeMux(env, cfg, bus, mailer, sso)
 	srv := &http.Server{
 		Addr:         ":8000",
 		ReadTimeout:  5 * time.Second,
@@ -525,22 +752,67 @@ func startHttpServer(env db.Env, readOnly bool) {
 	log.Println(srv.ListenAndServe())
 }
 
-func createServeMux(env db.Env, readOnly bool) *http.ServeMux {
+// createServeMux registers single sign-on routes only when sso is configured.
+func createServeMux(env db.Env, cfg Cfg, bus *events.Bus, mailer accountMailer, sso *oidcLogin) *http.ServeMux {
 	router := mux.NewRouter()
 	apiRouter := router.PathPrefix("/api").Subrouter()
-	if !readOnly {
-		apiRouter.HandleFunc("/analyze", analyze(env)).Methods("POST")
-	}
-	apiRouter.HandleFunc("/status", status(env)).Methods("GET")
-	apiRouter.HandleFunc("/keywords", keywords(env)).Methods("GET")
-	apiRouter.HandleFunc("/analyzes/{keyword}", analyzes(env)).Methods("GET")
-	apiRouter.HandleFunc("/countries/{keyword}", countries(env)).Methods("GET")
-	apiRouter.HandleFunc("/rates/{baseCur}/{cur}", rates(env)).Methods("GET")
-	apiRouter.HandleFunc("/stocks/{symbol}", stocks(env)).Methods("GET")
-	apiRouter.HandleFunc("/crypto/{fromCurrency}/{toCurrency}", cryptocurrencies(env)).Methods("GET")
-	apiRouter.HandleFunc("/login", login(env)).Methods("POST")
-	apiRouter.HandleFunc("/register", register(env)).Methods("POST")
-	apiRouter.HandleFunc("/authenticate", authenticate(env)).Methods("GET")
+	apiRouter.Use(proxyMiddleware(cfg.TrustedProxies))
+	apiRouter.Use(authMiddleware(env, cfg.ReadOnly, cfg.PrivateReads))
+	apiRouter.HandleFunc("/analyze", analyze(env, bus)).Methods("POST").Name("analyze")
+	apiRouter.HandleFunc("/status", status(env)).Methods("GET").Name("status")
+	apiRouter.HandleFunc("/keywords", keywords(env)).Methods("GET").Name("keywords")
+	apiRouter.HandleFunc("/keywords/{keyword}", updateKeyword(env)).Methods("PUT", "PATCH").Name("updateKeyword")
+	apiRouter.HandleFunc("/keywords/{keyword}", archiveKeyword(env)).Methods("DELETE").Name("archiveKeyword")
+	apiRouter.HandleFunc("/keywords/{keyword}/renames", renames(env)).Methods("GET").Name("renames")
+	apiRouter.HandleFunc("/keywords/{keyword}/tags/{tag}", tagKeyword(env)).Methods("PUT").Name("tagKeyword")
+	apiRouter.HandleFunc("/keywords/{keyword}/tags/{tag}", untagKeyword(env)).Methods("DELETE").Name("untagKeyword")
+	apiRouter.HandleFunc("/keywords/{keyword}/tags", keywordTags(env)).Methods("GET").Name("keywordTags")
+	apiRouter.HandleFunc("/keywords/{keyword}/schedule", keywordSchedule(env)).Methods("GET").Name("keywordSchedule")
+	apiRouter.HandleFunc("/keywords/{keyword}/schedule", setKeywordSchedule(env)).Methods("PUT").Name("setKeywordSchedule")
+	apiRouter.HandleFunc("/groups", groups(env)).Methods("GET").Name("groups")
+	apiRouter.HandleFunc("/groups/{tag}", groupMembers(env)).Methods("GET").Name("groupMembers")
+	apiRouter.HandleFunc("/groups/{tag}/analyzes", groupAnalyzes(env)).Methods("GET").Name("groupAnalyzes")
+	apiRouter.HandleFunc("/groups/{tag}/index", groupIndex(env)).Methods("GET").Name("groupIndex")
+	apiRouter.HandleFunc("/quotas", quotas(env)).Methods("GET").Name("quotas")
+	apiRouter.HandleFunc("/analyzes/{keyword}", analyzes(env)).Methods("GET").Name("analyzes")
+	apiRouter.HandleFunc("/events", streamEvents(bus)).Methods("GET").Name("events")
+	apiRouter.HandleFunc("/countries/{keyword}", countries(env)).Methods("GET").Name("countries")
+	apiRouter.HandleFunc("/rates/{baseCur}/{cur}", rates(env)).Methods("GET").Name("rates")
+	apiRouter.HandleFunc("/stocks/{symbol}", stocks(env)).Methods("GET").Name("stocks")
+	apiRouter.HandleFunc("/crypto/{fromCurrency}/{toCurrency}", cryptocurrencies(env)).Methods("GET").Name("crypto")
+	apiRouter.HandleFunc("/login", login(env)).Methods("POST").Name("login")
+	apiRouter.HandleFunc("/register", register(env, mailer)).Methods("POST").Name("register")
+	apiRouter.HandleFunc("/verify-email", verifyEmail(env)).Methods("POST").Name("verifyEmail")
+	apiRouter.HandleFunc("/verify-email/resend", resendVerification(env, mailer)).Methods("POST").Name("resendVerification")
+	apiRouter.HandleFunc("/password-reset", requestPasswordReset(env, mailer)).Methods("POST").Name("requestPasswordReset")
+	apiRouter.HandleFunc("/password-reset/confirm", resetPassword(env)).Methods("POST").Name("resetPassword")
+	if sso != nil {
+		apiRouter.HandleFunc("/oidc/login", oidcStart(sso)).Methods("GET").Name("oidcLogin")
+		apiRouter.HandleFunc("/oidc/callback", oidcCallback(env, sso)).Methods("GET").Name("oidcCallback")
+	}
+	apiRouter.HandleFunc("/authenticate", authenticate(env)).Methods("GET").Name("authenticate")
+	apiRouter.HandleFunc("/logout", logout(env)).Methods("POST").Name("logout")
+	apiRouter.HandleFunc("/me", me(env)).Methods("GET").Name("me")
+	apiRouter.HandleFunc("/me/watchlist", watchlist(env)).Methods("GET").Name("watchlist")
+	apiRouter.HandleFunc("/me/watchlist/{keyword}", follow(env)).Methods("PUT").Name("follow")
+	apiRouter.HandleFunc("/me/watchlist/{keyword}", unfollow(env)).Methods("DELETE").Name("unfollow")
+	apiRouter.HandleFunc("/me/digest", digestSettings(env)).Methods("GET").Name("digestSettings")
+	apiRouter.HandleFunc("/me/digest", setDigest(env)).Methods("PUT").Name("setDigest")
+	apiRouter.HandleFunc("/alerts", alertRules(env)).Methods("GET").Name("alertRules")
+	apiRouter.HandleFunc("/alerts", createAlertRule(env)).Methods("POST").Name("createAlertRule")
+	apiRouter.HandleFunc("/alerts/{id}", deleteAlertRule(env)).Methods("DELETE").Name("deleteAlertRule")
+	apiRouter.HandleFunc("/alerts/{id}/deliveries", alertDeliveries(env)).Methods("GET").Name("alertDeliveries")
+	apiRouter.HandleFunc("/users", users(env)).Methods("GET").Name("users")
+	apiRouter.HandleFunc("/users/{username}/role", setUserRole(env)).Methods("PUT").Name("setUserRole")
+	apiRouter.HandleFunc("/login-attempts", loginAttempts(env)).Methods("GET").Name("loginAttempts")
+	apiRouter.HandleFunc("/invites", invites(env)).Methods("GET").Name("invites")
+	apiRouter.HandleFunc("/invites", createInvite(env)).Methods("POST").Name("createInvite")
+	apiRouter.HandleFunc("/invites/{id}", revokeInvite(env)).Methods("DELETE").Name("revokeInvite")
+	apiRouter.HandleFunc("/apikeys", apiKeys(env)).Methods("GET").Name("apiKeys")
+	apiRouter.HandleFunc("/apikeys", createAPIKey(env)).Methods("POST").Name("createAPIKey")
+	apiRouter.HandleFunc("/apikeys/{id}", revokeAPIKey(env)).Methods("DELETE").Name("revokeAPIKey")
+	apiRouter.HandleFunc("/sessions", sessions(env)).Methods("GET").Name("sessions")
+	apiRouter.HandleFunc("/sessions/{id}", revokeSession(env)).Methods("DELETE").Name("revokeSession")
 	serveMux := &http.ServeMux{}
 	serveMux.Handle("/", router)
 	return serveMux
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+type sessionView struct {
+	db.Session
+	Current bool `json:"current"`
+}
+
+// sessions lists sessions of logged in user, the one request was made with is marked as current.
+func sessions(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := requestAuth(r)
+		userSessions, err := env.GetSessions(info.user.Username)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetSessions in sessions, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		views := []sessionView{}
+		for _, s := range userSessions {
+			views = append(views, sessionView{s, s.ID == info.session.ID})
+		}
+		writeJSON(w, views, "sessions")
+	}
+}
+
+func revokeSession(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		info, _ := requestAuth(r)
+		err = env.RevokeSession(info.user.Username, id)
+		if err == db.ErrSessionNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to RevokeSession in revokeSession, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// logout revokes session of request and expires its cookies.
+func logout(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, bearer := bearerToken(r)
+		var err error
+		if !bearer {
+			_, token, err = parseAuthCookies(r)
+		}
+		if err == nil {
+			err = env.Logout(token)
+			if err != nil {
+				log.Error(fmt.Errorf("Failed on call to Logout in logout, %v", err))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		setCookies(w, r, "", "", time.Unix(0, 0))
+		io.WriteString(w, fmt.Sprintf(`{"status":"%v"}`, EverythingOk))
+	}
+}
+
+// ParseTrustedProxies parses addresses and CIDR ranges of reverse proxies whose forwarding headers are trusted.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("Failed on parsing trusted proxy %v in ParseTrustedProxies, %v", p, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// proxyMiddleware replaces remote address of requests coming through trusted proxies with client address they forwarded,
+// headers of other peers are ignored, as anyone could spoof them.
+func proxyMiddleware(trusted []*net.IPNet) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := forwardedIP(r, trusted); ip != "" {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedIP walks X-Forwarded-For from the right, as proxies append to it, and returns first address not being
+// a trusted proxy, X-Real-IP is used when X-Forwarded-For is missing.
+func forwardedIP(r *http.Request, trusted []*net.IPNet) string {
+	if !isTrusted(clientIP(r), trusted) {
+		return ""
+	}
+	hops := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	ip := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	if ip == "" && len(hops) == 0 {
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+			ip = realIP
+		}
+	}
+	return ip
+}
+
+func isTrusted(address string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns address of peer of request, which is the client forwarded by trusted proxy after proxyMiddleware.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Fatal("Invalid range should not parse")
+	}
+	for _, c := range []struct {
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		ip         string
+	}{
+		{"203.0.113.9:4000", []string{"198.51.100.1"}, "", "203.0.113.9"},
+		{"10.0.0.2:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"10.0.0.2:4000", []string{"198.51.100.7, 198.51.100.1, 10.0.0.3"}, "", "198.51.100.1"},
+		{"192.168.1.1:4000", []string{"198.51.100.7", "198.51.100.1"}, "", "198.51.100.1"},
+		{"10.0.0.2:4000", []string{"10.0.0.4, 10.0.0.3"}, "", "10.0.0.4"},
+		{"10.0.0.2:4000", []string{"unknown"}, "", "10.0.0.2"},
+		{"10.0.0.2:4000", nil, "198.51.100.1", "198.51.100.1"},
+		{"192.168.1.2:4000", nil, "198.51.100.1", "192.168.1.2"},
+	} {
+		r := httptest.NewRequest("GET", "/api/login", nil)
+		r.RemoteAddr = c.remoteAddr
+		for _, f := range c.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		if c.realIP != "" {
+			r.Header.Set("X-Real-IP", c.realIP)
+		}
+		proxyMiddleware(trusted)(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), r)
+		if ip := clientIP(r); ip != c.ip {
+			t.Fatalf("Client of %v forwarding %v should be %v, got %v", c.remoteAddr, c.forwarded, c.ip, ip)
+		}
+	}
+}
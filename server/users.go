@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+func me(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := requestAuth(r)
+		writeJSON(w, info.user, "me")
+	}
+}
+
+func users(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allUsers, err := env.GetUsers()
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetUsers in users, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, allUsers, "users")
+	}
+}
+
+// setUserRole promotes or demotes user to role given in body.
+func setUserRole(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		var dat map[string]string
+		err := decoder.Decode(&dat)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error(fmt.Errorf("Failed on decoding in setUserRole, %v", err))
+			return
+		}
+		user, err := env.SetUserRole(mux.Vars(r)["username"], dat["role"])
+		switch err {
+		case nil:
+			writeJSON(w, user, "setUserRole")
+		case db.ErrInvalidRole:
+			w.WriteHeader(http.StatusBadRequest)
+		case db.ErrUserNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case db.ErrLastAdmin:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			log.Error(fmt.Errorf("Failed on call to SetUserRole in setUserRole, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+}
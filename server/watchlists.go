@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cezkuj/trends-analyzer/db"
+)
+
+// watchlist lists keywords followed by user with changes against previous period, period is day (default) or week.
+func watchlist(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period := r.URL.Query().Get("period")
+		if period == "" {
+			period = db.DayInterval
+		}
+		if period != db.DayInterval && period != db.WeekInterval {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		info, _ := requestAuth(r)
+		entries, err := env.GetWatchlist(info.user.Username, period)
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to GetWatchlist in watchlist, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, entries, "watchlist")
+	}
+}
+
+func follow(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := requestAuth(r)
+		err := env.Follow(info.user.Username, mux.Vars(r)["keyword"])
+		if err == db.ErrKeywordNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to Follow in follow, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func unfollow(env db.Env) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := requestAuth(r)
+		err := env.Unfollow(info.user.Username, mux.Vars(r)["keyword"])
+		if err == db.ErrKeywordNotFound || err == db.ErrNotFollowed {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("Failed on call to Unfollow in unfollow, %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}